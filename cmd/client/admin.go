@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// admin shows the state of the server.
+func admin(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "admin", "topics|subs|stats")
+	format := fs.String("o", "table", "output format: table or json")
+	subject := fs.String("subject", "", "list only the consumers of `subject` (subs)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("admin: one of topics, subs or stats is required")
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	client := pb.NewAdminClient(e.conn)
+
+	var resp proto.Message
+	var table func(w *tabwriter.Writer)
+	switch fs.Arg(0) {
+	case "topics":
+		subjects, err := client.ListSubjects(ctx, &pb.ListSubjectsRequest{})
+		if err != nil {
+			return err
+		}
+		resp = subjects
+		table = func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "SUBJECT\tMESSAGES\tBYTES\tFIRST\tLAST\tSEGMENTS")
+			for _, s := range subjects.GetSubjects() {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", s.GetSubject(), s.GetMessages(), s.GetBytes(),
+					s.GetFirstSequence(), s.GetLastSequence(), s.GetSegments())
+			}
+		}
+	case "subs":
+		consumers, err := client.ListConsumers(ctx, &pb.ListConsumersRequest{Subject: *subject})
+		if err != nil {
+			return err
+		}
+		resp = consumers
+		table = func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "CONSUMER\tSUBJECT\tACKED\tPENDING\tLAG")
+			for _, c := range consumers.GetConsumers() {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%v\n", c.GetName(), c.GetSubject(), c.GetAckSequence(),
+					c.GetPending(), c.GetLag().AsDuration())
+			}
+		}
+	case "stats":
+		stats, err := client.GetStats(ctx, &pb.GetStatsRequest{})
+		if err != nil {
+			return err
+		}
+		resp = stats
+		table = func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "subjects:\t%d\n", stats.GetSubjects())
+			fmt.Fprintf(w, "subscriptions:\t%d\n", stats.GetSubscriptions())
+			fmt.Fprintf(w, "published:\t%d\n", stats.GetPublished())
+			fmt.Fprintf(w, "enqueued:\t%d\n", stats.GetEnqueued())
+			fmt.Fprintf(w, "dropped:\t%d\n", stats.GetDropped())
+			fmt.Fprintf(w, "duplicates:\t%d\n", stats.GetDuplicates())
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("admin: unknown subcommand %q", fs.Arg(0))
+	}
+
+	if *format == "json" {
+		data, err := protojson.MarshalOptions{Multiline: true, EmitUnpopulated: true}.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(e.stdout, string(data))
+		return err
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/server"
+)
+
+// sentHeader carries the time a benchmark message was published at, in
+// nanoseconds since the Unix epoch.
+const sentHeader = "bench-sent"
+
+// benchDrain is how long the benchmark waits for events still in flight
+// once publishing stopped.
+const benchDrain = 5 * time.Second
+
+// benchConfig is the setup of a benchmark run.
+type benchConfig struct {
+	Publishers  int           `json:"publishers"`
+	Subscribers int           `json:"subscribers"`
+	Subjects    int           `json:"subjects"`
+	Dist        string        `json:"distribution"`
+	Size        int           `json:"size"`
+	Rate        int           `json:"rate"`
+	Messages    int64         `json:"messages,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Block       bool          `json:"block"`
+	prefix      string
+}
+
+// bench publishes from several publishers to subscribers on every subject
+// and reports throughput, drops and publish-to-receive latency.
+func bench(ctx context.Context, e *env, args []string) error {
+	var cfg benchConfig
+	fs := newFlagSet(e, "bench", "")
+	fs.IntVar(&cfg.Publishers, "pubs", 1, "number of publishers")
+	fs.IntVar(&cfg.Subscribers, "subs", 1, "number of subscribers, each subscribed to every subject")
+	fs.IntVar(&cfg.Subjects, "subjects", 1, "number of subjects to publish to")
+	fs.StringVar(&cfg.Dist, "dist", "uniform", "distribution of messages over subjects: uniform or zipf")
+	fs.IntVar(&cfg.Size, "size", 128, "message size in bytes")
+	fs.IntVar(&cfg.Rate, "rate", 0, "messages per second of all publishers; 0 is as fast as possible")
+	fs.Int64Var(&cfg.Messages, "msgs", 0, "stop after this many messages")
+	fs.DurationVar(&cfg.Duration, "duration", 10*time.Second, "stop after this long")
+	fs.BoolVar(&cfg.Block, "block", false, "publish with block, so that full subscriber queues slow publishers down instead of dropping")
+	fs.StringVar(&cfg.prefix, "prefix", "bench", "prefix of the subject names")
+	embedded := fs.Bool("embedded", false, "benchmark an in-process server instead of -addr")
+	format := fs.String("o", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case cfg.Publishers < 1 || cfg.Subscribers < 0 || cfg.Subjects < 1 || cfg.Size < 0 || cfg.Rate < 0:
+		return errors.New("bench: -pubs and -subjects must be positive, the other counts not negative")
+	case cfg.Dist != "uniform" && cfg.Dist != "zipf":
+		return fmt.Errorf("bench: unknown distribution %q", cfg.Dist)
+	case *format != "text" && *format != "json":
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	conn := grpc.ClientConnInterface(e.conn)
+	if *embedded {
+		srv := server.New(nil, server.WithAddress("127.0.0.1:0"))
+		if err := srv.Start(ctx); err != nil {
+			return err
+		}
+		defer srv.Shutdown(context.Background())
+		cc, err := grpc.NewClient(srv.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer cc.Close()
+		conn = cc
+	}
+
+	report, err := runBench(ctx, pb.NewPubSubClient(conn), cfg)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	report.print(e.stdout)
+	return nil
+}
+
+// benchReport is the result of a benchmark run.
+type benchReport struct {
+	Config    benchConfig   `json:"config"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Published int64         `json:"published"`
+	Errors    int64         `json:"errors"`
+	// Expected is the number of events the server queued for the
+	// subscribers; Dropped those it dropped because a queue was full and
+	// Lost those that were queued but never arrived.
+	Expected int64     `json:"expected"`
+	Received int64     `json:"received"`
+	Dropped  int64     `json:"dropped"`
+	Lost     int64     `json:"lost"`
+	Latency  histogram `json:"latency"`
+}
+
+func runBench(ctx context.Context, client pb.PubSubClient, cfg benchConfig) (*benchReport, error) {
+	subjects := make([]string, cfg.Subjects)
+	for i := range subjects {
+		subjects[i] = cfg.prefix + "." + strconv.Itoa(i)
+	}
+
+	subCtx, stopSubs := context.WithCancel(ctx)
+	defer stopSubs()
+	var received atomic.Int64
+	var subs sync.WaitGroup
+	latencies := make([][]time.Duration, cfg.Subscribers*len(subjects))
+	for i := range latencies {
+		stream, err := client.Subscribe(subCtx, &pb.SubscribeRequest{Key: subjects[i%len(subjects)]})
+		if err != nil {
+			return nil, err
+		}
+		// Publishing starts once every subscription is confirmed.
+		if _, err := stream.Header(); err != nil {
+			return nil, err
+		}
+		subs.Add(1)
+		go func() {
+			defer subs.Done()
+			for {
+				event, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				now := time.Now()
+				if sent, err := strconv.ParseInt(event.GetHeaders()[sentHeader], 10, 64); err == nil {
+					latencies[i] = append(latencies[i], now.Sub(time.Unix(0, sent)))
+				}
+				received.Add(1)
+			}
+		}()
+	}
+
+	pubCtx, stopPubs := context.WithTimeout(ctx, cfg.Duration)
+	defer stopPubs()
+	var published, errs, expected, dropped, remaining atomic.Int64
+	remaining.Store(cfg.Messages)
+	payload := make([]byte, cfg.Size)
+	// Every publisher sends at its share of the rate.
+	var interval time.Duration
+	if cfg.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(cfg.Publishers) / float64(cfg.Rate))
+	}
+
+	start := time.Now()
+	var pubs sync.WaitGroup
+	for p := range cfg.Publishers {
+		pubs.Add(1)
+		go func() {
+			defer pubs.Done()
+			rng := rand.New(rand.NewPCG(uint64(start.UnixNano()), uint64(p)))
+			pick := func() string { return subjects[rng.IntN(len(subjects))] }
+			if cfg.Dist == "zipf" && len(subjects) > 1 {
+				zipf := rand.NewZipf(rng, 1.1, 1, uint64(len(subjects)-1))
+				pick = func() string { return subjects[zipf.Uint64()] }
+			}
+
+			next := time.Now()
+			for pubCtx.Err() == nil {
+				if cfg.Messages > 0 && remaining.Add(-1) < 0 {
+					return
+				}
+				if interval > 0 {
+					next = next.Add(interval)
+					select {
+					case <-time.After(time.Until(next)):
+					case <-pubCtx.Done():
+						return
+					}
+				}
+				resp, err := client.Publish(pubCtx, &pb.PublishRequest{
+					Key:     pick(),
+					Payload: payload,
+					Headers: map[string]string{sentHeader: strconv.FormatInt(time.Now().UnixNano(), 10)},
+					Block:   cfg.Block,
+				})
+				if err != nil {
+					if pubCtx.Err() == nil {
+						errs.Add(1)
+					}
+					continue
+				}
+				published.Add(1)
+				expected.Add(int64(resp.GetEnqueued()))
+				dropped.Add(int64(resp.GetDropped()))
+			}
+		}()
+	}
+	pubs.Wait()
+	elapsed := time.Since(start)
+
+	// Wait for the events still in flight.
+	deadline := time.Now().Add(benchDrain)
+	for received.Load() < expected.Load() && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stopSubs()
+	subs.Wait()
+
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	return &benchReport{
+		Config:    cfg,
+		Elapsed:   elapsed,
+		Published: published.Load(),
+		Errors:    errs.Load(),
+		Expected:  expected.Load(),
+		Received:  received.Load(),
+		Dropped:   dropped.Load(),
+		Lost:      max(expected.Load()-received.Load(), 0),
+		Latency:   newHistogram(all),
+	}, nil
+}
+
+func (r *benchReport) print(w io.Writer) {
+	c := r.Config
+	seconds := r.Elapsed.Seconds()
+	rate := func(n int64) string {
+		return fmt.Sprintf("%.0f msgs/s, %.2f MiB/s", float64(n)/seconds, float64(n)*float64(c.Size)/seconds/(1<<20))
+	}
+	fmt.Fprintf(w, "Publishers: %d, subscribers: %d, subjects: %d (%s), message size: %d B\n",
+		c.Publishers, c.Subscribers, c.Subjects, c.Dist, c.Size)
+	fmt.Fprintf(w, "Elapsed:    %v\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Published:  %d (%s), %d errors\n", r.Published, rate(r.Published), r.Errors)
+	fmt.Fprintf(w, "Received:   %d (%s)\n", r.Received, rate(r.Received))
+	fmt.Fprintf(w, "Dropped:    %d by the server, %d lost\n", r.Dropped, r.Lost)
+	r.Latency.print(w)
+}
+
+// latencyBuckets are the upper bounds of the histogram buckets.
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second,
+}
+
+// histogram summarizes latencies.
+type histogram struct {
+	Count int             `json:"count"`
+	Min   time.Duration   `json:"min"`
+	P50   time.Duration   `json:"p50"`
+	P90   time.Duration   `json:"p90"`
+	P99   time.Duration   `json:"p99"`
+	P999  time.Duration   `json:"p999"`
+	Max   time.Duration   `json:"max"`
+	Le    []time.Duration `json:"le"`
+	// Counts[i] is the number of latencies up to Le[i]; the last count is
+	// of those above.
+	Counts []int `json:"counts"`
+}
+
+func newHistogram(latencies []time.Duration) histogram {
+	h := histogram{Count: len(latencies), Le: latencyBuckets, Counts: make([]int, len(latencyBuckets)+1)}
+	if len(latencies) == 0 {
+		return h
+	}
+	slices.Sort(latencies)
+	quantile := func(q float64) time.Duration {
+		return latencies[int(q*float64(len(latencies)-1))]
+	}
+	h.Min, h.Max = latencies[0], latencies[len(latencies)-1]
+	h.P50, h.P90, h.P99, h.P999 = quantile(0.5), quantile(0.9), quantile(0.99), quantile(0.999)
+	for _, l := range latencies {
+		i, _ := slices.BinarySearch(latencyBuckets, l)
+		h.Counts[i]++
+	}
+	return h
+}
+
+func (h histogram) print(w io.Writer) {
+	if h.Count == 0 {
+		fmt.Fprintln(w, "Latency:    no events received")
+		return
+	}
+	fmt.Fprintf(w, "Latency:    min %v, p50 %v, p90 %v, p99 %v, p99.9 %v, max %v\n",
+		h.Min, h.P50, h.P90, h.P99, h.P999, h.Max)
+	peak := slices.Max(h.Counts)
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		label := "> " + h.Le[len(h.Le)-1].String()
+		if i < len(h.Le) {
+			label = "<= " + h.Le[i].String()
+		}
+		bar := strings.Repeat("#", (n*40+peak-1)/peak)
+		fmt.Fprintf(w, "  %10s %10d  %s\n", label, n, bar)
+	}
+}
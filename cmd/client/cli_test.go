@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/StepanErshov/pubsub/config"
+	"github.com/StepanErshov/pubsub/pkg/server"
+)
+
+func startServer(t *testing.T) string {
+	cfg := &config.Config{}
+	cfg.Storage.Dir = t.TempDir()
+	cfg.Storage.Subjects = []config.SubjectConfig{{Subject: "orders"}}
+	srv := server.New(cfg, server.WithAddress("127.0.0.1:0"))
+	require.NoError(t, srv.Start(context.Background()))
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv.Addr().String()
+}
+
+// runCLI runs the client with args against addr and returns its output.
+func runCLI(t *testing.T, addr, stdin string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	err := run(ctx, append([]string{"-addr", addr}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	if err != nil {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return stdout.String(), err
+}
+
+func TestPubSub(t *testing.T) {
+	addr := startServer(t)
+
+	out, err := runCLI(t, addr, "", "pub", "-H", "type=order", "orders", "one", "two")
+	require.NoError(t, err)
+	assert.Equal(t, "Published 2 messages to orders\n", out)
+	out, err = runCLI(t, addr, "three\nfour\n", "pub", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, "Published 2 messages to orders\n", out)
+
+	out, err = runCLI(t, addr, "", "sub", "-start", "1", "-count", "4", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\nthree\nfour\n", out)
+
+	out, err = runCLI(t, addr, "", "sub", "-start", "1", "-count", "1", "-o", "json", "orders")
+	require.NoError(t, err)
+	var msg message
+	require.NoError(t, json.Unmarshal([]byte(out), &msg))
+	assert.Equal(t, message{Subject: "orders", Seq: 1, Headers: map[string]string{"type": "order"}, Data: "one"}, msg)
+
+	out, err = runCLI(t, addr, "", "sub", "-start", "3", "-count", "1", "-template", "{{.Seq}}: {{.Data}}", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, "3: three\n", out)
+
+	out, err = runCLI(t, addr, "", "sub", "-for", "100ms", "news")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestRequest(t *testing.T) {
+	addr := startServer(t)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := runCLI(t, addr, "", "sub", "-reply", "pong", "-count", "1", "ping")
+		done <- err
+	}()
+	// Wait for the responder to subscribe.
+	require.Eventually(t, func() bool {
+		out, err := runCLI(t, addr, "", "admin", "stats")
+		return err == nil && strings.Contains(out, "subscriptions:  1")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	out, err := runCLI(t, addr, "", "-timeout", "2s", "request", "ping", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "pong\n", out)
+	require.NoError(t, <-done)
+}
+
+func TestAdmin(t *testing.T) {
+	addr := startServer(t)
+	_, err := runCLI(t, addr, "", "pub", "orders", "one")
+	require.NoError(t, err)
+
+	out, err := runCLI(t, addr, "", "admin", "topics")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"orders", "1"}, strings.Fields(lines[1])[:2])
+
+	out, err = runCLI(t, addr, "", "admin", "-o", "json", "stats")
+	require.NoError(t, err)
+	var stats map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &stats))
+	assert.Equal(t, "1", stats["published"])
+
+	_, err = runCLI(t, addr, "", "admin", "queues")
+	assert.ErrorContains(t, err, "unknown subcommand")
+}
+
+func TestBench(t *testing.T) {
+	out, err := runCLI(t, "", "", "bench", "-embedded", "-pubs", "2", "-subs", "2", "-subjects", "3", "-dist", "zipf", "-msgs", "200", "-o", "json")
+	require.NoError(t, err)
+
+	var report benchReport
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.Equal(t, int64(200), report.Published)
+	assert.Equal(t, int64(400), report.Expected)
+	assert.Equal(t, int64(400), report.Received)
+	assert.Equal(t, 400, report.Latency.Count)
+	assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+}
+
+func TestHistogram(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 1000; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Microsecond)
+	}
+	h := newHistogram(latencies)
+	assert.Equal(t, time.Microsecond, h.Min)
+	assert.Equal(t, 500*time.Microsecond, h.P50)
+	assert.Equal(t, 990*time.Microsecond, h.P99)
+	assert.Equal(t, time.Millisecond, h.Max)
+	// Up to 100µs, 250µs, 500µs and 1ms.
+	assert.Equal(t, []int{100, 150, 250, 500}, h.Counts[:4])
+
+	var out bytes.Buffer
+	h.print(&out)
+	assert.Contains(t, out.String(), "p50 500µs")
+}
@@ -1,52 +1,207 @@
+// Command client is a command line client for the PubSub service.
+//
+//	client [global flags] pub SUBJECT [MESSAGE...]
+//	client [global flags] sub SUBJECT
+//	client [global flags] request SUBJECT MESSAGE
+//	client [global flags] admin topics|subs|stats
+//	client [global flags] bench [flags]
 package main
 
 import (
 	"context"
-	"log"
-	"time"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-
-	pb "github.com/StepanErshov/pubsub/pkg/pb"
 )
 
+const usage = `Usage: client [global flags] COMMAND [flags] [args]
+
+Commands:
+  pub SUBJECT [MESSAGE...]   publish the messages, or the lines of -file or stdin
+  sub SUBJECT                print the events published on SUBJECT
+  request SUBJECT MESSAGE    publish MESSAGE and print the first reply
+  admin topics|subs|stats    show the persisted subjects, consumers or bus stats
+  bench                      measure throughput and publish-to-receive latency
+
+Run "client COMMAND -h" for the flags of a command.
+
+Global flags:
+`
+
 func main() {
-	conn, err := grpc.NewClient(
-		"localhost:50051",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "client:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// env holds what the commands share.
+type env struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+type command func(ctx context.Context, e *env, args []string) error
+
+var commands = map[string]command{
+	"pub":     pub,
+	"sub":     sub,
+	"request": request,
+	"admin":   admin,
+	"bench":   bench,
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", envOr("PUBSUB_ADDR", "localhost:50051"), "server address ($PUBSUB_ADDR)")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of requests")
+	var c connFlags
+	fs.BoolVar(&c.tls, "tls", false, "connect with TLS")
+	fs.StringVar(&c.ca, "ca", "", "PEM file with the CA certificates to verify the server with (implies -tls)")
+	fs.StringVar(&c.cert, "cert", "", "PEM file with the client certificate (implies -tls)")
+	fs.StringVar(&c.key, "key", "", "PEM file with the key of the client certificate")
+	fs.StringVar(&c.serverName, "server-name", "", "server name to verify the certificate for")
+	fs.BoolVar(&c.skipVerify, "insecure-skip-verify", false, "do not verify the server certificate")
+	fs.StringVar(&c.token, "token", os.Getenv("PUBSUB_TOKEN"), "bearer token sent with each request ($PUBSUB_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	opts, err := c.dialOptions()
 	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+		return err
+	}
+	conn, err := grpc.NewClient(*addr, opts...)
+	if err != nil {
+		return err
 	}
 	defer conn.Close()
 
-	client := pb.NewPubSubClient(conn)
+	e := &env{conn: conn, timeout: *timeout, stdin: stdin, stdout: stdout, stderr: stderr}
+	return cmd(ctx, e, fs.Args()[1:])
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// connFlags configure the connection to the server.
+type connFlags struct {
+	tls        bool
+	ca         string
+	cert       string
+	key        string
+	serverName string
+	skipVerify bool
+	token      string
+}
+
+func (c *connFlags) dialOptions() ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if c.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(c.token)))
+	}
+	if !c.tls && c.ca == "" && c.cert == "" {
+		return append(opts, grpc.WithTransportCredentials(insecure.NewCredentials())), nil
+	}
 
-	go func() {
-		stream, err := client.Subscribe(context.Background(), &pb.SubscribeRequest{Key: "test"})
+	cfg := &tls.Config{ServerName: c.serverName, InsecureSkipVerify: c.skipVerify}
+	if c.ca != "" {
+		pem, err := os.ReadFile(c.ca)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		for {
-			event, err := stream.Recv()
-			if err != nil {
-				log.Fatal(err)
-			}
-			log.Printf("Received: %s", event.Data)
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.ca)
 		}
-	}()
-
-	for i := 0; i < 3; i++ {
-		_, err = client.Publish(context.Background(), &pb.PublishRequest{
-			Key:  "test",
-			Data: fmt.Sprintf("Message %d", i),
-		})
+	}
+	if c.cert != "" {
+		cert, err := tls.LoadX509KeyPair(c.cert, c.key)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		time.Sleep(1 * time.Second)
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cfg))), nil
+}
+
+// bearerToken sends a token in the authorization header. It is sent
+// without TLS as well, e.g. to a local server.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// headerFlag collects repeated -H name=value flags.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (h headerFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return errors.New("header must be name=value")
+	}
+	h[name] = value
+	return nil
+}
+
+// newFlagSet returns the flag set of a command.
+func newFlagSet(e *env, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: client %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
 	}
-}
\ No newline at end of file
+	return fs
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// pub publishes the messages given as arguments or, without any, each
+// line of a file or stdin.
+func pub(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "pub", "SUBJECT [MESSAGE...]")
+	headers := headerFlag{}
+	fs.Var(headers, "H", "header `name=value` of the messages, repeatable")
+	contentType := fs.String("content-type", "", "content type of the messages, e.g. application/json")
+	key := fs.String("key", "", "message key, e.g. of the entity on a compacted subject")
+	file := fs.String("file", "", "publish each line of `path`; - reads stdin")
+	wait := fs.Bool("wait", false, "wait until the subscribers received each message")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("pub: subject is required")
+	}
+	subject, messages := fs.Arg(0), fs.Args()[1:]
+	if len(messages) > 0 && *file != "" {
+		return errors.New("pub: messages and -file are mutually exclusive")
+	}
+
+	next := func() ([]byte, bool) {
+		if len(messages) == 0 {
+			return nil, false
+		}
+		m := messages[0]
+		messages = messages[1:]
+		return []byte(m), true
+	}
+	var lines *bufio.Scanner
+	if len(messages) == 0 {
+		var r io.Reader = e.stdin
+		if *file != "" && *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		lines = bufio.NewScanner(r)
+		lines.Buffer(nil, 16<<20)
+		next = func() ([]byte, bool) {
+			if !lines.Scan() {
+				return nil, false
+			}
+			return append([]byte(nil), lines.Bytes()...), true
+		}
+	}
+
+	stream, err := pb.NewPubSubClient(e.conn).PublishStream(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		data, ok := next()
+		if !ok {
+			break
+		}
+		err := stream.Send(&pb.PublishRequest{
+			Key:             subject,
+			Payload:         data,
+			ContentType:     *contentType,
+			Headers:         headers,
+			MessageKey:      *key,
+			WaitForDelivery: *wait,
+		})
+		if err != nil {
+			// The server ended the stream; CloseAndRecv returns why.
+			break
+		}
+	}
+	if lines != nil && lines.Err() != nil {
+		stream.CloseSend()
+		return lines.Err()
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	for _, perr := range resp.GetErrors() {
+		fmt.Fprintf(e.stderr, "message %d: %s\n", perr.GetIndex()+1, perr.GetMessage())
+	}
+	fmt.Fprintf(e.stdout, "Published %d messages to %s\n", resp.GetPublished(), subject)
+	if n := len(resp.GetErrors()); n > 0 {
+		return fmt.Errorf("pub: %d messages failed", n)
+	}
+	return nil
+}
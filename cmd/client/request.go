@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/StepanErshov/pubsub/pkg/client"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+// request publishes a message with a reply-to header naming a new inbox
+// subject and prints the first event published on the inbox. Responders
+// publish their reply to the subject in the header, see sub -reply.
+func request(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "request", "SUBJECT MESSAGE")
+	headers := headerFlag{}
+	fs.Var(headers, "H", "header `name=value` of the request, repeatable")
+	contentType := fs.String("content-type", "", "content type of the request")
+	format := fs.String("o", "raw", "output format of the reply: raw, json or template")
+	tmpl := fs.String("template", "", "Go `template` for the reply; implies -o template")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("request: subject and message are required")
+	}
+	subject, data := fs.Arg(0), fs.Arg(1)
+	out, err := newPrinter(e.stdout, *format, *tmpl)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	bus := client.New(e.conn).Bus()
+	defer bus.Close(context.Background())
+
+	inbox := newInbox()
+	replies := make(chan *subpub.Message, 1)
+	inboxSub, err := bus.Subscribe(inbox, func(msg interface{}) {
+		select {
+		case replies <- msg.(*subpub.Message):
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-inboxSub.Ready():
+	case <-ctx.Done():
+		return fmt.Errorf("request: could not subscribe to the reply subject: %w", ctx.Err())
+	}
+
+	headers[replyToHeader] = inbox
+	err = bus.PublishCtx(ctx, subject, &subpub.Message{
+		Headers:     headers,
+		Data:        []byte(data),
+		ContentType: *contentType,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case reply := <-replies:
+		return out.print(inbox, reply)
+	case <-ctx.Done():
+		return fmt.Errorf("request: no reply within %v", e.timeout)
+	}
+}
+
+// newInbox returns a unique subject for the replies to one request.
+func newInbox() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "_INBOX." + hex.EncodeToString(b[:])
+}
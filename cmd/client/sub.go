@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/StepanErshov/pubsub/pkg/client"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+// replyToHeader names the subject a request expects its reply on.
+const replyToHeader = "reply-to"
+
+// sub prints the events published on a subject until interrupted or a
+// limit is reached.
+func sub(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "sub", "SUBJECT")
+	filter := fs.String("filter", "", "filter `expression`, e.g. 'header.type == \"order\"'")
+	consumer := fs.String("consumer", "", "subscribe as the durable consumer `name`")
+	start := fs.Uint64("start", 0, "replay a persisted subject from `sequence` on")
+	count := fs.Int("count", 0, "exit after `n` events")
+	duration := fs.Duration("for", 0, "exit after this long")
+	format := fs.String("o", "raw", "output format: raw, json or template")
+	tmpl := fs.String("template", "", "Go `template` for each event, e.g. '{{.Seq}} {{.Data}}'; implies -o template")
+	reply := fs.String("reply", "", "answer requests with `message`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("sub: exactly one subject is required")
+	}
+	subject := fs.Arg(0)
+	out, err := newPrinter(e.stdout, *format, *tmpl)
+	if err != nil {
+		return err
+	}
+
+	var opts []client.SubscribeOption
+	if *filter != "" {
+		opts = append(opts, client.WithFilter(*filter))
+	}
+	if *consumer != "" {
+		opts = append(opts, client.WithConsumer(*consumer))
+	}
+	if *start > 0 {
+		opts = append(opts, client.WithStartSequence(*start))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	errc := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errc <- err:
+		default:
+		}
+		cancel()
+	}
+	bus := client.New(e.conn).Bus(client.WithErrorHandler(func(_ string, err error) {
+		fail(err)
+	}))
+	defer bus.Close(context.Background())
+
+	received := 0
+	_, err = bus.Subscribe(subject, func(msg interface{}) {
+		if *count > 0 && received >= *count {
+			return
+		}
+		m := msg.(*subpub.Message)
+		if err := out.print(subject, m); err != nil {
+			fail(err)
+			return
+		}
+		if to := m.Headers[replyToHeader]; *reply != "" && to != "" {
+			if err := bus.PublishCtx(ctx, to, *reply); err != nil {
+				fmt.Fprintf(e.stderr, "sub: failed to reply to %s: %v\n", to, err)
+			}
+		}
+		received++
+		if *count > 0 && received >= *count {
+			cancel()
+		}
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
+}
+
+// message is how events are printed as JSON and passed to templates.
+type message struct {
+	Subject     string            `json:"subject"`
+	Seq         uint64            `json:"seq,omitempty"`
+	Key         string            `json:"key,omitempty"`
+	Tombstone   bool              `json:"tombstone,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	// Data is set for text, DataBase64 for other payloads.
+	Data       string `json:"data,omitempty"`
+	DataBase64 []byte `json:"data_base64,omitempty"`
+}
+
+func newMessage(subject string, m *subpub.Message) message {
+	msg := message{
+		Subject:     subject,
+		Seq:         m.Seq,
+		Key:         m.Key,
+		Tombstone:   m.Tombstone,
+		Headers:     m.Headers,
+		ContentType: m.ContentType,
+	}
+	if utf8.Valid(m.Data) {
+		msg.Data = string(m.Data)
+	} else {
+		msg.DataBase64 = m.Data
+	}
+	return msg
+}
+
+// printer writes events in one of the output formats.
+type printer struct {
+	w      io.Writer
+	format string
+	tmpl   *template.Template
+}
+
+func newPrinter(w io.Writer, format, tmpl string) (*printer, error) {
+	p := &printer{w: w, format: format}
+	if tmpl != "" {
+		p.format = "template"
+	}
+	switch p.format {
+	case "raw", "json":
+	case "template":
+		if tmpl == "" {
+			return nil, errors.New("-o template requires -template")
+		}
+		var err error
+		if p.tmpl, err = template.New("event").Parse(tmpl); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	return p, nil
+}
+
+func (p *printer) print(subject string, m *subpub.Message) error {
+	switch p.format {
+	case "json":
+		return json.NewEncoder(p.w).Encode(newMessage(subject, m))
+	case "template":
+		if err := p.tmpl.Execute(p.w, newMessage(subject, m)); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(p.w)
+		return err
+	}
+	data := m.Data
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		data = append(data[:len(data):len(data)], '\n')
+	}
+	_, err := p.w.Write(data)
+	return err
+}
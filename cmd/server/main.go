@@ -2,8 +2,7 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"net"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,54 +10,60 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"google.golang.org/grpc"
 
 	"github.com/StepanErshov/pubsub/config"
-	"github.com/StepanErshov/pubsub/internal/service"
-	"github.com/StepanErshov/pubsub/pkg/subpub"
+	"github.com/StepanErshov/pubsub/pkg/server"
 )
 
 func main() {
 	configureLogger()
 	log.Info().Msg("=== SERVER STARTING ===")
 
-	cfg, err := config.Load("config.yaml")
+	cfg, err := config.Load(configPath())
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load config")
 	}
 
 	setLogLevel(cfg.Log.Level)
 
-	bus := subpub.NewSubPub()
-	defer bus.Close(context.Background())
+	// SIGINT and SIGTERM are handled once: the first starts the shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	grpcServer := grpc.NewServer()
-	service.NewPubSubService(bus).Register(grpcServer)
-
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPC.Port))
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to listen")
+	if err := run(ctx, server.New(cfg), cfg.GRPC.ShutdownTimeout); err != nil {
+		log.Fatal().Err(err).Msg("Server failed")
 	}
-	log.Info().Str("address", lis.Addr().String()).Msg("Server listening on")
+	log.Info().Msg("=== SERVER STOP ===")
+}
 
-	go func() {
-		log.Info().Int("port", cfg.GRPC.Port).Msg("Starting gRPC server")
-		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatal().Err(err).Msg("Failed to serve")
-		}
-	}()
+// configPath returns the config file given as the first argument, or
+// config.yaml.
+func configPath() string {
+	if len(os.Args) > 1 {
+		return os.Args[1]
+	}
+	return "config.yaml"
+}
 
+// run starts srv and shuts it down within timeout once ctx ends or
+// it stops serving.
+func run(ctx context.Context, srv *server.Server, timeout time.Duration) error {
+	if err := srv.Start(ctx); err != nil {
+		return err
+	}
 	log.Info().Msg("Server started. Press Ctrl+C to stop")
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	<-sigChan
-
-	log.Info().Msg("Shutting down")
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("Shutting down server...")
+	case serveErr = <-srv.Err():
+		log.Error().Err(serveErr).Msg("Failed to serve")
+	}
 
-	waitForShutdown(grpcServer, cfg.GRPC.ShutdownTimeout)
-	log.Info().Str("address", lis.Addr().String()).Msg("Server listening on port")
-	log.Info().Msg("=== SERVER STOP ===")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return errors.Join(serveErr, srv.Shutdown(shutdownCtx))
 }
 
 func configureLogger() {
@@ -70,32 +75,6 @@ func configureLogger() {
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 }
 
-func waitForShutdown(server *grpc.Server, timeout time.Duration) {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigChan
-
-	log.Info().Msg("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	stopped := make(chan struct{})
-	go func() {
-		server.GracefulStop()
-		close(stopped)
-	}()
-
-	select {
-	case <-stopped:
-		log.Info().Msg("Server stopped gracefully")
-	case <-ctx.Done():
-		server.Stop()
-		log.Warn().Msg("Server forced to stop")
-	}
-}
-
 func setLogLevel(level string) {
 	logLevel, err := zerolog.ParseLevel(level)
 	if err != nil {
@@ -1,15 +1,19 @@
 package main
 
 import (
+    "context"
     "os"
+    "os/signal"
     "syscall"
     "testing"
     "time"
 	
-	"google.golang.org/grpc"
 	"github.com/rs/zerolog"
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/require"
+
+    "github.com/StepanErshov/pubsub/config"
+    "github.com/StepanErshov/pubsub/pkg/server"
 )
 
 func TestConfigureLogger(t *testing.T) {
@@ -17,22 +21,23 @@ func TestConfigureLogger(t *testing.T) {
     assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
 }
 
-func TestWaitForShutdown(t *testing.T) {
-    server := grpc.NewServer()
-    timeout := 100 * time.Millisecond
+func TestSigtermShutsDown(t *testing.T) {
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
 
     go func() {
         time.Sleep(10 * time.Millisecond)
         proc, err := os.FindProcess(os.Getpid())
         require.NoError(t, err)
-        proc.Signal(syscall.SIGINT)
+        proc.Signal(syscall.SIGTERM)
     }()
 
+    timeout := time.Second
     start := time.Now()
-    waitForShutdown(server, timeout)
-    elapsed := time.Since(start)
+    err := run(ctx, server.New(&config.Config{}), timeout)
+    require.NoError(t, err)
 
-    assert.True(t, elapsed < timeout, "Should shutdown before timeout")
+    assert.True(t, time.Since(start) < timeout, "Should shutdown on a single SIGTERM before timeout")
 }
 
 func TestMainFunction(t *testing.T) {
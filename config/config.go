@@ -11,10 +11,59 @@ type Config struct {
     GRPC struct {
         Port            int           `yaml:"port"`
         ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+        PublishTimeout  time.Duration `yaml:"publish_timeout"`
+        // HeartbeatInterval is how long a subscription that asked for
+        // heartbeats may be idle before one is sent.
+        HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+        // SendTimeout closes subscription streams whose client has not
+        // taken an event for this long.
+        SendTimeout time.Duration `yaml:"send_timeout"`
     } `yaml:"grpc"`
+    Bus struct {
+        QueueSize  int  `yaml:"queue_size"`
+        WorkerPool bool `yaml:"worker_pool"`
+        Workers    int  `yaml:"workers"`
+        Dedup      struct {
+            Window     time.Duration `yaml:"window"`
+            MaxEntries int           `yaml:"max_entries"`
+        } `yaml:"dedup"`
+    } `yaml:"bus"`
+    Storage struct {
+        Dir                string          `yaml:"dir"`
+        SegmentSize        int64           `yaml:"segment_size"`
+        CompactionInterval time.Duration   `yaml:"compaction_interval"`
+        Subjects           []SubjectConfig `yaml:"subjects"`
+    } `yaml:"storage"`
     Log struct {
         Level string `yaml:"level"`
     } `yaml:"log"`
+    // Metrics are served over HTTP at /metrics when Port is set.
+    Metrics struct {
+        Port int `yaml:"port"`
+    } `yaml:"metrics"`
+    // LagAlerts publishes an event when a durable consumer falls behind by
+    // more than MaxPending events or MaxLag.
+    LagAlerts struct {
+        Interval   time.Duration `yaml:"interval"`
+        MaxPending uint64        `yaml:"max_pending"`
+        MaxLag     time.Duration `yaml:"max_lag"`
+        Subject    string        `yaml:"subject"`
+    } `yaml:"lag_alerts"`
+}
+
+// SubjectConfig selects the subjects whose messages are persisted and
+// how long they are retained. Subject may be a pattern where "*" matches
+// one token and a trailing ">" the rest; the first matching entry wins.
+type SubjectConfig struct {
+    Subject            string        `yaml:"subject"`
+    Compact            bool          `yaml:"compact"`
+    TombstoneRetention time.Duration `yaml:"tombstone_retention"`
+    MaxAge             time.Duration `yaml:"max_age"`
+    MaxMessages        int           `yaml:"max_messages"`
+    MaxBytes           int64         `yaml:"max_bytes"`
+    // Discard is "old" (default) to drop the oldest messages when a limit
+    // is reached or "new" to reject publishes.
+    Discard string `yaml:"discard"`
 }
 
 func Load(path string) (*Config, error) {
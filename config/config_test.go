@@ -14,8 +14,34 @@ func TestLoadConfig(t *testing.T) {
 grpc:
   port: 50051
   shutdown_timeout: 10s
+  heartbeat_interval: 15s
+  send_timeout: 45s
+bus:
+  queue_size: 500
+  worker_pool: true
+  workers: 8
+  dedup:
+    window: 1m
+    max_entries: 1000
+storage:
+  dir: /var/lib/pubsub
+  compaction_interval: 5m
+  subjects:
+    - subject: users.state
+      compact: true
+      tombstone_retention: 1h
+    - subject: logs.>
+      max_age: 72h
+      max_messages: 10000
+      max_bytes: 1048576
+      discard: new
 log:
   level: debug
+metrics:
+  port: 9090
+lag_alerts:
+  max_pending: 500
+  max_lag: 2m
 `
     tmpfile, err := os.CreateTemp("", "config_test.yaml")
     require.NoError(t, err)
@@ -30,7 +56,28 @@ log:
 
     assert.Equal(t, 50051, cfg.GRPC.Port)
     assert.Equal(t, 10*time.Second, cfg.GRPC.ShutdownTimeout)
+    assert.Equal(t, 15*time.Second, cfg.GRPC.HeartbeatInterval)
+    assert.Equal(t, 45*time.Second, cfg.GRPC.SendTimeout)
+    assert.Equal(t, 500, cfg.Bus.QueueSize)
+    assert.True(t, cfg.Bus.WorkerPool)
+    assert.Equal(t, 8, cfg.Bus.Workers)
+    assert.Equal(t, time.Minute, cfg.Bus.Dedup.Window)
+    assert.Equal(t, 1000, cfg.Bus.Dedup.MaxEntries)
+    assert.Equal(t, "/var/lib/pubsub", cfg.Storage.Dir)
+    assert.Equal(t, 5*time.Minute, cfg.Storage.CompactionInterval)
+    require.Len(t, cfg.Storage.Subjects, 2)
+    assert.Equal(t, SubjectConfig{Subject: "users.state", Compact: true, TombstoneRetention: time.Hour}, cfg.Storage.Subjects[0])
+    assert.Equal(t, SubjectConfig{
+        Subject:     "logs.>",
+        MaxAge:      72 * time.Hour,
+        MaxMessages: 10000,
+        MaxBytes:    1 << 20,
+        Discard:     "new",
+    }, cfg.Storage.Subjects[1])
     assert.Equal(t, "debug", cfg.Log.Level)
+    assert.Equal(t, 9090, cfg.Metrics.Port)
+    assert.Equal(t, uint64(500), cfg.LagAlerts.MaxPending)
+    assert.Equal(t, 2*time.Minute, cfg.LagAlerts.MaxLag)
 }
 
 func TestLoadConfig_FileNotExists(t *testing.T) {
@@ -0,0 +1,118 @@
+// Package metrics exposes server metrics in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector reports current values to w each time metrics are scraped.
+type Collector func(w *Writer)
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	w := &Writer{families: make(map[string]*family)}
+	for _, c := range collectors {
+		c(w)
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.writeTo(rw)
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+type family struct {
+	help, kind string
+	samples    []sample
+}
+
+// Writer collects samples grouped by metric name.
+type Writer struct {
+	families map[string]*family
+}
+
+// Gauge records a value that can go up and down. labels are name, value
+// pairs.
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.add(name, help, "gauge", value, labels)
+}
+
+// Counter records a value that only increases.
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.add(name, help, "counter", value, labels)
+}
+
+func (w *Writer) add(name, help, kind string, value float64, labels []string) {
+	f, ok := w.families[name]
+	if !ok {
+		f = &family{help: help, kind: kind}
+		w.families[name] = f
+	}
+	f.samples = append(f.samples, sample{labels: formatLabels(labels), value: value})
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (w *Writer) writeTo(out io.Writer) {
+	names := make([]string, 0, len(w.families))
+	for name := range w.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := w.families[name]
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		for _, s := range f.samples {
+			fmt.Fprintf(out, "%s%s %s\n", name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+}
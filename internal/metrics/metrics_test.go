@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(func(w *Writer) {
+		w.Counter("pubsub_published_total", "Published events.", 42)
+		w.Gauge("pubsub_consumer_pending", "Pending events.", 3, "consumer", "billing", "subject", `a"b`)
+		w.Gauge("pubsub_consumer_pending", "Pending events.", 0, "consumer", "audit", "subject", "orders")
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `# HELP pubsub_consumer_pending Pending events.
+# TYPE pubsub_consumer_pending gauge
+pubsub_consumer_pending{consumer="billing",subject="a\"b"} 3
+pubsub_consumer_pending{consumer="audit",subject="orders"} 0
+# HELP pubsub_published_total Published events.
+# TYPE pubsub_published_total counter
+pubsub_published_total 42
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
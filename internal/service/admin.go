@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+// AdminService implements the Admin API. The store may be nil when no
+// subject is persisted.
+type AdminService struct {
+	pb.UnimplementedAdminServer
+	bus   subpub.SubPub
+	store *store.Store
+}
+
+func NewAdminService(bus subpub.SubPub, st *store.Store) *AdminService {
+	return &AdminService{bus: bus, store: st}
+}
+
+func (s *AdminService) Register(server *grpc.Server) {
+	pb.RegisterAdminServer(server, s)
+	log.Info().Msg("Admin service registered")
+}
+
+func (s *AdminService) ListSubjects(ctx context.Context, req *pb.ListSubjectsRequest) (*pb.ListSubjectsResponse, error) {
+	resp := &pb.ListSubjectsResponse{}
+	if s.store == nil {
+		return resp, nil
+	}
+	for _, info := range s.store.Subjects() {
+		resp.Subjects = append(resp.Subjects, &pb.SubjectInfo{
+			Subject:       info.Subject,
+			Retention:     retentionPolicy(info.Config),
+			FirstSequence: info.FirstSeq,
+			LastSequence:  info.LastSeq,
+			Messages:      uint64(info.Messages),
+			Bytes:         uint64(info.Bytes),
+			Segments:      uint32(info.Segments),
+		})
+	}
+	return resp, nil
+}
+
+func retentionPolicy(cfg store.SubjectConfig) *pb.RetentionPolicy {
+	policy := &pb.RetentionPolicy{
+		Pattern:     cfg.Subject,
+		Compact:     cfg.Compact,
+		MaxMessages: uint64(cfg.MaxMessages),
+		MaxBytes:    uint64(cfg.MaxBytes),
+		Discard:     pb.DiscardPolicy_DISCARD_OLD,
+	}
+	if cfg.TombstoneRetention > 0 {
+		policy.TombstoneRetention = durationpb.New(cfg.TombstoneRetention)
+	}
+	if cfg.MaxAge > 0 {
+		policy.MaxAge = durationpb.New(cfg.MaxAge)
+	}
+	if cfg.Discard == store.DiscardNew {
+		policy.Discard = pb.DiscardPolicy_DISCARD_NEW
+	}
+	return policy
+}
+
+func (s *AdminService) GetStats(ctx context.Context, req *pb.GetStatsRequest) (*pb.Stats, error) {
+	stats := s.bus.Stats()
+	return &pb.Stats{
+		Subjects:      uint32(stats.Subjects),
+		Subscriptions: uint32(stats.Subscriptions),
+		Published:     stats.Published,
+		Enqueued:      stats.Enqueued,
+		Dropped:       stats.Dropped,
+		Duplicates:    stats.Duplicates,
+	}, nil
+}
+
+func (s *AdminService) consumerInfo(c store.Consumer) *pb.ConsumerInfo {
+	info := &pb.ConsumerInfo{
+		Name:        c.Name,
+		Subject:     c.Subject,
+		AckSequence: c.AckSeq,
+		Updated:     timestamppb.New(c.Updated),
+	}
+	// The subject of a consumer may no longer be persisted; it has no lag
+	// then.
+	if lag, err := s.store.ConsumerLag(c); err == nil {
+		info.Pending = lag.Pending
+		if !lag.Oldest.IsZero() {
+			info.Lag = durationpb.New(time.Since(lag.Oldest))
+		}
+	}
+	return info
+}
+
+func (s *AdminService) ListConsumers(ctx context.Context, req *pb.ListConsumersRequest) (*pb.ListConsumersResponse, error) {
+	resp := &pb.ListConsumersResponse{}
+	if s.store == nil {
+		return resp, nil
+	}
+	for _, c := range s.store.Consumers() {
+		if req.GetSubject() == "" || req.GetSubject() == c.Subject {
+			resp.Consumers = append(resp.Consumers, s.consumerInfo(c))
+		}
+	}
+	return resp, nil
+}
+
+func (s *AdminService) ResetConsumer(ctx context.Context, req *pb.ResetConsumerRequest) (*pb.ConsumerInfo, error) {
+	if req.GetConsumer() == "" || req.GetSubject() == "" {
+		return nil, status.Error(codes.InvalidArgument, "consumer and subject are required")
+	}
+	if s.store == nil {
+		return nil, status.Error(codes.NotFound, store.ErrConsumerNotFound.Error())
+	}
+
+	var (
+		c   store.Consumer
+		err error
+	)
+	switch pos := req.GetPosition().(type) {
+	case *pb.ResetConsumerRequest_Sequence:
+		c, err = s.store.ResetConsumer(req.GetConsumer(), req.GetSubject(), pos.Sequence)
+	case *pb.ResetConsumerRequest_Time:
+		c, err = s.store.ResetConsumerToTime(req.GetConsumer(), req.GetSubject(), pos.Time.AsTime())
+	default:
+		return nil, status.Error(codes.InvalidArgument, "sequence or time is required")
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	log.Info().Str("consumer", c.Name).Str("subject", c.Subject).Uint64("ack_sequence", c.AckSeq).Msg("Consumer reset")
+	return s.consumerInfo(c), nil
+}
+
+func (s *AdminService) DeleteConsumer(ctx context.Context, req *pb.DeleteConsumerRequest) (*emptypb.Empty, error) {
+	if s.store == nil {
+		return nil, status.Error(codes.NotFound, store.ErrConsumerNotFound.Error())
+	}
+	if err := s.store.DeleteConsumer(req.GetConsumer(), req.GetSubject()); err != nil {
+		return nil, storeError(err)
+	}
+
+	log.Info().Str("consumer", req.GetConsumer()).Str("subject", req.GetSubject()).Msg("Consumer deleted")
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminListSubjects(t *testing.T) {
+	st, err := store.Open(store.Options{
+		Dir: t.TempDir(),
+		Subjects: []store.SubjectConfig{
+			{Subject: "jobs.*", MaxMessages: 2, Discard: store.DiscardNew},
+			{Subject: "logs", MaxAge: time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	bus := subpub.NewSubPub(subpub.WithStore(st))
+	defer bus.Close(context.Background())
+	service := NewPubSubService(bus)
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.Publish(context.Background(), &pb.PublishRequest{Key: "jobs.email", Data: "job"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = service.Publish(context.Background(), &pb.PublishRequest{Key: "jobs.email", Data: "job"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted for a full subject, got %v", err)
+	}
+
+	admin := NewAdminService(bus, st)
+	resp, err := admin.ListSubjects(context.Background(), &pb.ListSubjectsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Subjects) != 1 {
+		t.Fatalf("Expected one subject, got %+v", resp.Subjects)
+	}
+	info := resp.Subjects[0]
+	if info.Subject != "jobs.email" || info.Messages != 2 || info.LastSequence != 2 {
+		t.Errorf("Unexpected subject info %+v", info)
+	}
+	if p := info.Retention; p.Pattern != "jobs.*" || p.MaxMessages != 2 || p.Discard != pb.DiscardPolicy_DISCARD_NEW {
+		t.Errorf("Unexpected retention policy %+v", p)
+	}
+
+	stats, err := admin.GetStats(context.Background(), &pb.GetStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Published != 2 {
+		t.Errorf("Expected 2 published events, got %d", stats.Published)
+	}
+}
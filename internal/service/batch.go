@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+const (
+	// maxBatchSize bounds the number of events of one PublishBatch call.
+	maxBatchSize = 1000
+	// streamBatch bounds how many events of a PublishStream are handed to
+	// the bus at once.
+	streamBatch = 256
+)
+
+func (s *PubSubService) PublishBatch(ctx context.Context, req *pb.PublishBatchRequest) (*pb.PublishBatchResponse, error) {
+	msgs := req.GetMessages()
+	if len(msgs) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "messages are required")
+	}
+	if len(msgs) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "a batch must not exceed %d messages", maxBatchSize)
+	}
+	for i, m := range msgs {
+		if err := checkPublish(m); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "message %d: %s", i, status.Convert(err).Message())
+		}
+	}
+
+	publishCtx, opts, cancel := s.batchOptions(ctx, req.GetWaitForDelivery(), req.GetBlock())
+	defer cancel()
+
+	resp := &pb.PublishBatchResponse{Results: make([]*pb.PublishResponse, 0, len(msgs))}
+	if req.GetAtomic() {
+		reports, err := s.bus.PublishBatch(publishCtx, batchMessages(msgs), opts...)
+		if err != nil {
+			return nil, publishError(ctx, publishCtx, err)
+		}
+		for _, report := range reports {
+			resp.Results = append(resp.Results, publishResponse(report))
+		}
+		log.Info().Int("messages", len(msgs)).Msg("Published atomic batch")
+		return resp, nil
+	}
+
+	reports, errs := s.bus.PublishEach(publishCtx, batchMessages(msgs), opts...)
+	for i, report := range reports {
+		if errs[i] != nil {
+			resp.Results = append(resp.Results, &pb.PublishResponse{})
+			resp.Errors = append(resp.Errors, publishFailure(ctx, publishCtx, i, errs[i]))
+			continue
+		}
+		resp.Results = append(resp.Results, publishResponse(report))
+	}
+	log.Info().Int("messages", len(msgs)).Int("failed", len(resp.Errors)).Msg("Published batch")
+	return resp, nil
+}
+
+// PublishStream publishes events as they arrive. Events already received
+// are handed to the bus together; consecutive events with the same
+// wait_for_delivery and block flags share a batch.
+func (s *PubSubService) PublishStream(stream pb.PubSub_PublishStreamServer) error {
+	ctx := stream.Context()
+
+	type received struct {
+		req *pb.PublishRequest
+		err error
+	}
+	in := make(chan received, streamBatch)
+	go func() {
+		defer close(in)
+		for {
+			req, err := stream.Recv()
+			select {
+			case in <- received{req, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	resp := &pb.PublishStreamResponse{}
+	var (
+		batch []*pb.PublishRequest
+		index int
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		first := batch[0]
+		publishCtx, opts, cancel := s.batchOptions(ctx, first.GetWaitForDelivery(), first.GetBlock())
+		reports, errs := s.bus.PublishEach(publishCtx, batchMessages(batch), opts...)
+		for i, report := range reports {
+			switch {
+			case errs[i] != nil:
+				resp.Errors = append(resp.Errors, publishFailure(ctx, publishCtx, index+i, errs[i]))
+			case report.Duplicate:
+				resp.Duplicates++
+			default:
+				resp.Published++
+			}
+		}
+		cancel()
+		index += len(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		// Events flushed so far are published; the client learns from
+		// the status that the rest were not.
+		var (
+			r  received
+			ok bool
+		)
+		select {
+		case r, ok = <-in:
+		case <-s.closing.Done():
+			return errShuttingDown
+		}
+		if !ok {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		// Collect what has arrived meanwhile without waiting for more.
+		for more := true; more; {
+			if r.err == io.EOF {
+				flush()
+				log.Info().Uint64("published", resp.Published).Int("failed", len(resp.Errors)).Msg("Publish stream closed")
+				return stream.SendAndClose(resp)
+			}
+			if r.err != nil {
+				return r.err
+			}
+
+			req := r.req
+			if err := checkPublish(req); err != nil {
+				return status.Errorf(codes.InvalidArgument, "message %d: %s", index+len(batch), status.Convert(err).Message())
+			}
+			if len(batch) > 0 && (req.GetWaitForDelivery() != batch[0].GetWaitForDelivery() || req.GetBlock() != batch[0].GetBlock()) {
+				flush()
+			}
+			batch = append(batch, req)
+			if len(batch) == streamBatch {
+				flush()
+			}
+
+			select {
+			case r, more = <-in:
+				if !more {
+					return status.FromContextError(ctx.Err()).Err()
+				}
+			default:
+				more = false
+			}
+		}
+		flush()
+	}
+}
+
+// batchOptions returns the publish context and options for a batch. The
+// context is bounded by the publish timeout when block is set.
+func (s *PubSubService) batchOptions(ctx context.Context, wait, block bool) (context.Context, []subpub.PublishOption, context.CancelFunc) {
+	var opts []subpub.PublishOption
+	if wait {
+		opts = append(opts, subpub.WaitForHandlers())
+	}
+	if !block {
+		return ctx, opts, func() {}
+	}
+	opts = append(opts, subpub.BlockWhenFull())
+	if s.publishTimeout <= 0 {
+		return ctx, opts, func() {}
+	}
+	publishCtx, cancel := context.WithTimeout(ctx, s.publishTimeout)
+	return publishCtx, opts, cancel
+}
+
+func batchMessages(msgs []*pb.PublishRequest) []subpub.BatchMessage {
+	batch := make([]subpub.BatchMessage, len(msgs))
+	for i, m := range msgs {
+		batch[i] = subpub.BatchMessage{Subject: m.GetKey(), Msg: publishMessage(m), ID: m.GetMessageId()}
+	}
+	return batch
+}
+
+func publishFailure(ctx, publishCtx context.Context, index int, err error) *pb.PublishError {
+	st := status.Convert(publishError(ctx, publishCtx, err))
+	return &pb.PublishError{Index: uint32(index), Code: int32(st.Code()), Message: st.Message()}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPublishBatchAtomic(t *testing.T) {
+	st := openTestStore(t,
+		store.SubjectConfig{Subject: "order.created"},
+		store.SubjectConfig{Subject: "inventory.reserved", MaxMessages: 1, Discard: store.DiscardNew},
+	)
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	orders := subscribe(t, client, &pb.SubscribeRequest{Key: "order.created"})
+
+	resp, err := client.PublishBatch(context.Background(), &pb.PublishBatchRequest{
+		Atomic: true,
+		Messages: []*pb.PublishRequest{
+			{Key: "order.created", Data: "order-1"},
+			{Key: "inventory.reserved", Data: "sku-1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].Sequence != 1 || resp.Results[1].Sequence != 1 || resp.Results[0].Enqueued != 1 {
+		t.Fatalf("Unexpected results: %+v", resp.Results)
+	}
+	if event := receive(t, orders, 1)[0]; event.Data != "order-1" {
+		t.Errorf("Expected order-1, got %q", event.Data)
+	}
+
+	// inventory.reserved is full, so the order must not be published
+	// either.
+	_, err = client.PublishBatch(context.Background(), &pb.PublishBatchRequest{
+		Atomic: true,
+		Messages: []*pb.PublishRequest{
+			{Key: "order.created", Data: "order-2"},
+			{Key: "inventory.reserved", Data: "sku-2"},
+		},
+	})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+	if last, _ := st.LastSeq("order.created"); last != 1 {
+		t.Errorf("Expected the failed batch to leave order.created at 1, got %d", last)
+	}
+
+	publish(t, client, "order.created", "order-3")
+	if event := receive(t, orders, 1)[0]; event.Data != "order-3" || event.Sequence != 2 {
+		t.Errorf("Expected order-3 at sequence 2, got %q at %d", event.Data, event.Sequence)
+	}
+}
+
+func TestPublishBatchNonAtomic(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs", MaxMessages: 1, Discard: store.DiscardNew})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	resp, err := client.PublishBatch(context.Background(), &pb.PublishBatchRequest{
+		Messages: []*pb.PublishRequest{
+			{Key: "jobs", Data: "one"},
+			{Key: "jobs", Data: "two"},
+			{Key: "events", Data: "three"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 3 || resp.Results[0].Sequence != 1 {
+		t.Fatalf("Unexpected results: %+v", resp.Results)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Index != 1 || codes.Code(resp.Errors[0].Code) != codes.ResourceExhausted {
+		t.Errorf("Expected the second message to fail with ResourceExhausted, got %+v", resp.Errors)
+	}
+
+	_, err = client.PublishBatch(context.Background(), &pb.PublishBatchRequest{
+		Messages: []*pb.PublishRequest{{Key: ""}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a missing key, got %v", err)
+	}
+}
+
+func TestPublishStream(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs", MaxMessages: 4, Discard: store.DiscardNew})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st), subpub.WithDeduplication(time.Minute, 100)), WithStore(st)))
+
+	events := subscribe(t, client, &pb.SubscribeRequest{Key: "events"})
+
+	stream, err := client.PublishStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if err := stream.Send(&pb.PublishRequest{Key: "events", Data: fmt.Sprint(i), Block: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := stream.Send(&pb.PublishRequest{Key: "jobs", Data: fmt.Sprint(i), MessageId: "job"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := stream.Send(&pb.PublishRequest{Key: "jobs", Data: fmt.Sprint(i), MessageId: fmt.Sprint("job-", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Published != 504 || resp.Duplicates != 3 {
+		t.Errorf("Expected 504 published and 3 duplicates, got %+v", resp)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Index != 507 || codes.Code(resp.Errors[0].Code) != codes.ResourceExhausted {
+		t.Errorf("Expected the last job to fail, got %+v", resp.Errors)
+	}
+
+	for i, event := range receive(t, events, 500) {
+		if event.Data != fmt.Sprint(i) {
+			t.Fatalf("Expected event %d, got %q", i, event.Data)
+		}
+	}
+}
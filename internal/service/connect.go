@@ -0,0 +1,504 @@
+package service
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+const (
+	// maxConnectionSubscriptions bounds the subscriptions of one Connect
+	// stream.
+	maxConnectionSubscriptions = 10000
+	// maxHeldEvents bounds the events a paused live subscription queues;
+	// the next event ends the subscription with ResourceExhausted.
+	maxHeldEvents = 1000
+)
+
+// gate holds back the events of a paused subscription. Stored
+// subscriptions wait for it in their own goroutine, while live ones queue
+// their events in held, so that a paused subscription does not occupy a
+// delivery worker of the bus.
+type gate struct {
+	mu     sync.Mutex
+	resume chan struct{}
+	// held are the events to send once the subscription resumed; flushing
+	// is set while they are sent, so that newer events queue behind them.
+	held     []*pb.Event
+	flushing bool
+}
+
+func (g *gate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume == nil {
+		g.resume = make(chan struct{})
+	}
+}
+
+// unpause opens the gate and reports whether held events have to be
+// flushed by the caller.
+func (g *gate) unpause() (flush bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume != nil {
+		close(g.resume)
+		g.resume = nil
+	}
+	if len(g.held) == 0 || g.flushing {
+		return false
+	}
+	g.flushing = true
+	return true
+}
+
+// wait returns once the gate is open or ctx ends.
+func (g *gate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resume := g.resume
+	g.mu.Unlock()
+	if resume == nil {
+		return nil
+	}
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hold queues event if it must not be sent right away and reports whether
+// it did. full reports that the event had to be queued but maxHeldEvents
+// are held already.
+func (g *gate) hold(event *pb.Event) (held, full bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume == nil && !g.flushing {
+		return false, false
+	}
+	if len(g.held) >= maxHeldEvents {
+		return false, true
+	}
+	g.held = append(g.held, event)
+	return true, false
+}
+
+// size returns the number of held events.
+func (g *gate) size() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.held)
+}
+
+// next returns the next held event to flush, unless there is none or the
+// gate was closed again.
+func (g *gate) next() (*pb.Event, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.held) == 0 || g.resume != nil {
+		g.flushing = false
+		if len(g.held) == 0 {
+			g.held = nil
+		}
+		return nil, false
+	}
+	event := g.held[0]
+	g.held[0] = nil
+	g.held = g.held[1:]
+	return event, true
+}
+
+// connSub is a subscription of a Connect stream.
+type connSub struct {
+	req  *pb.SubscribeRequest
+	ctx  context.Context
+	gate gate
+	// stop ends the subscription.
+	stop func()
+	k    *keepalive
+}
+
+// connection is the server side of a Connect stream.
+type connection struct {
+	s      *PubSubService
+	stream pb.PubSub_ConnectServer
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stalled is set when the connection ended because the client
+	// stopped reading.
+	stalled atomic.Bool
+
+	// gRPC streams do not allow concurrent Send calls.
+	sendMu sync.Mutex
+
+	mu   sync.Mutex
+	subs map[string]*connSub
+	wg   sync.WaitGroup
+}
+
+func (s *PubSubService) Connect(stream pb.PubSub_ConnectServer) error {
+	if s.draining.Load() {
+		return errShuttingDown
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	c := &connection{
+		s:      s,
+		stream: stream,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]*connSub),
+	}
+	defer c.close()
+
+	// Commands are received in the background so that the connection
+	// ends as soon as its context does, e.g. when a send stalls.
+	type received struct {
+		frame *pb.ClientFrame
+		err   error
+	}
+	in := make(chan received)
+	go func() {
+		for {
+			frame, err := stream.Recv()
+			select {
+			case in <- received{frame, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	log.Info().Msg("New connection")
+	for {
+		var r received
+		select {
+		case r = <-in:
+		case <-ctx.Done():
+			if c.stalled.Load() {
+				return errStalled
+			}
+			return nil
+		case <-s.closing.Done():
+			return c.shutdown()
+		}
+		frame, err := r.frame, r.err
+		if err == io.EOF || stream.Context().Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch cmd := frame.GetCommand().(type) {
+		case *pb.ClientFrame_Subscribe:
+			c.subscribe(cmd.Subscribe)
+		case *pb.ClientFrame_Unsubscribe:
+			c.unsubscribe(cmd.Unsubscribe.GetId())
+		case *pb.ClientFrame_Ack:
+			c.ack(cmd.Ack)
+		case *pb.ClientFrame_Pause:
+			if sub := c.lookup(cmd.Pause.GetId()); sub != nil {
+				sub.gate.pause()
+			}
+		case *pb.ClientFrame_Resume:
+			if sub := c.lookup(cmd.Resume.GetId()); sub != nil {
+				c.resume(sub)
+			}
+		default:
+			c.fail("", status.Error(codes.InvalidArgument, "unknown command"), false)
+		}
+	}
+}
+
+func (c *connection) subscribe(cmd *pb.SubscribeCommand) {
+	id, req := cmd.GetId(), cmd.GetRequest()
+	if id == "" {
+		c.fail("", status.Error(codes.InvalidArgument, "subscription id is required"), false)
+		return
+	}
+	if c.s.draining.Load() {
+		c.fail(id, errShuttingDown, true)
+		return
+	}
+	f, err := c.s.checkSubscribe(req)
+	if err == nil && req.GetConsumer() != "" && c.s.store == nil {
+		// Rejected before the subscription is registered, so that it can
+		// not be acknowledged meanwhile.
+		err = errNoStorage
+	}
+	if err != nil {
+		c.fail(id, err, true)
+		return
+	}
+
+	c.mu.Lock()
+	if _, ok := c.subs[id]; ok {
+		c.mu.Unlock()
+		c.fail(id, status.Error(codes.AlreadyExists, "subscription id is in use"), false)
+		return
+	}
+	if len(c.subs) >= maxConnectionSubscriptions {
+		c.mu.Unlock()
+		c.fail(id, status.Errorf(codes.ResourceExhausted, "a connection must not exceed %d subscriptions", maxConnectionSubscriptions), true)
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	k := c.s.newKeepalive(req, func(event *pb.Event) error {
+		return c.sendEvent(id, event)
+	})
+	sub := &connSub{req: req, ctx: ctx, stop: cancel, k: k}
+	c.subs[id] = sub
+	c.mu.Unlock()
+
+	if req.GetConsumer() != "" || req.GetResumeToken() != "" || req.GetStartSequence() > 0 {
+		subscribeStored := c.s.subscribeDurable
+		if req.GetConsumer() == "" {
+			subscribeStored = c.s.subscribeReplay
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			started := func(start uint64) error {
+				k.next.Store(start)
+				err := c.subscribed(id, start)
+				go k.run(ctx, c.stall)
+				return err
+			}
+			err := subscribeStored(ctx, req, f, started, func(event *pb.Event) error {
+				if err := sub.gate.wait(ctx); err != nil {
+					return err
+				}
+				return k.Send(event)
+			})
+			if c.remove(id, sub) && err != nil {
+				c.fail(id, err, true)
+			}
+		}()
+		return
+	}
+
+	// Events wait for the subscribed frame, which has to come first.
+	ready := make(chan struct{})
+	busSub, err := c.s.subscribeBus(req, f, func(event *pb.Event) error {
+		<-ready
+		// The events of a paused subscription are sent by resume; those
+		// of a subscription that ends while paused are dropped.
+		held, full := sub.gate.hold(event)
+		if full {
+			c.s.heldDropped.Add(1)
+			c.overflow(id, sub)
+			return nil
+		}
+		if held {
+			return nil
+		}
+		return k.Send(event)
+	}, c.cancel)
+	if err != nil {
+		c.remove(id, sub)
+		c.fail(id, err, true)
+		return
+	}
+	sub.stop = func() {
+		cancel()
+		busSub.Unsubscribe()
+	}
+	start := c.s.startSequence(req.GetKey())
+	k.next.Store(start)
+	c.subscribed(id, start)
+	close(ready)
+	go k.run(ctx, c.stall)
+}
+
+func (c *connection) unsubscribe(id string) {
+	c.mu.Lock()
+	sub, ok := c.subs[id]
+	delete(c.subs, id)
+	c.mu.Unlock()
+
+	if !ok {
+		c.fail(id, status.Error(codes.NotFound, "unknown subscription"), true)
+		return
+	}
+	sub.stop()
+}
+
+// resume opens the gate of sub and sends the events it held meanwhile in
+// the background.
+func (c *connection) resume(sub *connSub) {
+	if !sub.gate.unpause() {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for sub.ctx.Err() == nil {
+			event, ok := sub.gate.next()
+			if !ok {
+				return
+			}
+			if err := sub.k.Send(event); err != nil {
+				log.Error().Err(err).Msg("Failed to send event")
+				c.cancel()
+				return
+			}
+		}
+	}()
+}
+
+// overflow ends the paused subscription id, which has more events than it
+// may hold. Its held events are dropped.
+func (c *connection) overflow(id string, sub *connSub) {
+	if !c.remove(id, sub) {
+		return
+	}
+	sub.stop()
+	c.s.heldDropped.Add(uint64(sub.gate.size()))
+	log.Warn().Str("key", sub.req.GetKey()).Msg("Paused subscription overflowed, closing it")
+	c.fail(id, status.Errorf(codes.ResourceExhausted, "paused subscription must not hold more than %d events", maxHeldEvents), true)
+}
+
+func (c *connection) ack(cmd *pb.AckCommand) {
+	sub := c.lookup(cmd.GetId())
+	if sub == nil {
+		return
+	}
+	if !sub.req.GetManualAck() {
+		c.fail(cmd.GetId(), status.Error(codes.FailedPrecondition, "subscription does not use manual_ack"), false)
+		return
+	}
+	if c.s.store == nil {
+		c.fail(cmd.GetId(), errNoStorage, false)
+		return
+	}
+	if err := c.s.store.Ack(sub.req.GetConsumer(), sub.req.GetKey(), cmd.GetSequence()); err != nil {
+		c.fail(cmd.GetId(), storeError(err), false)
+	}
+}
+
+// lookup returns the subscription id or reports that it does not exist.
+func (c *connection) lookup(id string) *connSub {
+	c.mu.Lock()
+	sub, ok := c.subs[id]
+	c.mu.Unlock()
+
+	if !ok {
+		c.fail(id, status.Error(codes.NotFound, "unknown subscription"), true)
+		return nil
+	}
+	return sub
+}
+
+// remove forgets sub unless its ID was taken over already and reports
+// whether it did.
+func (c *connection) remove(id string, sub *connSub) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subs[id] != sub {
+		return false
+	}
+	delete(c.subs, id)
+	return true
+}
+
+// stall ends the connection of a client that stopped reading.
+func (c *connection) stall() {
+	c.stalled.Store(true)
+	c.cancel()
+}
+
+func (c *connection) close() {
+	c.cancel()
+
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.stop()
+	}
+	c.wg.Wait()
+}
+
+// shutdown ends all subscriptions, sends each a shutdown frame with its
+// resume token and ends the connection.
+func (c *connection) shutdown() error {
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.stop()
+	}
+	c.wg.Wait()
+	for id, sub := range subs {
+		// Waiting for a send in progress keeps events from following the
+		// shutdown frame.
+		sub.k.mu.Lock()
+		sub.k.close()
+		sub.k.mu.Unlock()
+		c.send(&pb.ServerFrame{
+			SubscriptionId: id,
+			Frame:          &pb.ServerFrame_Shutdown{Shutdown: shutdownFrame(sub.req, sub.k)},
+		})
+	}
+	return errShuttingDown
+}
+
+func (c *connection) subscribed(id string, start uint64) error {
+	return c.send(&pb.ServerFrame{
+		SubscriptionId: id,
+		Frame: &pb.ServerFrame_Subscribed{Subscribed: &pb.Subscribed{
+			StartSequence: start,
+			ServerTime:    timestamppb.Now(),
+		}},
+	})
+}
+
+func (c *connection) sendEvent(id string, event *pb.Event) error {
+	return c.send(&pb.ServerFrame{SubscriptionId: id, Frame: &pb.ServerFrame_Event{Event: event}})
+}
+
+// fail reports err for the subscription id. closed tells the client that
+// the subscription does not exist (anymore).
+func (c *connection) fail(id string, err error, closed bool) {
+	st := status.Convert(err)
+	c.send(&pb.ServerFrame{
+		SubscriptionId: id,
+		Frame: &pb.ServerFrame_Error{Error: &pb.FrameError{
+			Code:    int32(st.Code()),
+			Message: st.Message(),
+			Closed:  closed,
+		}},
+	})
+}
+
+// send writes frame and ends the connection when the stream is broken.
+func (c *connection) send(frame *pb.ServerFrame) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
+	err := c.stream.Send(frame)
+	if err != nil {
+		c.cancel()
+	}
+	return err
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StepanErshov/pubsub/internal/metrics"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+	"google.golang.org/grpc/codes"
+)
+
+func connect(t *testing.T, client pb.PubSubClient) pb.PubSub_ConnectClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	stream, err := client.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// command sends frame and waits until the server has handled it.
+func command(t *testing.T, stream pb.PubSub_ConnectClient, frame *pb.ClientFrame) {
+	if err := stream.Send(frame); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func subscribeFrame(id string, req *pb.SubscribeRequest) *pb.ClientFrame {
+	return &pb.ClientFrame{Command: &pb.ClientFrame_Subscribe{Subscribe: &pb.SubscribeCommand{Id: id, Request: req}}}
+}
+
+// connSubscribe subscribes and waits for the confirmation.
+func connSubscribe(t *testing.T, stream pb.PubSub_ConnectClient, id string, req *pb.SubscribeRequest) *pb.Subscribed {
+	if err := stream.Send(subscribeFrame(id, req)); err != nil {
+		t.Fatal(err)
+	}
+	frame := recvFrame(t, stream)
+	if frame.SubscriptionId != id || frame.GetSubscribed() == nil {
+		t.Fatalf("Expected subscription %s to be confirmed, got %v", id, frame)
+	}
+	return frame.GetSubscribed()
+}
+
+func recvFrame(t *testing.T, stream pb.PubSub_ConnectClient) *pb.ServerFrame {
+	frame, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestConnectMultiplexes(t *testing.T) {
+	client := startServer(t, NewPubSubService(subpub.NewSubPub()))
+	stream := connect(t, client)
+
+	for i := 0; i < 3; i++ {
+		connSubscribe(t, stream, fmt.Sprint("sub-", i), &pb.SubscribeRequest{Key: fmt.Sprint("key-", i)})
+	}
+
+	for i := 0; i < 3; i++ {
+		publish(t, client, fmt.Sprint("key-", i), fmt.Sprint("event-", i))
+		frame := recvFrame(t, stream)
+		if frame.SubscriptionId != fmt.Sprint("sub-", i) || frame.GetEvent().GetData() != fmt.Sprint("event-", i) {
+			t.Fatalf("Unexpected frame %v", frame)
+		}
+	}
+
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Unsubscribe{Unsubscribe: &pb.UnsubscribeCommand{Id: "sub-0"}}})
+	publish(t, client, "key-0", "dropped")
+	publish(t, client, "key-1", "kept")
+	if frame := recvFrame(t, stream); frame.SubscriptionId != "sub-1" || frame.GetEvent().GetData() != "kept" {
+		t.Errorf("Expected only sub-1 to receive an event, got %v", frame)
+	}
+
+	command(t, stream, subscribeFrame("sub-1", &pb.SubscribeRequest{Key: "other"}))
+	if frame := recvFrame(t, stream); codes.Code(frame.GetError().GetCode()) != codes.AlreadyExists || frame.GetError().GetClosed() {
+		t.Errorf("Expected AlreadyExists for a taken ID, got %v", frame)
+	}
+	command(t, stream, subscribeFrame("bad", &pb.SubscribeRequest{}))
+	if frame := recvFrame(t, stream); frame.SubscriptionId != "bad" || codes.Code(frame.GetError().GetCode()) != codes.InvalidArgument || !frame.GetError().GetClosed() {
+		t.Errorf("Expected InvalidArgument for a missing key, got %v", frame)
+	}
+}
+
+func TestConnectPause(t *testing.T) {
+	client := startServer(t, NewPubSubService(subpub.NewSubPub()))
+	stream := connect(t, client)
+
+	connSubscribe(t, stream, "a", &pb.SubscribeRequest{Key: "a"})
+	connSubscribe(t, stream, "b", &pb.SubscribeRequest{Key: "b"})
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Pause{Pause: &pb.PauseCommand{Id: "a"}}})
+
+	publish(t, client, "a", "held")
+	publish(t, client, "b", "sent")
+	if frame := recvFrame(t, stream); frame.SubscriptionId != "b" {
+		t.Fatalf("Expected the paused subscription to be held back, got %v", frame)
+	}
+
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Resume{Resume: &pb.ResumeCommand{Id: "a"}}})
+	if frame := recvFrame(t, stream); frame.SubscriptionId != "a" || frame.GetEvent().GetData() != "held" {
+		t.Errorf("Expected the held event after resume, got %v", frame)
+	}
+}
+
+func TestConnectPauseWithWorkerPool(t *testing.T) {
+	// A paused subscription must not keep the only worker of the bus.
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithWorkerPool(1))))
+	stream := connect(t, client)
+
+	connSubscribe(t, stream, "a", &pb.SubscribeRequest{Key: "a"})
+	connSubscribe(t, stream, "b", &pb.SubscribeRequest{Key: "b"})
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Pause{Pause: &pb.PauseCommand{Id: "a"}}})
+
+	publish(t, client, "a", "one", "two")
+	for _, want := range []string{"x", "y"} {
+		publish(t, client, "b", want)
+		if frame := recvFrame(t, stream); frame.SubscriptionId != "b" || frame.GetEvent().GetData() != want {
+			t.Fatalf("Expected %s on b, got %v", want, frame)
+		}
+	}
+
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Resume{Resume: &pb.ResumeCommand{Id: "a"}}})
+	publish(t, client, "a", "three")
+	for _, want := range []string{"one", "two", "three"} {
+		if frame := recvFrame(t, stream); frame.SubscriptionId != "a" || frame.GetEvent().GetData() != want {
+			t.Errorf("Expected %s on a in order, got %v", want, frame)
+		}
+	}
+}
+
+func TestConnectPauseOverflow(t *testing.T) {
+	bus := subpub.NewSubPub()
+	svc := NewPubSubService(bus)
+	client := startServer(t, svc)
+	stream := connect(t, client)
+
+	connSubscribe(t, stream, "a", &pb.SubscribeRequest{Key: "a"})
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Pause{Pause: &pb.PauseCommand{Id: "a"}}})
+	// Commands are handled in order, so a is paused once b is confirmed.
+	connSubscribe(t, stream, "b", &pb.SubscribeRequest{Key: "b"})
+
+	for i := 0; i <= maxHeldEvents; i++ {
+		if err := bus.PublishCtx(context.Background(), "a", "held"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frame := recvFrame(t, stream)
+	if frame.SubscriptionId != "a" || codes.Code(frame.GetError().GetCode()) != codes.ResourceExhausted || !frame.GetError().GetClosed() {
+		t.Fatalf("Expected the overflowing subscription to end with ResourceExhausted, got %v", frame)
+	}
+
+	registry := metrics.NewRegistry()
+	registry.Register(svc.CollectMetrics)
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, fmt.Sprintf("pubsub_paused_dropped_total %d", maxHeldEvents+1)) {
+		t.Errorf("Dropped events missing from metrics:\n%s", body)
+	}
+
+	// The connection and its other subscriptions go on.
+	publish(t, client, "b", "sent")
+	if frame := recvFrame(t, stream); frame.SubscriptionId != "b" || frame.GetEvent().GetData() != "sent" {
+		t.Errorf("Expected an event on b, got %v", frame)
+	}
+}
+
+func TestConnectDurableAck(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	stream := connect(t, client)
+
+	publish(t, client, "orders", "before")
+	if start := connSubscribe(t, stream, "orders", &pb.SubscribeRequest{Key: "orders", Consumer: "billing", ManualAck: true}); start.StartSequence != 2 {
+		t.Errorf("Expected the consumer to start at 2, got %d", start.StartSequence)
+	}
+	publish(t, client, "orders", "one", "two")
+
+	frame := recvFrame(t, stream)
+	if frame.SubscriptionId != "orders" || frame.GetEvent().GetSequence() != 2 {
+		t.Fatalf("Unexpected frame %v", frame)
+	}
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Ack{Ack: &pb.AckCommand{Id: "orders", Sequence: 2}}})
+	if c, _ := st.GetConsumer("billing", "orders"); c.AckSeq != 2 {
+		t.Errorf("Expected the consumer at 2, got %d", c.AckSeq)
+	}
+
+	command(t, stream, &pb.ClientFrame{Command: &pb.ClientFrame_Ack{Ack: &pb.AckCommand{Id: "orders", Sequence: 10}}})
+	if frame := recvFrame(t, stream); frame.GetEvent().GetSequence() != 3 {
+		t.Fatalf("Expected the second event, got %v", frame)
+	}
+	if frame := recvFrame(t, stream); codes.Code(frame.GetError().GetCode()) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an ack beyond the end, got %v", frame)
+	}
+}
+
+func TestConnectAckWithoutStorage(t *testing.T) {
+	client := startServer(t, NewPubSubService(subpub.NewSubPub()))
+	stream := connect(t, client)
+
+	// The ack follows right away, before the subscription could fail.
+	if err := stream.Send(subscribeFrame("orders", &pb.SubscribeRequest{Key: "orders", Consumer: "billing", ManualAck: true})); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&pb.ClientFrame{Command: &pb.ClientFrame_Ack{Ack: &pb.AckCommand{Id: "orders", Sequence: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	if frame := recvFrame(t, stream); codes.Code(frame.GetError().GetCode()) != codes.FailedPrecondition || !frame.GetError().GetClosed() {
+		t.Errorf("Expected FailedPrecondition, got %v", frame)
+	}
+	if frame := recvFrame(t, stream); codes.Code(frame.GetError().GetCode()) != codes.NotFound {
+		t.Errorf("Expected the ack of the rejected subscription to fail, got %v", frame)
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/StepanErshov/pubsub/pkg/filter"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+)
+
+const (
+	// durableBatch is how many records a durable subscription reads from
+	// the store at a time.
+	durableBatch = 256
+	// durablePoll bounds how long an idle durable subscription waits
+	// before it checks whether its consumer was reset or deleted.
+	durablePoll = time.Second
+)
+
+// errNoStorage is returned for durable consumers on a server without
+// storage.
+var errNoStorage = status.Error(codes.FailedPrecondition, "durable consumers require storage")
+
+// storeError maps store errors to gRPC status errors.
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotPersisted):
+		return status.Error(codes.FailedPrecondition, "subject is not persisted")
+	case errors.Is(err, store.ErrConsumerNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.ErrInvalidAck):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, store.ErrClosed):
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func recordEvent(rec store.Record) *pb.Event {
+	event := &pb.Event{
+		Headers:    rec.Headers,
+		MessageKey: rec.Key,
+		Tombstone:  rec.Tombstone,
+		Sequence:   rec.Seq,
+	}
+	setPayload(event, rec.Data, rec.ContentType)
+	return event
+}
+
+// subscribeDurable passes the records of a persisted subject to send for a
+// durable consumer, starting after its acknowledged sequence, until ctx
+// ends. started is called with that sequence before the first record. It
+// reads the store rather than the bus, so no event is missed between
+// catching up and following new events.
+func (s *PubSubService) subscribeDurable(ctx context.Context, req *pb.SubscribeRequest, f *filter.Filter, started func(start uint64) error, send func(*pb.Event) error) error {
+	if s.store == nil {
+		return errNoStorage
+	}
+
+	name, key, manual := req.GetConsumer(), req.GetKey(), req.GetManualAck()
+	c, err := s.store.OpenConsumer(name, key)
+	if err != nil {
+		return storeError(err)
+	}
+
+	log.Info().Str("key", key).Str("consumer", name).Uint64("ack_sequence", c.AckSeq).Msg("New durable subscription")
+	if err := started(c.AckSeq + 1); err != nil {
+		return err
+	}
+
+	next, resets := c.AckSeq+1, c.Resets
+	for {
+		recs, err := s.store.Read(key, next, durableBatch)
+		if err != nil {
+			return storeError(err)
+		}
+
+		for _, rec := range recs {
+			next = rec.Seq + 1
+			if f == nil || f.Match(rec.Headers, rec.Data) {
+				if err := send(recordEvent(rec)); err != nil {
+					if ctx.Err() == nil {
+						log.Error().Err(err).Msg("Failed to send event")
+					}
+					return nil
+				}
+			}
+			// Filtered out records are acknowledged too, or a manual
+			// consumer acknowledges them with the next event it gets.
+			if !manual {
+				if err := s.store.Ack(name, key, rec.Seq); err != nil {
+					return storeError(err)
+				}
+			}
+		}
+
+		if len(recs) == 0 {
+			// Retention may have removed the records from next on; the
+			// consumer continues after them.
+			first, err := s.firstRetained(key, next)
+			if err != nil {
+				return storeError(err)
+			}
+			if first > next {
+				next = first
+				if err := s.store.Ack(name, key, next-1); err != nil {
+					return storeError(err)
+				}
+			}
+		}
+
+		c, err := s.store.GetConsumer(name, key)
+		if errors.Is(err, store.ErrConsumerNotFound) {
+			return status.Error(codes.Aborted, "consumer was deleted")
+		}
+		if err != nil {
+			return storeError(err)
+		}
+		if c.Resets != resets {
+			next, resets = c.AckSeq+1, c.Resets
+			continue
+		}
+		if len(recs) == durableBatch {
+			continue
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, durablePoll)
+		err = s.store.Wait(waitCtx, key, next-1)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, store.ErrClosed):
+			return storeError(err)
+		}
+	}
+}
+
+// firstRetained returns the first sequence from next on that retention
+// has not removed, or the one after the last record when it removed all.
+func (s *PubSubService) firstRetained(key string, next uint64) (uint64, error) {
+	info, err := s.store.Info(key)
+	if err != nil {
+		return 0, err
+	}
+	return max(next, info.FirstSeq), nil
+}
+
+func (s *PubSubService) Ack(ctx context.Context, req *pb.AckRequest) (*emptypb.Empty, error) {
+	if req.GetConsumer() == "" || req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "consumer and key are required")
+	}
+	if s.store == nil {
+		return nil, errNoStorage
+	}
+	if err := s.store.Ack(req.GetConsumer(), req.GetKey(), req.GetSequence()); err != nil {
+		return nil, storeError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
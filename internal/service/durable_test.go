@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func openTestStore(t *testing.T, subjects ...store.SubjectConfig) *store.Store {
+	st, err := store.Open(store.Options{Dir: t.TempDir(), Subjects: subjects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func publish(t *testing.T, client pb.PubSubClient, key string, data ...string) {
+	for _, d := range data {
+		if _, err := client.Publish(context.Background(), &pb.PublishRequest{Key: key, Data: d}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func receive(t *testing.T, stream pb.PubSub_SubscribeClient, n int) []*pb.Event {
+	events := make([]*pb.Event, n)
+	for i := range events {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[i] = event
+	}
+	return events
+}
+
+func durableSubscribe(t *testing.T, client pb.PubSubClient, req *pb.SubscribeRequest) (pb.PubSub_SubscribeClient, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stream, err := client.Subscribe(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream, cancel
+}
+
+// waitForConsumer waits until the server has created the consumer, after
+// which it receives every published event.
+func waitForConsumer(t *testing.T, st *store.Store, name, key string) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := st.GetConsumer(name, key); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Consumer %s was not created", name)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDurableConsumerResumes(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	publish(t, client, "orders", "before")
+
+	req := &pb.SubscribeRequest{Key: "orders", Consumer: "billing"}
+	stream, cancel := durableSubscribe(t, client, req)
+	// The first subscribe creates the consumer at the end of the subject.
+	waitForConsumer(t, st, "billing", "orders")
+	publish(t, client, "orders", "one", "two")
+	if events := receive(t, stream, 2); events[0].Data != "one" || events[1].Sequence != 3 {
+		t.Errorf("Unexpected events %v", events)
+	}
+	cancel()
+
+	publish(t, client, "orders", "three")
+	stream, _ = durableSubscribe(t, client, req)
+	if events := receive(t, stream, 1); events[0].Data != "three" || events[0].Sequence != 4 {
+		t.Errorf("Expected to resume after the acknowledged event, got %v", events)
+	}
+}
+
+func TestDurableConsumerManualAck(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	req := &pb.SubscribeRequest{Key: "orders", Consumer: "billing", ManualAck: true}
+	stream, cancel := durableSubscribe(t, client, req)
+	waitForConsumer(t, st, "billing", "orders")
+	publish(t, client, "orders", "one", "two")
+	receive(t, stream, 2)
+
+	if _, err := client.Ack(context.Background(), &pb.AckRequest{Consumer: "billing", Key: "orders", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Ack(context.Background(), &pb.AckRequest{Consumer: "billing", Key: "orders", Sequence: 10})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an ack beyond the subject, got %v", err)
+	}
+	cancel()
+
+	stream, _ = durableSubscribe(t, client, req)
+	if events := receive(t, stream, 1); events[0].Data != "two" {
+		t.Errorf("Expected the unacknowledged event again, got %v", events)
+	}
+}
+
+func TestDurableConsumerAdmin(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	bus := subpub.NewSubPub(subpub.WithStore(st))
+	client := startServer(t, NewPubSubService(bus, WithStore(st)))
+	admin := NewAdminService(bus, st)
+
+	stream, _ := durableSubscribe(t, client, &pb.SubscribeRequest{Key: "orders", Consumer: "billing"})
+	waitForConsumer(t, st, "billing", "orders")
+	publish(t, client, "orders", "one", "two")
+	receive(t, stream, 2)
+
+	list, err := admin.ListConsumers(context.Background(), &pb.ListConsumersRequest{Subject: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Consumers) != 1 || list.Consumers[0].Name != "billing" {
+		t.Fatalf("Unexpected consumers %v", list.Consumers)
+	}
+
+	_, err = admin.ResetConsumer(context.Background(), &pb.ResetConsumerRequest{
+		Consumer: "billing",
+		Subject:  "orders",
+		Position: &pb.ResetConsumerRequest_Sequence{Sequence: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := receive(t, stream, 2); events[0].Data != "one" || events[1].Data != "two" {
+		t.Errorf("Expected the active stream to replay after reset, got %v", events)
+	}
+
+	if _, err := admin.DeleteConsumer(context.Background(), &pb.DeleteConsumerRequest{Consumer: "billing", Subject: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted after delete, got %v", err)
+	}
+	_, err = admin.DeleteConsumer(context.Background(), &pb.DeleteConsumerRequest{Consumer: "billing", Subject: "orders"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
+
+func TestDurableConsumerRequiresPersistedSubject(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	stream, _ := durableSubscribe(t, client, &pb.SubscribeRequest{Key: "other", Consumer: "billing"})
+	if _, err := stream.Recv(); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition, got %v", err)
+	}
+}
+
+func TestDurableConsumerSkipsExpiredRecords(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders", MaxAge: 50 * time.Millisecond})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	publish(t, client, "orders", "one", "two", "three")
+	time.Sleep(100 * time.Millisecond)
+	if err := st.EnforceRetention("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.OpenConsumer("billing", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ResetConsumer("billing", "orders", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, _ := durableSubscribe(t, client, &pb.SubscribeRequest{Key: "orders", Consumer: "billing"})
+	deadline := time.Now().Add(time.Second)
+	for {
+		if c, _ := st.GetConsumer("billing", "orders"); c.AckSeq == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the consumer to move past the expired records")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	publish(t, client, "orders", "four")
+	if event := receive(t, stream, 1)[0]; event.Sequence != 4 {
+		t.Errorf("Expected sequence 4, got %d", event.Sequence)
+	}
+}
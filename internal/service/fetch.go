@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+)
+
+const (
+	defaultFetchBatch = 100
+	maxFetchBatch     = 1000
+	maxFetchWait      = 5 * time.Minute
+	defaultAckWait    = 30 * time.Second
+)
+
+// pullState tracks what a durable consumer has fetched but not yet
+// acknowledged. It lives in memory only; after a restart unacknowledged
+// events are fetched again.
+type pullState struct {
+	mu        sync.Mutex
+	resets    uint64
+	delivered uint64
+	// fetches are the unacknowledged ranges handed out, oldest first.
+	fetches []pullFetch
+}
+
+// pullFetch is a range of records handed out together: the one ending at
+// last was handed out at at.
+type pullFetch struct {
+	last uint64
+	at   time.Time
+}
+
+type pullKey struct {
+	consumer, key string
+}
+
+type pullStates struct {
+	mu     sync.Mutex
+	states map[pullKey]*pullState
+}
+
+func (p *pullStates) get(consumer, key string) *pullState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.states == nil {
+		p.states = make(map[pullKey]*pullState)
+	}
+	k := pullKey{consumer, key}
+	st, ok := p.states[k]
+	if !ok {
+		st = &pullState{}
+		p.states[k] = st
+	}
+	return st
+}
+
+func (s *PubSubService) Fetch(ctx context.Context, req *pb.FetchRequest) (*pb.FetchResponse, error) {
+	key := req.GetKey()
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	if s.store == nil {
+		return nil, status.Error(codes.FailedPrecondition, "fetch requires storage")
+	}
+
+	limit := int(req.GetMaxMessages())
+	if limit == 0 {
+		limit = defaultFetchBatch
+	}
+	if limit > maxFetchBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "max_messages must not exceed %d", maxFetchBatch)
+	}
+	wait := req.GetMaxWait().AsDuration()
+	if wait < 0 || wait > maxFetchWait {
+		return nil, status.Errorf(codes.InvalidArgument, "max_wait must be between 0 and %s", maxFetchWait)
+	}
+	ackWait := req.GetAckWait().AsDuration()
+	if ackWait <= 0 {
+		ackWait = defaultAckWait
+	}
+
+	fetch := func() ([]store.Record, uint64, error) {
+		return s.fetchFrom(key, req.GetStartSequence(), limit)
+	}
+	if consumer := req.GetConsumer(); consumer != "" {
+		if _, err := s.store.OpenConsumer(consumer, key); err != nil {
+			return nil, storeError(err)
+		}
+		fetch = func() ([]store.Record, uint64, error) {
+			return s.fetchConsumer(consumer, key, limit, ackWait)
+		}
+	}
+
+	// Shutdown ends the wait; what has arrived by then is still returned.
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	defer context.AfterFunc(s.closing, cancel)()
+	for {
+		recs, next, err := fetch()
+		if err != nil {
+			return nil, storeError(err)
+		}
+		if len(recs) == 0 && s.closing.Err() != nil {
+			return nil, errShuttingDown
+		}
+		if len(recs) > 0 || waitCtx.Err() != nil {
+			resp := &pb.FetchResponse{NextSequence: next}
+			for _, rec := range recs {
+				resp.Events = append(resp.Events, recordEvent(rec))
+			}
+			return resp, nil
+		}
+
+		err = s.store.Wait(waitCtx, key, next-1)
+		switch {
+		case ctx.Err() != nil:
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case errors.Is(err, store.ErrClosed):
+			return nil, storeError(err)
+		}
+	}
+}
+
+// fetchFrom reads up to limit records from seq on and returns the
+// sequence after the last one.
+func (s *PubSubService) fetchFrom(key string, seq uint64, limit int) ([]store.Record, uint64, error) {
+	recs, err := s.store.Read(key, seq, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(recs) > 0 {
+		return recs, recs[len(recs)-1].Seq + 1, nil
+	}
+
+	last, err := s.store.LastSeq(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return nil, max(seq, last+1), nil
+}
+
+// fetchConsumer returns the next records of a durable consumer. Records
+// that were fetched but not acknowledged within ackWait are returned
+// again.
+func (s *PubSubService) fetchConsumer(consumer, key string, limit int, ackWait time.Duration) ([]store.Record, uint64, error) {
+	st := s.pulls.get(consumer, key)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	c, err := s.store.GetConsumer(consumer, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if st.resets != c.Resets || st.delivered < c.AckSeq {
+		st.resets, st.delivered, st.fetches = c.Resets, c.AckSeq, nil
+	}
+	for len(st.fetches) > 0 && st.fetches[0].last <= c.AckSeq {
+		st.fetches = st.fetches[1:]
+	}
+	// The oldest fetch holds the first unacknowledged record; it and all
+	// after it are handed out again once it waited for too long.
+	if len(st.fetches) > 0 && time.Since(st.fetches[0].at) > ackWait {
+		st.delivered, st.fetches = c.AckSeq, nil
+	}
+
+	recs, next, err := s.fetchFrom(key, st.delivered+1, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(recs) > 0 {
+		st.delivered = next - 1
+		st.fetches = append(st.fetches, pullFetch{last: st.delivered, at: time.Now()})
+	}
+	return recs, next, nil
+}
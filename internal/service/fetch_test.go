@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestFetchEphemeral(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	publish(t, client, "jobs", "one", "two", "three")
+
+	resp, err := client.Fetch(context.Background(), &pb.FetchRequest{Key: "jobs", StartSequence: 2, MaxMessages: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Data != "two" || resp.NextSequence != 3 {
+		t.Errorf("Unexpected response %v", resp)
+	}
+
+	resp, err = client.Fetch(context.Background(), &pb.FetchRequest{Key: "jobs", StartSequence: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 0 || resp.NextSequence != 4 {
+		t.Errorf("Expected an empty batch, got %v", resp)
+	}
+}
+
+func TestFetchLongPoll(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.Publish(context.Background(), &pb.PublishRequest{Key: "jobs", Data: "late"})
+	}()
+
+	start := time.Now()
+	resp, err := client.Fetch(context.Background(), &pb.FetchRequest{
+		Key:           "jobs",
+		StartSequence: 1,
+		MaxWait:       durationpb.New(5 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Data != "late" {
+		t.Errorf("Unexpected response %v", resp)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Fetch returned after %s instead of on publish", time.Since(start))
+	}
+
+	start = time.Now()
+	resp, err = client.Fetch(context.Background(), &pb.FetchRequest{
+		Key:           "jobs",
+		StartSequence: 2,
+		MaxWait:       durationpb.New(50 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 0 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Expected an empty batch after max_wait, got %v", resp)
+	}
+}
+
+func TestFetchShutdown(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs"})
+	svc := NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st))
+	client := startServer(t, svc)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		svc.Shutdown(context.Background())
+	}()
+
+	start := time.Now()
+	_, err := client.Fetch(context.Background(), &pb.FetchRequest{
+		Key:           "jobs",
+		StartSequence: 1,
+		MaxWait:       durationpb.New(5 * time.Second),
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Fetch returned after %s instead of on shutdown", time.Since(start))
+	}
+}
+
+func TestFetchConsumerAck(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	req := &pb.FetchRequest{Key: "jobs", Consumer: "worker", MaxMessages: 2, AckWait: durationpb.New(100 * time.Millisecond)}
+	if _, err := client.Fetch(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, client, "jobs", "one", "two", "three")
+
+	first, err := client.Fetch(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Fetch(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Events) != 2 || len(second.Events) != 1 || second.Events[0].Data != "three" {
+		t.Fatalf("Expected consecutive batches, got %v and %v", first, second)
+	}
+
+	if _, err := client.Ack(context.Background(), &pb.AckRequest{Consumer: "worker", Key: "jobs", Sequence: 2}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	again, err := client.Fetch(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Events) != 1 || again.Events[0].Sequence != 3 {
+		t.Errorf("Expected the unacknowledged event after ack_wait, got %v", again)
+	}
+}
+
+func TestFetchConsumerRedeliversWhilePolling(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "jobs"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	req := &pb.FetchRequest{Key: "jobs", Consumer: "worker", MaxMessages: 1, AckWait: durationpb.New(200 * time.Millisecond)}
+	if _, err := client.Fetch(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, client, "jobs", "first")
+	if resp, err := client.Fetch(context.Background(), req); err != nil || len(resp.Events) != 1 {
+		t.Fatalf("Expected the first event, got %v, %v", resp, err)
+	}
+
+	// Fetching newer events must not extend the ack_wait of the first.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		publish(t, client, "jobs", "next")
+		resp, err := client.Fetch(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Events) == 1 && resp.Events[0].Sequence == 1 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("Expected the unacknowledged event to be fetched again after ack_wait")
+}
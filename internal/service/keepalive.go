@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// defaultHeartbeat is the heartbeat interval when none is configured.
+const defaultHeartbeat = 30 * time.Second
+
+// errStalled ends the streams of subscribers that stopped reading, so that
+// clients can tell them from streams that ended normally.
+var errStalled = status.Error(codes.DeadlineExceeded, "subscriber stalled")
+
+// keepalive sends the events of one subscription. It sends heartbeats
+// while the subscription is idle and reports when a send has been blocked
+// for longer than the send timeout, e.g. because the client stopped
+// reading.
+type keepalive struct {
+	send      func(*pb.Event) error
+	heartbeat time.Duration
+	timeout   time.Duration
+	// lastSeq returns the last sequence of the subject for heartbeats.
+	lastSeq func() uint64
+
+	mu sync.Mutex
+	// sending is when the send in progress started, zero when there is
+	// none; idle is when the last send finished.
+	sending atomic.Int64
+	idle    atomic.Int64
+	// closed is set when the stream handler returns; gRPC streams must
+	// not be used after that.
+	closed atomic.Bool
+	// next is the sequence of the next event the subscriber expects, zero
+	// while it is unknown.
+	next atomic.Uint64
+}
+
+// newKeepalive wraps send for a subscription to key. Heartbeats are sent
+// only when the subscriber asked for them.
+func (s *PubSubService) newKeepalive(req *pb.SubscribeRequest, send func(*pb.Event) error) *keepalive {
+	k := &keepalive{send: send, timeout: s.sendTimeout}
+	if req.GetHeartbeats() {
+		k.heartbeat = s.heartbeat
+		if k.heartbeat <= 0 {
+			k.heartbeat = defaultHeartbeat
+		}
+	}
+	key := req.GetKey()
+	k.lastSeq = func() uint64 {
+		if s.store == nil {
+			return 0
+		}
+		last, _ := s.store.LastSeq(key)
+		return last
+	}
+	k.idle.Store(time.Now().UnixNano())
+	return k
+}
+
+// Send sends event; concurrent calls are serialized.
+func (k *keepalive) Send(event *pb.Event) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.sendLocked(event)
+}
+
+func (k *keepalive) sendLocked(event *pb.Event) error {
+	if k.closed.Load() {
+		return context.Canceled
+	}
+	k.sending.Store(time.Now().UnixNano())
+	err := k.send(event)
+	k.sending.Store(0)
+	k.idle.Store(time.Now().UnixNano())
+	if err == nil && event.Sequence > 0 {
+		k.next.Store(event.Sequence + 1)
+	}
+	return err
+}
+
+// close makes further sends fail.
+func (k *keepalive) close() {
+	k.closed.Store(true)
+}
+
+// run sends heartbeats and watches sends until ctx ends. It calls stall
+// when a send is blocked for longer than the timeout or a heartbeat
+// cannot be sent.
+func (k *keepalive) run(ctx context.Context, stall func()) {
+	period := k.heartbeat / 2
+	if k.timeout > 0 && (period == 0 || k.timeout/2 < period) {
+		period = k.timeout / 2
+	}
+	if period <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if started := k.sending.Load(); k.timeout > 0 && started != 0 && now.Sub(time.Unix(0, started)) > k.timeout {
+				log.Warn().Dur("timeout", k.timeout).Msg("Subscriber stopped reading, closing stream")
+				stall()
+				return
+			}
+			if k.heartbeat <= 0 || now.Sub(time.Unix(0, k.idle.Load())) < k.heartbeat {
+				continue
+			}
+			// A send in progress makes the heartbeat unnecessary. The
+			// heartbeat is sent in the background so that the watchdog
+			// keeps running if it blocks.
+			if !k.mu.TryLock() {
+				continue
+			}
+			heartbeat := &pb.Event{Heartbeat: &pb.Heartbeat{
+				LastSequence: k.lastSeq(),
+				ServerTime:   timestamppb.New(now),
+			}}
+			go func() {
+				defer k.mu.Unlock()
+				if err := k.sendLocked(heartbeat); err != nil {
+					stall()
+				}
+			}()
+		}
+	}
+}
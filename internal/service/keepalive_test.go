@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+func TestHeartbeats(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st), WithHeartbeat(50*time.Millisecond)))
+	publish(t, client, "orders", "one")
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "orders", Heartbeats: true})
+	heartbeat := receive(t, stream, 1)[0].GetHeartbeat()
+	if heartbeat == nil || heartbeat.LastSequence != 1 {
+		t.Fatalf("Expected a heartbeat at sequence 1, got %v", heartbeat)
+	}
+
+	publish(t, client, "orders", "two")
+	for {
+		event := receive(t, stream, 1)[0]
+		if event.GetHeartbeat() == nil {
+			if event.Sequence != 2 {
+				t.Fatalf("Expected sequence 2, got %d", event.Sequence)
+			}
+			break
+		}
+	}
+	if heartbeat := receive(t, stream, 1)[0].GetHeartbeat(); heartbeat == nil || heartbeat.LastSequence != 2 {
+		t.Errorf("Expected a heartbeat at sequence 2, got %v", heartbeat)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	bus := subpub.NewSubPub()
+	client := startServer(t, NewPubSubService(bus, WithSendTimeout(100*time.Millisecond)))
+
+	// The client never reads, so the server's sends block once the
+	// transport's flow control windows are full.
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "blobs"})
+	payload := make([]byte, 64<<10)
+	for i := 0; i < 100; i++ {
+		if _, err := client.Publish(context.Background(), &pb.PublishRequest{Key: "blobs", Payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for bus.Stats().Subscriptions != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the stalled stream to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The events sent before the stall are followed by the reason.
+	for {
+		_, err := stream.Recv()
+		if err == nil {
+			continue
+		}
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded, got %v", err)
+		}
+		break
+	}
+}
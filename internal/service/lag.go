@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+// LagAlertSubject is the subject lag alerts are published to by default.
+const LagAlertSubject = "$SYS.consumer.lag"
+
+// LagAlerts configures when a consumer is reported as lagging. A zero
+// MaxPending or MaxLag disables that threshold.
+type LagAlerts struct {
+	Interval   time.Duration
+	MaxPending uint64
+	MaxLag     time.Duration
+	Subject    string
+}
+
+// LagAlert is the payload of a lag alert. State is "exceeded" when the
+// consumer crosses a threshold and "recovered" when it is back under.
+type LagAlert struct {
+	Consumer   string  `json:"consumer"`
+	Subject    string  `json:"subject"`
+	State      string  `json:"state"`
+	Pending    uint64  `json:"pending"`
+	LagSeconds float64 `json:"lag_seconds"`
+}
+
+// LagMonitor periodically checks the lag of durable consumers and
+// publishes an alert on the bus when it crosses the thresholds.
+type LagMonitor struct {
+	bus      subpub.SubPub
+	store    *store.Store
+	cfg      LagAlerts
+	exceeded map[pullKey]bool
+}
+
+func NewLagMonitor(bus subpub.SubPub, st *store.Store, cfg LagAlerts) *LagMonitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = LagAlertSubject
+	}
+	return &LagMonitor{bus: bus, store: st, cfg: cfg, exceeded: make(map[pullKey]bool)}
+}
+
+// Run checks the consumers every interval until ctx ends.
+func (m *LagMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(time.Now())
+		}
+	}
+}
+
+// Check publishes alerts for the consumers whose state changed since the
+// previous check.
+func (m *LagMonitor) Check(now time.Time) {
+	seen := make(map[pullKey]bool)
+	for _, c := range m.store.Consumers() {
+		lag, err := m.store.ConsumerLag(c)
+		if err != nil {
+			continue
+		}
+
+		key := pullKey{c.Name, c.Subject}
+		seen[key] = true
+
+		var age time.Duration
+		if !lag.Oldest.IsZero() {
+			age = now.Sub(lag.Oldest)
+		}
+		exceeded := (m.cfg.MaxPending > 0 && lag.Pending > m.cfg.MaxPending) ||
+			(m.cfg.MaxLag > 0 && age > m.cfg.MaxLag)
+		if exceeded == m.exceeded[key] {
+			continue
+		}
+		m.exceeded[key] = exceeded
+
+		alert := LagAlert{
+			Consumer:   c.Name,
+			Subject:    c.Subject,
+			State:      "recovered",
+			Pending:    lag.Pending,
+			LagSeconds: age.Seconds(),
+		}
+		if exceeded {
+			alert.State = "exceeded"
+		}
+		m.publish(alert)
+	}
+
+	for key := range m.exceeded {
+		if !seen[key] {
+			delete(m.exceeded, key)
+		}
+	}
+}
+
+func (m *LagMonitor) publish(alert LagAlert) {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	log.Warn().Str("consumer", alert.Consumer).Str("subject", alert.Subject).Str("state", alert.State).
+		Uint64("pending", alert.Pending).Msg("Consumer lag")
+
+	err = m.bus.Publish(m.cfg.Subject, &subpub.Message{
+		Headers: map[string]string{
+			"consumer": alert.Consumer,
+			"subject":  alert.Subject,
+			"state":    alert.State,
+			"pending":  strconv.FormatUint(alert.Pending, 10),
+		},
+		Data:        data,
+		ContentType: "application/json",
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to publish lag alert")
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StepanErshov/pubsub/internal/metrics"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+func TestConsumerLag(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	bus := subpub.NewSubPub(subpub.WithStore(st))
+	defer bus.Close(context.Background())
+	admin := NewAdminService(bus, st)
+
+	if _, err := st.OpenConsumer("billing", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		bus.Publish("orders", "order")
+	}
+
+	list, err := admin.ListConsumers(context.Background(), &pb.ListConsumersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Consumers) != 1 || list.Consumers[0].Pending != 3 || list.Consumers[0].Lag == nil {
+		t.Errorf("Expected lag of 3 events, got %v", list.Consumers)
+	}
+
+	registry := metrics.NewRegistry()
+	registry.Register(admin.CollectMetrics)
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `pubsub_consumer_pending_messages{consumer="billing",subject="orders"} 3`) {
+		t.Errorf("Consumer lag missing from metrics:\n%s", body)
+	}
+}
+
+func TestLagMonitor(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	bus := subpub.NewSubPub(subpub.WithStore(st))
+	defer bus.Close(context.Background())
+
+	alerts := make(chan LagAlert, 10)
+	bus.Subscribe(LagAlertSubject, func(msg interface{}) {
+		var alert LagAlert
+		json.Unmarshal(msg.(*subpub.Message).Data, &alert)
+		alerts <- alert
+	})
+
+	if _, err := st.OpenConsumer("billing", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	monitor := NewLagMonitor(bus, st, LagAlerts{MaxPending: 2})
+
+	bus.Publish("orders", "one")
+	monitor.Check(time.Now())
+	bus.Publish("orders", "two")
+	bus.Publish("orders", "three")
+	monitor.Check(time.Now())
+	monitor.Check(time.Now())
+	st.Ack("billing", "orders", 3)
+	monitor.Check(time.Now())
+
+	var got []string
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case alert := <-alerts:
+			got = append(got, alert.State)
+			if alert.Consumer != "billing" || alert.Subject != "orders" {
+				t.Errorf("Unexpected alert %+v", alert)
+			}
+		case <-timeout:
+			t.Fatalf("Expected two alerts, got %v", got)
+		}
+	}
+	if got[0] != "exceeded" || got[1] != "recovered" {
+		t.Errorf("Expected exceeded then recovered, got %v", got)
+	}
+	select {
+	case alert := <-alerts:
+		t.Errorf("Unexpected extra alert %+v", alert)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"time"
+
+	"github.com/StepanErshov/pubsub/internal/metrics"
+)
+
+// CollectMetrics reports bus statistics, persisted subjects and consumer
+// lag.
+func (s *AdminService) CollectMetrics(w *metrics.Writer) {
+	stats := s.bus.Stats()
+	w.Gauge("pubsub_subjects", "Subjects with at least one subscription.", float64(stats.Subjects))
+	w.Gauge("pubsub_subscriptions", "Active subscriptions.", float64(stats.Subscriptions))
+	w.Counter("pubsub_published_total", "Published events.", float64(stats.Published))
+	w.Counter("pubsub_enqueued_total", "Events queued for subscribers.", float64(stats.Enqueued))
+	w.Counter("pubsub_dropped_total", "Events dropped because a subscriber queue was full.", float64(stats.Dropped))
+	w.Counter("pubsub_duplicates_total", "Publishes ignored as duplicates.", float64(stats.Duplicates))
+
+	if s.store == nil {
+		return
+	}
+
+	for _, info := range s.store.Subjects() {
+		w.Gauge("pubsub_subject_messages", "Events retained on a persisted subject.", float64(info.Messages), "subject", info.Subject)
+		w.Gauge("pubsub_subject_bytes", "Bytes retained on a persisted subject.", float64(info.Bytes), "subject", info.Subject)
+		w.Gauge("pubsub_subject_last_sequence", "Sequence of the last event of a persisted subject.", float64(info.LastSeq), "subject", info.Subject)
+	}
+
+	now := time.Now()
+	for _, c := range s.store.Consumers() {
+		lag, err := s.store.ConsumerLag(c)
+		if err != nil {
+			continue
+		}
+		var age time.Duration
+		if !lag.Oldest.IsZero() {
+			age = now.Sub(lag.Oldest)
+		}
+		w.Gauge("pubsub_consumer_pending_messages", "Events a durable consumer has not acknowledged.", float64(lag.Pending), "consumer", c.Name, "subject", c.Subject)
+		w.Gauge("pubsub_consumer_lag_seconds", "Age of the oldest event a durable consumer has not acknowledged.", age.Seconds(), "consumer", c.Name, "subject", c.Subject)
+	}
+}
+
+// CollectMetrics reports the events the service dropped itself.
+func (s *PubSubService) CollectMetrics(w *metrics.Writer) {
+	w.Counter("pubsub_paused_dropped_total", "Events dropped because a paused subscription held too many.", float64(s.heldDropped.Load()))
+}
@@ -2,23 +2,104 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
     "github.com/rs/zerolog/log"
     "google.golang.org/grpc"
     "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/metadata"
     "google.golang.org/grpc/status"
-    "google.golang.org/protobuf/types/known/emptypb"
     
+    "github.com/StepanErshov/pubsub/pkg/filter"
     "github.com/StepanErshov/pubsub/pkg/pb"
+    "github.com/StepanErshov/pubsub/pkg/store"
     "github.com/StepanErshov/pubsub/pkg/subpub"
 )
 
+const (
+	filterCacheSize = 1024
+	maxConcurrency  = 64
+)
+
+// Response headers of Subscribe that confirm the subscription.
+const (
+	subscriptionIDHeader = "pubsub-subscription-id"
+	startSequenceHeader  = "pubsub-start-sequence"
+	serverTimeHeader     = "pubsub-server-time"
+)
+
 type PubSubService struct {
 	pb.UnimplementedPubSubServer
-	bus subpub.SubPub
+	bus            subpub.SubPub
+	store          *store.Store
+	pulls          pullStates
+	filters        *filter.Cache
+	publishTimeout time.Duration
+	heartbeat      time.Duration
+	sendTimeout    time.Duration
+
+	// heldDropped counts the events dropped when paused subscriptions
+	// of Connect streams overflowed.
+	heldDropped atomic.Uint64
+
+	// draining is set by Shutdown; closing is canceled once the bus has
+	// been closed, which ends all streams.
+	draining atomic.Bool
+	closing  context.Context
+	shutdown context.CancelFunc
 }
 
-func NewPubSubService(bus subpub.SubPub) *PubSubService {
-	return &PubSubService{bus: bus}
+type Option func(*PubSubService)
+
+// WithPublishTimeout bounds how long a blocking Publish waits for
+// subscribers to make room before failing with ResourceExhausted.
+func WithPublishTimeout(d time.Duration) Option {
+	return func(s *PubSubService) {
+		s.publishTimeout = d
+	}
+}
+
+// WithHeartbeat sets how long a subscription that asked for heartbeats
+// may be idle before one is sent. The default is 30 seconds.
+func WithHeartbeat(d time.Duration) Option {
+	return func(s *PubSubService) {
+		s.heartbeat = d
+	}
+}
+
+// WithSendTimeout closes subscription streams whose client has not taken
+// an event for d, so that they do not hold resources forever. Zero
+// disables the check.
+func WithSendTimeout(d time.Duration) Option {
+	return func(s *PubSubService) {
+		s.sendTimeout = d
+	}
+}
+
+// WithStore enables durable consumers on the subjects persisted in st. It
+// should be the store the bus writes to.
+func WithStore(st *store.Store) Option {
+	return func(s *PubSubService) {
+		s.store = st
+	}
+}
+
+func NewPubSubService(bus subpub.SubPub, opts ...Option) *PubSubService {
+	s := &PubSubService{
+		bus:     bus,
+		filters: filter.NewCache(filterCacheSize),
+	}
+	s.closing, s.shutdown = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *PubSubService) Register(server *grpc.Server) {
@@ -27,49 +108,295 @@ func (s *PubSubService) Register(server *grpc.Server) {
 }
 
 func (s *PubSubService) Subscribe(req *pb.SubscribeRequest, stream pb.PubSub_SubscribeServer) error {
-	key := req.GetKey()
-	if key == "" {
-		return status.Error(codes.InvalidArgument, "key is required")
+	if s.draining.Load() {
+		return errShuttingDown
+	}
+	f, err := s.checkSubscribe(req)
+	if err != nil {
+		return err
 	}
-
-	log.Info().Str("key", key).Msg("New subscription")
 
 	ctx, cancel := context.WithCancel(stream.Context())
 	defer cancel()
+	defer context.AfterFunc(s.closing, cancel)()
+
+	k := s.newKeepalive(req, stream.Send)
+	defer k.close()
+	var stalled atomic.Bool
+	stall := func() {
+		stalled.Store(true)
+		cancel()
+	}
+	id := newSubscriptionID()
+	started := func(start uint64) error {
+		k.next.Store(start)
+		err := stream.SendHeader(metadata.Pairs(
+			subscriptionIDHeader, id,
+			startSequenceHeader, strconv.FormatUint(start, 10),
+			serverTimeHeader, time.Now().UTC().Format(time.RFC3339Nano),
+		))
+		go k.run(ctx, stall)
+		return err
+	}
+	switch {
+	case req.GetConsumer() != "":
+		err = s.subscribeDurable(ctx, req, f, started, k.Send)
+	case req.GetResumeToken() != "" || req.GetStartSequence() > 0:
+		err = s.subscribeReplay(ctx, req, f, started, k.Send)
+	default:
+		err = s.subscribeLive(ctx, req, f, started, k.Send, cancel)
+	}
+	if err == nil && stalled.Load() {
+		return errStalled
+	}
+	if err != nil || s.closing.Err() == nil || stream.Context().Err() != nil {
+		return err
+	}
+
+	// The server is shutting down: tell the client where to resume.
+	if err := k.Send(&pb.Event{Shutdown: shutdownFrame(req, k)}); err != nil {
+		log.Debug().Err(err).Msg("Failed to send shutdown event")
+	}
+	return errShuttingDown
+}
+
+// subscribeLive passes the events published on the bus from now on to send
+// until ctx ends.
+func (s *PubSubService) subscribeLive(ctx context.Context, req *pb.SubscribeRequest, f *filter.Filter, started func(start uint64) error, send func(*pb.Event) error, cancel context.CancelFunc) error {
+	// Events wait for the headers, which confirm the subscription.
+	ready := make(chan struct{})
+	sub, err := s.subscribeBus(req, f, func(event *pb.Event) error {
+		<-ready
+		return send(event)
+	}, cancel)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	err = started(s.startSequence(req.GetKey()))
+	close(ready)
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// newSubscriptionID returns a random ID for a Subscribe stream.
+func newSubscriptionID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// startSequence returns the sequence from which a subscription to key
+// registered now receives events, or zero when key is not persisted.
+func (s *PubSubService) startSequence(key string) uint64 {
+	if s.store == nil {
+		return 0
+	}
+	last, err := s.store.LastSeq(key)
+	if err != nil {
+		return 0
+	}
+	return last + 1
+}
+
+// checkSubscribe validates req and returns its compiled filter, if any.
+func (s *PubSubService) checkSubscribe(req *pb.SubscribeRequest) (*filter.Filter, error) {
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+
+	var f *filter.Filter
+	if expr := req.GetFilter(); expr != "" {
+		var err error
+		if f, err = s.filters.Get(expr); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if req.GetConsumer() != "" {
+		if req.GetConcurrency() > 1 {
+			return nil, status.Error(codes.InvalidArgument, "concurrency is not supported for durable consumers")
+		}
+		return f, nil
+	}
+	if req.GetManualAck() {
+		return nil, status.Error(codes.InvalidArgument, "manual_ack requires a consumer")
+	}
+	if n := req.GetConcurrency(); n > 1 {
+		if n > maxConcurrency {
+			return nil, status.Errorf(codes.InvalidArgument, "concurrency must not exceed %d", maxConcurrency)
+		}
+		if req.GetPartitionHeader() == "" {
+			return nil, status.Error(codes.InvalidArgument, "partition_header is required with concurrency")
+		}
+	}
+	return f, nil
+}
+
+// subscribeBus subscribes to the events published on the bus and passes
+// them to send. cancel is called when send fails.
+func (s *PubSubService) subscribeBus(req *pb.SubscribeRequest, f *filter.Filter, send func(*pb.Event) error, cancel context.CancelFunc) (subpub.Subscription, error) {
+	key := req.GetKey()
+
+	var match func(msg interface{}) bool
+	if f != nil {
+		match = func(msg interface{}) bool {
+			m, ok := msg.(*subpub.Message)
+			return ok && f.Match(m.Headers, m.Data)
+		}
+	}
+
+	// With concurrency the partitions filter and convert their events in
+	// parallel, off the publish path. send serializes the writes to the
+	// stream, so only the events of one partition keep their order.
+	var opts []subpub.SubscribeOption
+	parallel := req.GetConcurrency() > 1
+	switch {
+	case parallel:
+		opts = append(opts, subpub.WithConcurrency(int(req.GetConcurrency()), subpub.HeaderKey(req.GetPartitionHeader())))
+	case match != nil:
+		opts = append(opts, subpub.WithFilter(match))
+	}
+
+	log.Info().Str("key", key).Str("filter", req.GetFilter()).Uint32("concurrency", req.GetConcurrency()).Msg("New subscription")
 
 	sub, err := s.bus.Subscribe(key, func(msg interface{}) {
-		data, ok := msg.(string)
-		if !ok {
+		if parallel && match != nil && !match(msg) {
+			return
+		}
+		var event *pb.Event
+		switch m := msg.(type) {
+		case *subpub.Message:
+			event = &pb.Event{
+				Headers:    m.Headers,
+				MessageKey: m.Key,
+				Tombstone:  m.Tombstone,
+				Sequence:   m.Seq,
+			}
+			setPayload(event, m.Data, m.ContentType)
+		case string:
+			event = &pb.Event{}
+			setPayload(event, []byte(m), "")
+		case []byte:
+			event = &pb.Event{}
+			setPayload(event, m, "")
+		default:
 			log.Error().Msg("Invalid message type")
 			return
 		}
 
-		if err := stream.Send(&pb.Event{Data: data}); err != nil {
+		if err := send(event); err != nil {
 			log.Error().Err(err).Msg("Failed to send event")
 			cancel()
 		}
-	})
+	}, opts...)
 	if err != nil {
-		return status.Error(codes.Internal, "failed to subscribe")
+		return nil, status.Error(codes.Internal, "failed to subscribe")
 	}
-	defer sub.Unsubscribe()
+	return sub, nil
+}
 
-	<-ctx.Done()
+func (s *PubSubService) Publish(ctx context.Context, req *pb.PublishRequest) (*pb.PublishResponse, error) {
+	key := req.GetKey()
+	if err := checkPublish(req); err != nil {
+		return nil, err
+	}
+
+	var opts []subpub.PublishOption
+	if req.GetWaitForDelivery() {
+		opts = append(opts, subpub.WaitForHandlers())
+	}
+	if id := req.GetMessageId(); id != "" {
+		opts = append(opts, subpub.WithMessageID(id))
+	}
+
+	publishCtx := ctx
+	if req.GetBlock() {
+		opts = append(opts, subpub.BlockWhenFull(), subpub.WithQuorum(int(req.GetQuorum())))
+		if s.publishTimeout > 0 {
+			var cancel context.CancelFunc
+			publishCtx, cancel = context.WithTimeout(ctx, s.publishTimeout)
+			defer cancel()
+		}
+	}
+
+	report, err := s.bus.PublishAndWait(publishCtx, key, publishMessage(req), opts...)
+	if err != nil {
+		return nil, publishError(ctx, publishCtx, err)
+	}
+
+	if report.Duplicate {
+		log.Debug().Str("key", key).Str("message_id", req.GetMessageId()).Msg("Duplicate event ignored")
+	} else {
+		log.Info().Str("key", key).Int("bytes", len(req.GetData())+len(req.GetPayload())).Int("enqueued", report.Enqueued).Int("dropped", report.Dropped).Msg("Published event")
+	}
+	return publishResponse(report), nil
+}
+
+func checkPublish(req *pb.PublishRequest) error {
+	if req.GetKey() == "" {
+		return status.Error(codes.InvalidArgument, "key is required")
+	}
+	if req.GetData() != "" && len(req.GetPayload()) > 0 {
+		return status.Error(codes.InvalidArgument, "data and payload are mutually exclusive")
+	}
 	return nil
 }
 
-func (s *PubSubService) Publish(ctx context.Context, req *pb.PublishRequest) (*emptypb.Empty, error) {
-	key := req.GetKey()
-	data := req.GetData()
+func publishMessage(req *pb.PublishRequest) *subpub.Message {
+	data := req.GetPayload()
+	if req.GetData() != "" {
+		data = []byte(req.GetData())
+	}
+	return &subpub.Message{
+		Headers:     req.GetHeaders(),
+		Data:        data,
+		ContentType: req.GetContentType(),
+		Key:         req.GetMessageKey(),
+		Tombstone:   req.GetTombstone(),
+	}
+}
 
-	if key == "" {
-		return nil, status.Error(codes.InvalidArgument, "key is required")
+// setPayload sets the payload of event and, for clients that still read
+// the deprecated data field, data when the payload is untyped text.
+func setPayload(event *pb.Event, data []byte, contentType string) {
+	event.Payload = data
+	event.ContentType = contentType
+	if contentType == "" && utf8.Valid(data) {
+		event.Data = string(data)
 	}
+}
 
-	if err := s.bus.Publish(key, data); err != nil {
-		return nil, status.Error(codes.Internal, "failed to publish")
+func publishResponse(report subpub.PublishReport) *pb.PublishResponse {
+	return &pb.PublishResponse{
+		Matched:   uint32(report.Matched),
+		Enqueued:  uint32(report.Enqueued),
+		Dropped:   uint32(report.Dropped),
+		Duplicate: report.Duplicate,
+		Sequence:  report.Seq,
 	}
+}
 
-	log.Info().Str("key", key).Str("data", data).Msg("Published event")
-	return &emptypb.Empty{}, nil
-}
\ No newline at end of file
+// publishError maps a publish error to a status. publishCtx is ctx
+// bounded by the server's publish timeout.
+func publishError(ctx, publishCtx context.Context, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	case publishCtx.Err() != nil:
+		return status.Error(codes.ResourceExhausted, "subscribers did not make room before the publish timeout")
+	case errors.Is(err, subpub.ErrQuorumNotReached), errors.Is(err, subpub.ErrBatchFull), errors.Is(err, store.ErrSubjectFull):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, subpub.ErrNotPersistable):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled):
+		// The bus has been closed.
+		return errShuttingDown
+	}
+	return status.Error(codes.Internal, "failed to publish")
+}
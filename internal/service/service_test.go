@@ -1,14 +1,61 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
 	"github.com/StepanErshov/pubsub/pkg/subpub"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
+// startServer serves service over an in-memory listener and returns a
+// client connected to it.
+func startServer(t *testing.T, service *PubSubService) pb.PubSubClient {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	service.Register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewPubSubClient(conn)
+}
+
+// subscribe opens a stream and waits until the server has confirmed it.
+// A rejected stream is returned as well; its error comes with Recv.
+func subscribe(t *testing.T, client pb.PubSubClient, req *pb.SubscribeRequest) pb.PubSub_SubscribeClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	stream, err := client.Subscribe(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The headers are sent once the subscription is registered.
+	stream.Header()
+	return stream
+}
+
 func TestPubSubService(t *testing.T) {
 	bus := subpub.NewSubPub()
 	service := NewPubSubService(bus)
@@ -28,4 +75,234 @@ func TestPublish(t *testing.T) {
 	if err != nil {
 		t.Errorf("Publish failed: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestSubscribeInvalidFilter(t *testing.T) {
+	bus := subpub.NewSubPub()
+	service := NewPubSubService(bus)
+
+	err := service.Subscribe(&pb.SubscribeRequest{Key: "test", Filter: "header.type =="}, nil)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestSubscribeConcurrencyRequiresPartitionHeader(t *testing.T) {
+	service := NewPubSubService(subpub.NewSubPub())
+
+	err := service.Subscribe(&pb.SubscribeRequest{Key: "test", Concurrency: 4}, nil)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestSubscribeFilterAndPartitions(t *testing.T) {
+	client := startServer(t, NewPubSubService(subpub.NewSubPub()))
+	stream := subscribe(t, client, &pb.SubscribeRequest{
+		Key:             "orders",
+		Filter:          `header.type == "created"`,
+		Concurrency:     4,
+		PartitionHeader: "id",
+	})
+
+	for _, typ := range []string{"created", "deleted", "created"} {
+		_, err := client.Publish(context.Background(), &pb.PublishRequest{
+			Key:     "orders",
+			Data:    typ,
+			Headers: map[string]string{"type": typ, "id": "1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Headers["type"] != "created" {
+			t.Errorf("Received event that should have been filtered: %v", event)
+		}
+	}
+}
+
+func TestSubscribePartitionOrder(t *testing.T) {
+	client := startServer(t, NewPubSubService(subpub.NewSubPub()))
+	stream := subscribe(t, client, &pb.SubscribeRequest{
+		Key:             "orders",
+		Concurrency:     4,
+		PartitionHeader: "id",
+	})
+
+	const perKey = 50
+	for i := 0; i < perKey; i++ {
+		for _, id := range []string{"a", "b", "c"} {
+			_, err := client.Publish(context.Background(), &pb.PublishRequest{
+				Key:     "orders",
+				Data:    strconv.Itoa(i),
+				Headers: map[string]string{"id": id},
+				Block:   true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	next := make(map[string]int)
+	for _, event := range receive(t, stream, 3*perKey) {
+		id := event.Headers["id"]
+		if event.Data != strconv.Itoa(next[id]) {
+			t.Fatalf("Expected event %d of %s, got %s", next[id], id, event.Data)
+		}
+		next[id]++
+	}
+}
+
+func TestPublishReport(t *testing.T) {
+	client := startServer(t, NewPubSubService(subpub.NewSubPub()))
+
+	resp, err := client.Publish(context.Background(), &pb.PublishRequest{Key: "test", Data: "nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Matched != 0 || resp.Enqueued != 0 {
+		t.Errorf("Expected no subscribers, got %v", resp)
+	}
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "test"})
+
+	resp, err = client.Publish(context.Background(), &pb.PublishRequest{Key: "test", Data: "hello", WaitForDelivery: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Matched != 1 || resp.Enqueued != 1 || resp.Dropped != 0 {
+		t.Errorf("Expected one delivery, got %v", resp)
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Data != "hello" {
+		t.Errorf("Expected hello, got %q", event.Data)
+	}
+}
+
+func TestBlockingPublishBackpressure(t *testing.T) {
+	bus := subpub.NewSubPub(subpub.WithQueueSize(1))
+	defer bus.Close(context.Background())
+	service := NewPubSubService(bus, WithPublishTimeout(50*time.Millisecond))
+
+	release := make(chan struct{})
+	defer close(release)
+	_, _ = bus.Subscribe("test", func(msg interface{}) { <-release })
+	bus.Publish("test", "in handler")
+	time.Sleep(20 * time.Millisecond)
+	bus.Publish("test", "queued")
+
+	req := &pb.PublishRequest{Key: "test", Data: "blocked", Block: true}
+
+	_, err := service.Publish(context.Background(), req)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = service.Publish(ctx, req)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestPublishDeduplication(t *testing.T) {
+	bus := subpub.NewSubPub(subpub.WithDeduplication(time.Minute, 10))
+	client := startServer(t, NewPubSubService(bus))
+	subscribe(t, client, &pb.SubscribeRequest{Key: "test"})
+
+	req := &pb.PublishRequest{Key: "test", Data: "retry", MessageId: "msg-1"}
+	first, err := client.Publish(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Publish(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Duplicate || first.Enqueued != 1 {
+		t.Errorf("Expected first publish to be delivered, got %v", first)
+	}
+	if !second.Duplicate || second.Enqueued != 0 {
+		t.Errorf("Expected retry to be a duplicate, got %v", second)
+	}
+	if bus.Stats().Duplicates != 1 {
+		t.Errorf("Expected one dedupe hit in stats, got %+v", bus.Stats())
+	}
+}
+
+func TestBinaryPayload(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "blobs"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "blobs"})
+
+	blob := []byte{0xff, 0x00, 0xfe}
+	_, err := client.Publish(context.Background(), &pb.PublishRequest{Key: "blobs", Payload: blob, ContentType: "application/x-protobuf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, client, "blobs", "legacy")
+
+	events := receive(t, stream, 2)
+	if !bytes.Equal(events[0].Payload, blob) || events[0].ContentType != "application/x-protobuf" || events[0].Data != "" {
+		t.Errorf("Unexpected binary event %v", events[0])
+	}
+	if string(events[1].Payload) != "legacy" || events[1].Data != "legacy" {
+		t.Errorf("Expected a legacy event to carry data and payload, got %v", events[1])
+	}
+
+	resp, err := client.Fetch(context.Background(), &pb.FetchRequest{Key: "blobs", StartSequence: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.Events[0].Payload, blob) || resp.Events[0].ContentType != "application/x-protobuf" {
+		t.Errorf("Expected the stored event to keep its payload, got %v", resp.Events[0])
+	}
+
+	_, err = client.Publish(context.Background(), &pb.PublishRequest{Key: "blobs", Data: "text", Payload: blob})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for data and payload, got %v", err)
+	}
+}
+
+func TestSubscribeConfirmation(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	publish(t, client, "orders", "before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{Key: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Get(subscriptionIDHeader)) != 1 || len(md.Get(serverTimeHeader)) != 1 {
+		t.Errorf("Expected the subscription to be confirmed, got %v", md)
+	}
+	if start := md.Get(startSequenceHeader); len(start) != 1 || start[0] != "2" {
+		t.Errorf("Expected start sequence 2, got %v", start)
+	}
+
+	// No sleep is needed once the headers arrived.
+	publish(t, client, "orders", "after")
+	if event := receive(t, stream, 1)[0]; event.Sequence != 2 {
+		t.Errorf("Expected sequence 2, got %d", event.Sequence)
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/StepanErshov/pubsub/pkg/filter"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+)
+
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down")
+
+// Shutdown ends all subscriptions so that clients can reconnect elsewhere.
+// New subscriptions are refused, the bus is closed once the events queued
+// for subscribers were sent, and each stream then gets a shutdown frame
+// with a resume token and ends with Unavailable. ctx bounds how long the
+// bus may take to drain.
+func (s *PubSubService) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	err := s.bus.Close(ctx)
+	s.shutdown()
+	return err
+}
+
+// shutdownFrame returns the last event of a subscription stream.
+func shutdownFrame(req *pb.SubscribeRequest, k *keepalive) *pb.Shutdown {
+	frame := &pb.Shutdown{}
+	if next := k.next.Load(); next > 0 && req.GetConsumer() == "" {
+		frame.ResumeToken = resumeToken(req.GetKey(), next)
+	}
+	return frame
+}
+
+// resumeToken encodes the next sequence a subscription to key expects.
+func resumeToken(key string, next uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(next, 10) + ":" + key))
+}
+
+func parseResumeToken(key, token string) (uint64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errors.New("malformed resume token")
+	}
+	seq, tokenKey, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return 0, errors.New("malformed resume token")
+	}
+	if tokenKey != key {
+		return 0, errors.New("resume token belongs to another key")
+	}
+	next, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, errors.New("malformed resume token")
+	}
+	return next, nil
+}
+
+// subscribeReplay passes the records of a persisted subject to send from
+// the request's resume token or start sequence on, until ctx ends.
+func (s *PubSubService) subscribeReplay(ctx context.Context, req *pb.SubscribeRequest, f *filter.Filter, started func(start uint64) error, send func(*pb.Event) error) error {
+	if s.store == nil {
+		return status.Error(codes.FailedPrecondition, "resuming requires storage")
+	}
+	key := req.GetKey()
+	next := req.GetStartSequence()
+	if token := req.GetResumeToken(); token != "" {
+		var err error
+		if next, err = parseResumeToken(key, token); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	// Records that retention removed are skipped.
+	next, err := s.firstRetained(key, next)
+	if err != nil {
+		return storeError(err)
+	}
+
+	log.Info().Str("key", key).Uint64("sequence", next).Msg("Resumed subscription")
+	if err := started(next); err != nil {
+		return err
+	}
+
+	for {
+		recs, err := s.store.Read(key, next, durableBatch)
+		if err != nil {
+			return storeError(err)
+		}
+		for _, rec := range recs {
+			next = rec.Seq + 1
+			if f != nil && !f.Match(rec.Headers, rec.Data) {
+				continue
+			}
+			if err := send(recordEvent(rec)); err != nil {
+				if ctx.Err() == nil {
+					log.Error().Err(err).Msg("Failed to send event")
+				}
+				return nil
+			}
+		}
+		if len(recs) == durableBatch {
+			continue
+		}
+		if len(recs) == 0 {
+			if next, err = s.firstRetained(key, next); err != nil {
+				return storeError(err)
+			}
+		}
+
+		err = s.store.Wait(ctx, key, next-1)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, store.ErrClosed):
+			return storeError(err)
+		}
+	}
+}
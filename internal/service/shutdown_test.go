@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+func shutdown(t *testing.T, svc *PubSubService) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := svc.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownResume(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	svc := NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st))
+	client := startServer(t, svc)
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "orders"})
+	publish(t, client, "orders", "one")
+	if event := receive(t, stream, 1)[0]; event.Data != "one" {
+		t.Fatalf("Expected one, got %q", event.Data)
+	}
+
+	// A publish stream and a long-poll that are open end with the
+	// subscription.
+	publishStream, err := client.PublishStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publishStream.Send(&pb.PublishRequest{Key: "audit", Data: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := client.Fetch(context.Background(), &pb.FetchRequest{
+			Key:           "orders",
+			StartSequence: 2,
+			MaxWait:       durationpb.New(time.Minute),
+		})
+		fetched <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdown(t, svc)
+	if err := publishStream.RecvMsg(&pb.PublishStreamResponse{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected the publish stream to end with Unavailable, got %v", err)
+	}
+	select {
+	case err := <-fetched:
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("Expected the fetch to end with Unavailable, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Fetch still waiting after shutdown")
+	}
+	frame := receive(t, stream, 1)[0].GetShutdown()
+	if frame == nil || frame.ResumeToken == "" {
+		t.Fatalf("Expected a shutdown event with a resume token, got %v", frame)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable, got %v", err)
+	}
+	if _, err := subscribe(t, client, &pb.SubscribeRequest{Key: "orders"}).Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected new subscriptions to be refused, got %v", err)
+	}
+
+	// Another server on the same storage continues where the stream ended.
+	client = startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	publish(t, client, "orders", "two")
+	stream = subscribe(t, client, &pb.SubscribeRequest{Key: "orders", ResumeToken: frame.ResumeToken})
+	if event := receive(t, stream, 1)[0]; event.Data != "two" || event.Sequence != 2 {
+		t.Errorf("Expected two at sequence 2, got %q at %d", event.Data, event.Sequence)
+	}
+	publish(t, client, "orders", "three")
+	if event := receive(t, stream, 1)[0]; event.Data != "three" {
+		t.Errorf("Expected three, got %q", event.Data)
+	}
+}
+
+func TestResumeTokenOfAnotherKey(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "orders", ResumeToken: resumeToken("payments", 1)})
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestConnectShutdown(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	svc := NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st))
+	client := startServer(t, svc)
+	stream := connect(t, client)
+
+	connSubscribe(t, stream, "a", &pb.SubscribeRequest{Key: "orders"})
+	connSubscribe(t, stream, "b", &pb.SubscribeRequest{Key: "news"})
+	publish(t, client, "orders", "one")
+	if frame := recvFrame(t, stream); frame.GetEvent().GetData() != "one" {
+		t.Fatalf("Expected one, got %v", frame)
+	}
+
+	shutdown(t, svc)
+	tokens := make(map[string]string)
+	for range 2 {
+		frame := recvFrame(t, stream)
+		if frame.GetShutdown() == nil {
+			t.Fatalf("Expected a shutdown frame, got %v", frame)
+		}
+		tokens[frame.SubscriptionId] = frame.GetShutdown().ResumeToken
+	}
+	if tokens["a"] != resumeToken("orders", 2) || tokens["b"] != "" {
+		t.Errorf("Unexpected resume tokens %v", tokens)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable, got %v", err)
+	}
+}
+
+func TestSubscribeStartSequence(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders"})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	publish(t, client, "orders", "one", "two", "three")
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "orders", StartSequence: 2})
+	for _, want := range []string{"two", "three"} {
+		if event := receive(t, stream, 1)[0]; event.Data != want {
+			t.Errorf("Expected %s, got %q", want, event.Data)
+		}
+	}
+}
+
+func TestSubscribeStartSequenceExpired(t *testing.T) {
+	st := openTestStore(t, store.SubjectConfig{Subject: "orders", MaxAge: 50 * time.Millisecond})
+	client := startServer(t, NewPubSubService(subpub.NewSubPub(subpub.WithStore(st)), WithStore(st)))
+	publish(t, client, "orders", "one", "two", "three")
+	time.Sleep(100 * time.Millisecond)
+	if err := st.EnforceRetention("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := subscribe(t, client, &pb.SubscribeRequest{Key: "orders", StartSequence: 1})
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start := header.Get(startSequenceHeader); len(start) != 1 || start[0] != "4" {
+		t.Errorf("Expected the subscription to start after the expired records, got %v", start)
+	}
+	publish(t, client, "orders", "four")
+	if event := receive(t, stream, 1)[0]; event.Sequence != 4 {
+		t.Errorf("Expected sequence 4, got %d", event.Sequence)
+	}
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// ErrBufferFull is returned by publishes that do not fit into a full
+// publish buffer with OverflowError.
+var ErrBufferFull = errors.New("client: publish buffer is full")
+
+// Overflow selects what happens to a publish that does not fit into the
+// publish buffer.
+type Overflow int
+
+const (
+	// OverflowBlock waits until there is room, or until the context of
+	// PublishCtx ends.
+	OverflowBlock Overflow = iota
+	// OverflowDrop drops the publish without an error.
+	OverflowDrop
+	// OverflowError fails the publish with ErrBufferFull.
+	OverflowError
+)
+
+// WithPublishBuffer buffers up to size publishes while the server is
+// unreachable instead of failing them. Buffered publishes are sent in
+// order once the connection is back; publishes made meanwhile queue up
+// behind them. Publishes without a message ID get a random one, so that a
+// server with deduplication drops a publish sent twice because its first
+// response was lost.
+func WithPublishBuffer(size int, overflow Overflow) BusOption {
+	return func(o *busOptions) {
+		o.bufferSize = size
+		o.overflow = overflow
+	}
+}
+
+// WithBufferDir also keeps the publish buffer in dir, so that publishes a
+// process buffered are sent by the next process using the same dir. The
+// buffer is written without syncing, so it survives a crash of the
+// process but not necessarily of the machine. If dir cannot be opened,
+// publishes fail with the reason.
+func WithBufferDir(dir string) BusOption {
+	return func(o *busOptions) {
+		o.bufferDir = dir
+	}
+}
+
+// BufferStats describes the publish buffer of a Bus.
+type BufferStats struct {
+	// Buffered is the number of publishes waiting to be sent.
+	Buffered int
+	// Flushed counts the buffered publishes the server accepted.
+	Flushed uint64
+	// Dropped counts the publishes dropped because the buffer was full
+	// with OverflowDrop, or because the server rejected them when they
+	// were flushed.
+	Dropped uint64
+}
+
+// publishBuffer holds publishes while the server is unreachable.
+type publishBuffer struct {
+	bus      *Bus
+	size     int
+	overflow Overflow
+	spool    *spool
+
+	mu    sync.Mutex
+	queue []pending
+	// changed is closed and replaced whenever publishes leave the queue.
+	changed  chan struct{}
+	flushing bool
+	flushed  uint64
+	dropped  uint64
+}
+
+func newPublishBuffer(b *Bus) (*publishBuffer, error) {
+	p := &publishBuffer{
+		bus:      b,
+		size:     b.opts.bufferSize,
+		overflow: b.opts.overflow,
+		changed:  make(chan struct{}),
+	}
+	if b.opts.bufferDir != "" {
+		var err error
+		if p.spool, p.queue, err = openSpool(b.opts.bufferDir); err != nil {
+			return nil, err
+		}
+		if len(p.queue) > 0 {
+			p.startFlush()
+		}
+	}
+	return p, nil
+}
+
+// publish sends req right away while nothing is buffered and buffers it
+// when that fails because the server is unreachable.
+func (p *publishBuffer) publish(ctx context.Context, req *pb.PublishRequest) error {
+	if req.MessageId == "" {
+		req.MessageId = newMessageID()
+	}
+
+	p.mu.Lock()
+	if len(p.queue) == 0 {
+		p.mu.Unlock()
+		_, err := p.bus.c.pubsub.Publish(ctx, req)
+		if status.Code(err) != codes.Unavailable {
+			return err
+		}
+		p.mu.Lock()
+	}
+	defer p.mu.Unlock()
+
+	for len(p.queue) >= p.size {
+		switch p.overflow {
+		case OverflowDrop:
+			p.dropped++
+			return nil
+		case OverflowError:
+			return ErrBufferFull
+		}
+
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+			p.mu.Lock()
+		case <-ctx.Done():
+			p.mu.Lock()
+			return ctx.Err()
+		case <-p.bus.ctx.Done():
+			p.mu.Lock()
+			return ErrClosed
+		}
+	}
+
+	entry := pending{req: req}
+	if p.spool != nil {
+		var err error
+		if entry.id, err = p.spool.add(req); err != nil {
+			return err
+		}
+	}
+	p.queue = append(p.queue, entry)
+	if !p.flushing {
+		p.startFlush()
+	}
+	return nil
+}
+
+func (p *publishBuffer) startFlush() {
+	p.flushing = true
+	p.bus.wg.Add(1)
+	go p.flush()
+}
+
+// flush sends the buffered publishes in order until the queue is empty
+// or the bus is closed.
+func (p *publishBuffer) flush() {
+	defer p.bus.wg.Done()
+
+	attempt := 0
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 || p.bus.ctx.Err() != nil {
+			p.flushing = false
+			p.mu.Unlock()
+			return
+		}
+		head := p.queue[0]
+		p.mu.Unlock()
+
+		_, err := p.bus.c.pubsub.Publish(p.bus.ctx, head.req, grpc.WaitForReady(true))
+		if p.bus.ctx.Err() != nil {
+			continue
+		}
+		if err != nil && !rejected(err) {
+			select {
+			case <-time.After(p.bus.backoff(attempt)):
+				attempt++
+			case <-p.bus.ctx.Done():
+			}
+			continue
+		}
+		attempt = 0
+		if err != nil && p.bus.opts.onError != nil {
+			p.bus.opts.onError(head.req.GetKey(), err)
+		}
+
+		p.mu.Lock()
+		p.queue = p.queue[1:]
+		if err != nil {
+			p.dropped++
+		} else {
+			p.flushed++
+		}
+		if p.spool != nil {
+			if len(p.queue) == 0 {
+				p.spool.reset()
+			} else {
+				p.spool.ack(head.id)
+			}
+		}
+		close(p.changed)
+		p.changed = make(chan struct{})
+		p.mu.Unlock()
+	}
+}
+
+// drain waits until the buffer is empty or ctx ends.
+func (p *publishBuffer) drain(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		empty, changed := len(p.queue) == 0, p.changed
+		p.mu.Unlock()
+		if empty {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *publishBuffer) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.spool == nil {
+		return nil
+	}
+	return p.spool.close()
+}
+
+func (p *publishBuffer) stats() BufferStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return BufferStats{Buffered: len(p.queue), Flushed: p.flushed, Dropped: p.dropped}
+}
+
+// newMessageID returns a random ID for deduplicating a buffered publish.
+func newMessageID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
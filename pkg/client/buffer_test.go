@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/StepanErshov/pubsub/config"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// unreachable returns the address of a server that was shut down and a
+// config to start it again with.
+func unreachable(t *testing.T) (string, *config.Config) {
+	cfg := &config.Config{}
+	cfg.Storage.Dir = t.TempDir()
+	cfg.Storage.Subjects = []config.SubjectConfig{{Subject: "orders"}}
+	srv := startTCPServer(t, cfg, "127.0.0.1:0")
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return srv.Addr().String(), cfg
+}
+
+func dial(t *testing.T, addr string) *Client {
+	c, err := Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func waitFlushed(t *testing.T, bus *Bus, n uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for bus.BufferStats().Flushed < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d flushed publishes, got %+v", n, bus.BufferStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectStored checks the data of the events stored for orders.
+func expectStored(t *testing.T, c *Client, want ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := c.pubsub.Subscribe(ctx, &pb.SubscribeRequest{Key: "orders", StartSequence: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range want {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(event.Payload) != w {
+			t.Errorf("Expected %s, got %q", w, event.Payload)
+		}
+	}
+}
+
+func TestPublishBuffer(t *testing.T) {
+	addr, cfg := unreachable(t)
+	c := dial(t, addr)
+	bus := c.Bus(WithBackoff(10*time.Millisecond, 50*time.Millisecond), WithPublishBuffer(2, OverflowError))
+	defer bus.Close(context.Background())
+
+	for _, data := range []string{"one", "two"} {
+		if err := bus.Publish("orders", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bus.Publish("orders", "three"); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Expected ErrBufferFull, got %v", err)
+	}
+	if stats := bus.BufferStats(); stats.Buffered != 2 {
+		t.Errorf("Expected 2 buffered publishes, got %+v", stats)
+	}
+
+	startTCPServer(t, cfg, addr)
+	waitFlushed(t, bus, 2)
+	if err := bus.Publish("orders", "four"); err != nil {
+		t.Fatal(err)
+	}
+	expectStored(t, c, "one", "two", "four")
+}
+
+func TestPublishBufferDrop(t *testing.T) {
+	addr, _ := unreachable(t)
+	bus := dial(t, addr).Bus(WithPublishBuffer(1, OverflowDrop))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	defer bus.Close(ctx)
+
+	for _, data := range []string{"one", "two", "three"} {
+		if err := bus.Publish("orders", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := bus.BufferStats(); stats.Buffered != 1 || stats.Dropped != 2 {
+		t.Errorf("Expected 1 buffered and 2 dropped publishes, got %+v", stats)
+	}
+}
+
+func TestPublishBufferDir(t *testing.T) {
+	addr, cfg := unreachable(t)
+	dir := t.TempDir()
+
+	bus := dial(t, addr).Bus(WithPublishBuffer(10, OverflowBlock), WithBufferDir(dir))
+	for _, data := range []string{"one", "two"} {
+		if err := bus.Publish("orders", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the buffer not to drain, got %v", err)
+	}
+
+	// The next process sends what the previous one buffered.
+	startTCPServer(t, cfg, addr)
+	c := dial(t, addr)
+	bus = c.Bus(WithPublishBuffer(10, OverflowBlock), WithBufferDir(dir))
+	defer bus.Close(context.Background())
+	waitFlushed(t, bus, 2)
+	expectStored(t, c, "one", "two")
+}
@@ -0,0 +1,497 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+// ErrClosed is returned when the bus is used after Close.
+var ErrClosed = errors.New("client: bus is closed")
+
+// State is the state of the connection to the server.
+type State int
+
+const (
+	StateConnecting State = iota
+	StateConnected
+	// StateDisconnected means the connection broke; the client keeps
+	// reconnecting.
+	StateDisconnected
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+type busOptions struct {
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onState    func(State)
+	onError    func(subject string, err error)
+	bufferSize int
+	overflow   Overflow
+	bufferDir  string
+}
+
+type BusOption func(*busOptions)
+
+// WithBackoff sets the delay before the first attempt to reopen a broken
+// subscription, which doubles up to max with each failed attempt. A random
+// jitter of up to half the delay is subtracted. The defaults are 100
+// milliseconds and 10 seconds.
+func WithBackoff(min, max time.Duration) BusOption {
+	return func(o *busOptions) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+// WithStateHandler calls fn whenever the state of the connection changes.
+// It requires a client created by Dial or on a *grpc.ClientConn.
+func WithStateHandler(fn func(State)) BusOption {
+	return func(o *busOptions) {
+		o.onState = fn
+	}
+}
+
+// WithErrorHandler calls fn when the server rejects a subscription for
+// good, e.g. because of an invalid filter. The subscription ends then.
+func WithErrorHandler(fn func(subject string, err error)) BusOption {
+	return func(o *busOptions) {
+		o.onError = fn
+	}
+}
+
+// SubscribeOption configures a subscription of a Bus.
+type SubscribeOption func(*pb.SubscribeRequest)
+
+// WithFilter delivers only the events matching the filter expression.
+func WithFilter(expr string) SubscribeOption {
+	return func(req *pb.SubscribeRequest) {
+		req.Filter = expr
+	}
+}
+
+// WithConsumer subscribes as the durable consumer name, which resumes
+// after the last event it received when it subscribes again.
+func WithConsumer(name string) SubscribeOption {
+	return func(req *pb.SubscribeRequest) {
+		req.Consumer = name
+	}
+}
+
+// WithStartSequence replays the events of a persisted subject from seq on
+// before new ones.
+func WithStartSequence(seq uint64) SubscribeOption {
+	return func(req *pb.SubscribeRequest) {
+		req.StartSequence = seq
+	}
+}
+
+// Bus is a handler-based API to the server like subpub.SubPub. Its
+// subscriptions outlive broken connections: they are reopened with
+// exponential backoff and, on persisted subjects, resume after the last
+// event they received.
+type Bus struct {
+	c      *Client
+	opts   busOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// buffer holds publishes while the server is unreachable; bufferErr
+	// is why it could not be opened.
+	buffer    *publishBuffer
+	bufferErr error
+
+	stateMu sync.Mutex
+	state   State
+}
+
+// stateConn is implemented by *grpc.ClientConn.
+type stateConn interface {
+	GetState() connectivity.State
+	WaitForStateChange(ctx context.Context, source connectivity.State) bool
+	Connect()
+}
+
+// Bus returns a handler-based API on c. Close the bus before the client.
+func (c *Client) Bus(opts ...BusOption) *Bus {
+	b := &Bus{
+		c: c,
+		opts: busOptions{
+			minBackoff: 100 * time.Millisecond,
+			maxBackoff: 10 * time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	if b.opts.bufferSize > 0 {
+		b.buffer, b.bufferErr = newPublishBuffer(b)
+	}
+
+	if cc, ok := c.cc.(stateConn); ok && b.opts.onState != nil {
+		b.wg.Add(1)
+		go b.watch(cc)
+	}
+	return b
+}
+
+// watch reports the state changes of cc until the bus is closed.
+func (b *Bus) watch(cc stateConn) {
+	defer b.wg.Done()
+
+	cc.Connect()
+	for {
+		state := cc.GetState()
+		switch state {
+		case connectivity.Ready:
+			b.setState(StateConnected)
+		case connectivity.Idle:
+			// The connection went idle after it broke; connect again
+			// right away so that the state is accurate.
+			if b.State() == StateConnected {
+				b.setState(StateDisconnected)
+			}
+			cc.Connect()
+		case connectivity.TransientFailure:
+			b.setState(StateDisconnected)
+		case connectivity.Shutdown:
+			b.setState(StateClosed)
+			return
+		}
+		if !cc.WaitForStateChange(b.ctx, state) {
+			return
+		}
+	}
+}
+
+// State returns the current state of the connection.
+func (b *Bus) State() State {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	return b.state
+}
+
+func (b *Bus) setState(state State) {
+	b.stateMu.Lock()
+	if b.state == state || b.state == StateClosed {
+		b.stateMu.Unlock()
+		return
+	}
+	b.state = state
+	b.stateMu.Unlock()
+
+	if b.opts.onState != nil {
+		b.opts.onState(state)
+	}
+}
+
+// backoff returns the delay before reconnect attempt n, counted from 0.
+func (b *Bus) backoff(n int) time.Duration {
+	d := b.opts.maxBackoff
+	if n < 30 && b.opts.minBackoff<<n < d {
+		d = b.opts.minBackoff << n
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - rand.N(d/2+1)
+}
+
+// Subscribe calls cb with a *subpub.Message for each event published on
+// subject, one at a time. It returns before the server has confirmed the
+// subscription; see BusSubscription.Ready.
+func (b *Bus) Subscribe(subject string, cb subpub.MessageHandler, opts ...SubscribeOption) (*BusSubscription, error) {
+	if subject == "" {
+		return nil, errors.New("client: subject is required")
+	}
+	if b.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	req := &pb.SubscribeRequest{Key: subject}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	ctx, cancel := context.WithCancel(b.ctx)
+	s := &BusSubscription{
+		bus:    b,
+		req:    req,
+		cb:     cb,
+		cancel: cancel,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go s.run(ctx)
+	return s, nil
+}
+
+// Publish publishes msg, a *subpub.Message, string or []byte, on subject.
+// It fails right away while the server is unreachable, unless the bus has
+// a publish buffer.
+func (b *Bus) Publish(subject string, msg interface{}) error {
+	return b.publish(context.Background(), subject, msg)
+}
+
+// PublishCtx publishes msg like Publish but waits for the connection to
+// the server to be reestablished until ctx ends.
+func (b *Bus) PublishCtx(ctx context.Context, subject string, msg interface{}) error {
+	return b.publish(ctx, subject, msg, grpc.WaitForReady(true))
+}
+
+func (b *Bus) publish(ctx context.Context, subject string, msg interface{}, opts ...grpc.CallOption) error {
+	if b.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if b.bufferErr != nil {
+		return b.bufferErr
+	}
+	req, err := publishRequest(subject, msg)
+	if err != nil {
+		return err
+	}
+	if b.buffer != nil {
+		return b.buffer.publish(ctx, req)
+	}
+	_, err = b.c.pubsub.Publish(ctx, req, opts...)
+	return err
+}
+
+func publishRequest(subject string, msg interface{}) (*pb.PublishRequest, error) {
+	req := &pb.PublishRequest{Key: subject}
+	switch m := msg.(type) {
+	case *subpub.Message:
+		req.Headers = m.Headers
+		req.Payload = m.Data
+		req.ContentType = m.ContentType
+		req.MessageKey = m.Key
+		req.Tombstone = m.Tombstone
+	case string:
+		req.Payload = []byte(m)
+	case []byte:
+		req.Payload = m
+	default:
+		return nil, fmt.Errorf("client: cannot publish %T", msg)
+	}
+	return req, nil
+}
+
+// BufferStats describes the publish buffer; it is zero without one.
+func (b *Bus) BufferStats() BufferStats {
+	if b.buffer == nil {
+		return BufferStats{}
+	}
+	return b.buffer.stats()
+}
+
+// Close ends all subscriptions and waits until their handlers returned or
+// ctx ends. Buffered publishes are flushed first while ctx allows; those
+// left are kept in the buffer dir, if any. The client stays open.
+func (b *Bus) Close(ctx context.Context) error {
+	var err error
+	if b.buffer != nil {
+		err = b.buffer.drain(ctx)
+	}
+	b.cancel()
+	b.setState(StateClosed)
+
+	done := make(chan struct{})
+	var closeErr error
+	go func() {
+		b.wg.Wait()
+		if b.buffer != nil {
+			closeErr = b.buffer.close()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return errors.Join(err, closeErr)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BusSubscription is a subscription of a Bus.
+type BusSubscription struct {
+	bus    *Bus
+	req    *pb.SubscribeRequest
+	cb     subpub.MessageHandler
+	cancel context.CancelFunc
+	ready  chan struct{}
+	once   sync.Once
+	done   chan struct{}
+
+	// next is the sequence to resume from on a persisted subject, zero
+	// while unknown or for a durable consumer; token is the resume token the server sent when it
+	// shut down. Both are only used by the subscription's goroutine.
+	next  uint64
+	token string
+}
+
+// Ready is closed once the server confirmed the subscription for the
+// first time.
+func (s *BusSubscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed once the subscription ended, after Unsubscribe, Close of
+// the bus or a rejection by the server.
+func (s *BusSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Unsubscribe ends the subscription. The handler may still be running
+// when it returns.
+func (s *BusSubscription) Unsubscribe() {
+	s.cancel()
+}
+
+func (s *BusSubscription) run(ctx context.Context) {
+	defer s.bus.wg.Done()
+	defer close(s.done)
+
+	attempt := 0
+	for {
+		err := s.receive(ctx, &attempt)
+		if ctx.Err() != nil {
+			return
+		}
+		if rejected(err) {
+			if s.resuming() {
+				// The server cannot resume, e.g. because the subject is
+				// not persisted there: continue with new events.
+				s.next, s.token = 0, ""
+				continue
+			}
+			if s.bus.opts.onError != nil {
+				s.bus.opts.onError(s.req.GetKey(), err)
+			}
+			return
+		}
+
+		select {
+		case <-time.After(s.bus.backoff(attempt)):
+			attempt++
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *BusSubscription) resuming() bool {
+	return s.token != "" || s.next > 0
+}
+
+// rejected reports whether err means that the server will not accept the
+// subscription when it is retried.
+func rejected(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.FailedPrecondition,
+		codes.PermissionDenied, codes.Unauthenticated, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// receive opens the subscription once and passes its events to the
+// handler until the stream breaks. It resets attempt once the server
+// confirmed the subscription.
+func (s *BusSubscription) receive(ctx context.Context, attempt *int) error {
+	req := proto.Clone(s.req).(*pb.SubscribeRequest)
+	if req.GetConsumer() == "" {
+		if s.token != "" {
+			req.ResumeToken = s.token
+		}
+		if s.next > 0 {
+			req.StartSequence = s.next
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.bus.c.pubsub.Subscribe(ctx, req)
+	if err != nil {
+		return err
+	}
+	md, err := stream.Header()
+	if err != nil {
+		return err
+	}
+	if len(md.Get(subscriptionIDHeader)) == 0 {
+		_, err := stream.Recv()
+		return err
+	}
+	if v := md.Get(startSequenceHeader); len(v) > 0 && req.GetConsumer() == "" {
+		if start, _ := strconv.ParseUint(v[0], 10, 64); start > s.next {
+			s.next = start
+		}
+	}
+	s.token = ""
+	*attempt = 0
+	s.once.Do(func() { close(s.ready) })
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		switch {
+		case event.GetHeartbeat() != nil:
+			continue
+		case event.GetShutdown() != nil:
+			s.token = event.GetShutdown().GetResumeToken()
+			continue
+		}
+		// A durable consumer is positioned by the server, which replays
+		// on purpose after the consumer was reset.
+		if seq := event.GetSequence(); seq > 0 && req.GetConsumer() == "" {
+			if seq < s.next {
+				// Replayed twice, e.g. after a resume.
+				continue
+			}
+			s.next = seq + 1
+		}
+		data := event.GetPayload()
+		if data == nil && event.GetData() != "" {
+			// Servers before payload support only fill data.
+			data = []byte(event.GetData())
+		}
+		s.cb(&subpub.Message{
+			Headers:     event.GetHeaders(),
+			Data:        data,
+			ContentType: event.GetContentType(),
+			Key:         event.GetMessageKey(),
+			Tombstone:   event.GetTombstone(),
+			Seq:         event.GetSequence(),
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/StepanErshov/pubsub/config"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/server"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+func startTCPServer(t *testing.T, cfg *config.Config, addr string) *server.Server {
+	srv := server.New(cfg, server.WithAddress(addr))
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv
+}
+
+func receiveMessage(t *testing.T, ch <-chan *subpub.Message) *subpub.Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a message")
+		return nil
+	}
+}
+
+func TestBusResubscribes(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Dir = t.TempDir()
+	cfg.Storage.Subjects = []config.SubjectConfig{{Subject: "orders"}}
+	srv := startTCPServer(t, cfg, "127.0.0.1:0")
+	addr := srv.Addr().String()
+
+	c, err := Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var mu sync.Mutex
+	var states []State
+	bus := c.Bus(WithBackoff(10*time.Millisecond, 100*time.Millisecond), WithStateHandler(func(s State) {
+		mu.Lock()
+		states = append(states, s)
+		mu.Unlock()
+	}))
+	defer bus.Close(context.Background())
+
+	ch := make(chan *subpub.Message, 10)
+	sub, err := bus.Subscribe("orders", func(msg interface{}) {
+		ch <- msg.(*subpub.Message)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	<-sub.Ready()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := bus.PublishCtx(ctx, "orders", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receiveMessage(t, ch); string(msg.Data) != "one" || msg.Seq != 1 {
+		t.Fatalf("Expected one at sequence 1, got %q at %d", msg.Data, msg.Seq)
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Published while the subscription is disconnected.
+	startTCPServer(t, cfg, addr)
+	if err := bus.PublishCtx(ctx, "orders", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receiveMessage(t, ch); string(msg.Data) != "two" || msg.Seq != 2 {
+		t.Errorf("Expected two at sequence 2, got %q at %d", msg.Data, msg.Seq)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(states) < 3 || states[0] != StateConnected || states[len(states)-1] != StateConnected {
+		t.Errorf("Expected to reconnect, got states %v", states)
+	}
+}
+
+func TestBusConsumerReset(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Dir = t.TempDir()
+	cfg.Storage.Subjects = []config.SubjectConfig{{Subject: "orders"}}
+	srv := startTCPServer(t, cfg, "127.0.0.1:0")
+
+	c, err := Dial(srv.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	bus := c.Bus()
+	defer bus.Close(context.Background())
+
+	ch := make(chan *subpub.Message, 10)
+	sub, err := bus.Subscribe("orders", func(msg interface{}) {
+		ch <- msg.(*subpub.Message)
+	}, WithConsumer("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	<-sub.Ready()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, data := range []string{"one", "two"} {
+		if err := bus.PublishCtx(ctx, "orders", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for seq := uint64(1); seq <= 2; seq++ {
+		if msg := receiveMessage(t, ch); msg.Seq != seq {
+			t.Fatalf("Expected sequence %d, got %d", seq, msg.Seq)
+		}
+	}
+
+	// The consumer acks asynchronously; reset it once both are acked.
+	admin := pb.NewAdminClient(c.cc)
+	for {
+		resp, err := admin.ListConsumers(ctx, &pb.ListConsumersRequest{Subject: "orders"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.GetConsumers()) == 1 && resp.GetConsumers()[0].GetAckSequence() == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = admin.ResetConsumer(ctx, &pb.ResetConsumerRequest{
+		Subject:  "orders",
+		Consumer: "billing",
+		Position: &pb.ResetConsumerRequest_Sequence{Sequence: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 2; seq++ {
+		if msg := receiveMessage(t, ch); msg.Seq != seq {
+			t.Fatalf("Expected the replay of sequence %d, got %d", seq, msg.Seq)
+		}
+	}
+}
+
+func TestBusRejectedSubscription(t *testing.T) {
+	c := startServer(t)
+	errs := make(chan error, 1)
+	bus := c.Bus(WithErrorHandler(func(subject string, err error) {
+		errs <- err
+	}))
+	defer bus.Close(context.Background())
+
+	sub, err := bus.Subscribe("orders", func(interface{}) {}, WithFilter("header.type =="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the subscription to be rejected")
+	}
+	<-sub.Done()
+}
+
+func TestBackoff(t *testing.T) {
+	b := &Bus{opts: busOptions{minBackoff: 100 * time.Millisecond, maxBackoff: time.Second}}
+	for n, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if d := b.backoff(n); d < max/2 || d > max {
+			t.Errorf("Attempt %d: expected a delay between %v and %v, got %v", n, max/2, max, d)
+		}
+	}
+	if d := b.backoff(100); d > time.Second {
+		t.Errorf("Expected the delay to be capped, got %v", d)
+	}
+}
@@ -0,0 +1,143 @@
+// Package client is a Go client for the PubSub service.
+package client
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// Response headers with which the server confirms a Subscribe stream.
+const (
+	subscriptionIDHeader = "pubsub-subscription-id"
+	startSequenceHeader  = "pubsub-start-sequence"
+	serverTimeHeader     = "pubsub-server-time"
+)
+
+// ErrNotConfirmed is returned by Subscription.Info when the stream ended
+// before the server confirmed it. Recv returns the reason.
+var ErrNotConfirmed = errors.New("client: subscription ended before it was confirmed")
+
+type Client struct {
+	conn   *grpc.ClientConn
+	cc     grpc.ClientConnInterface
+	pubsub pb.PubSubClient
+}
+
+// Dial creates a client for the server at target. Connections are
+// established lazily; opts must at least set transport credentials.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := New(conn)
+	c.conn = conn
+	return c, nil
+}
+
+// New creates a client on an existing connection, which Close leaves
+// open.
+func New(conn grpc.ClientConnInterface) *Client {
+	return &Client{cc: conn, pubsub: pb.NewPubSubClient(conn)}
+}
+
+// Close closes the connection created by Dial.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *Client) Publish(ctx context.Context, req *pb.PublishRequest) (*pb.PublishResponse, error) {
+	return c.pubsub.Publish(ctx, req)
+}
+
+// Info is the server's confirmation of a subscription.
+type Info struct {
+	ID string
+	// StartSequence is the sequence from which events of a persisted key
+	// are delivered, zero otherwise.
+	StartSequence uint64
+	ServerTime    time.Time
+}
+
+// Subscription is an open Subscribe stream.
+type Subscription struct {
+	stream pb.PubSub_SubscribeClient
+	cancel context.CancelFunc
+	ready  chan struct{}
+	info   Info
+	err    error
+}
+
+// Subscribe opens a subscription. It returns before the server has
+// registered it; Ready tells when events published from then on are
+// delivered.
+func (c *Client) Subscribe(ctx context.Context, req *pb.SubscribeRequest) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.pubsub.Subscribe(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Subscription{stream: stream, cancel: cancel, ready: make(chan struct{})}
+	go s.confirm()
+	return s, nil
+}
+
+func (s *Subscription) confirm() {
+	defer close(s.ready)
+
+	md, err := s.stream.Header()
+	if err != nil {
+		s.err = err
+		return
+	}
+	id := md.Get(subscriptionIDHeader)
+	if len(id) == 0 {
+		s.err = ErrNotConfirmed
+		return
+	}
+	s.info.ID = id[0]
+	if v := md.Get(startSequenceHeader); len(v) > 0 {
+		s.info.StartSequence, _ = strconv.ParseUint(v[0], 10, 64)
+	}
+	if v := md.Get(serverTimeHeader); len(v) > 0 {
+		s.info.ServerTime, _ = time.Parse(time.RFC3339Nano, v[0])
+	}
+}
+
+// Ready is closed once the server has confirmed the subscription or the
+// stream failed before that.
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Info waits until the subscription is ready and returns the server's
+// confirmation.
+func (s *Subscription) Info(ctx context.Context) (Info, error) {
+	select {
+	case <-s.ready:
+		return s.info, s.err
+	case <-ctx.Done():
+		return Info{}, ctx.Err()
+	}
+}
+
+// Recv returns the next event.
+func (s *Subscription) Recv() (*pb.Event, error) {
+	return s.stream.Recv()
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.cancel()
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+	"github.com/StepanErshov/pubsub/pkg/server"
+)
+
+func startServer(t *testing.T) *Client {
+	srv := server.New(nil, server.WithListener(bufconn.Listen(1<<20)))
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	conn, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(conn)
+	t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+func TestSubscriptionReady(t *testing.T) {
+	c := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := c.Subscribe(ctx, &pb.SubscribeRequest{Key: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	info, err := sub.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID == "" || info.ServerTime.IsZero() {
+		t.Errorf("Unexpected confirmation %+v", info)
+	}
+
+	// Once ready, an event published right away is not missed.
+	if _, err := c.Publish(ctx, &pb.PublishRequest{Key: "test", Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	event, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(event.Payload) != "hello" {
+		t.Errorf("Expected hello, got %q", event.Payload)
+	}
+}
+
+func TestSubscriptionNotConfirmed(t *testing.T) {
+	c := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := c.Subscribe(ctx, &pb.SubscribeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if _, err := sub.Info(ctx); err == nil {
+		t.Error("Expected a rejected subscription not to be confirmed")
+	}
+}
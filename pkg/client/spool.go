@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+// spoolFile is the name of the file in which a spool keeps its entries.
+const spoolFile = "outbox.log"
+
+// spool keeps buffered publishes on disk so that they survive a restart of
+// the process. It is a log of JSON lines that either add a publish or
+// acknowledge one; it is truncated whenever the buffer is empty.
+type spool struct {
+	f    *os.File
+	next uint64
+}
+
+type spoolLine struct {
+	ID      uint64 `json:"id,omitempty"`
+	Publish []byte `json:"publish,omitempty"`
+	Ack     uint64 `json:"ack,omitempty"`
+}
+
+// pending is a buffered publish; id identifies it in the spool.
+type pending struct {
+	id  uint64
+	req *pb.PublishRequest
+}
+
+// openSpool opens the spool in dir and returns the publishes that were not
+// acknowledged yet, in order.
+func openSpool(dir string) (*spool, []pending, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	path := filepath.Join(dir, spoolFile)
+	entries, err := readSpool(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rewrite the spool with only what is still pending, so that a crash
+	// in between leaves the old one in place.
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &spool{f: tmp, next: 1}
+	for i, e := range entries {
+		if entries[i].id, err = s.add(e.req); err != nil {
+			tmp.Close()
+			return nil, nil, err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		tmp.Close()
+		return nil, nil, err
+	}
+	return s, entries, nil
+}
+
+// readSpool returns the unacknowledged publishes in the spool at path.
+func readSpool(path string) ([]pending, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []pending
+	acked := make(map[uint64]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var line spoolLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// A line torn by a crash can only be the last one.
+			break
+		}
+		if line.Ack != 0 {
+			acked[line.Ack] = true
+			continue
+		}
+		req := &pb.PublishRequest{}
+		if err := proto.Unmarshal(line.Publish, req); err != nil {
+			return nil, err
+		}
+		entries = append(entries, pending{id: line.ID, req: req})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	unacked := entries[:0]
+	for _, e := range entries {
+		if !acked[e.id] {
+			unacked = append(unacked, e)
+		}
+	}
+	return unacked, nil
+}
+
+func (s *spool) write(line spoolLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+// add appends req and returns its ID.
+func (s *spool) add(req *pb.PublishRequest) (uint64, error) {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	id := s.next
+	if err := s.write(spoolLine{ID: id, Publish: data}); err != nil {
+		return 0, err
+	}
+	s.next++
+	return id, nil
+}
+
+func (s *spool) ack(id uint64) error {
+	return s.write(spoolLine{Ack: id})
+}
+
+// reset empties the spool.
+func (s *spool) reset() error {
+	if err := s.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := s.f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (s *spool) close() error {
+	return errors.Join(s.f.Sync(), s.f.Close())
+}
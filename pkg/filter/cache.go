@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache keeps recently compiled filters so that many subscriptions with
+// the same expression share one compiled Filter.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	expr   string
+	filter *Filter
+}
+
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = 1
+	}
+	return &Cache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *Cache) Get(expr string) (*Filter, error) {
+	c.mu.Lock()
+	if el, ok := c.items[expr]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*cacheEntry).filter, nil
+	}
+	c.mu.Unlock()
+
+	f, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[expr]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*cacheEntry).filter, nil
+	}
+	c.items[expr] = c.order.PushFront(&cacheEntry{expr: expr, filter: f})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).expr)
+	}
+	return f, nil
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
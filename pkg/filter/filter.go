@@ -0,0 +1,234 @@
+// Package filter implements the small expression language used to filter
+// subscriptions on the server side.
+//
+// An expression combines predicates over message headers and JSON payload
+// fields:
+//
+//	header.type == "order" && data.total >= 100
+//	!(header.region == "eu") || data.user.name =~ "^adm"
+//	header.trace-id
+//
+// Operands are header.<name> or data.<path>, where path segments are
+// object keys or array indexes. A bare operand is true when the field is
+// present and is not false or null. Supported operators are ==, !=, <, <=,
+// >, >=, =~ (RE2 regular expression), !, && and ||. A comparison against
+// a missing field is always false.
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxLength = 4096
+	MaxDepth  = 32
+)
+
+var ErrEmpty = errors.New("filter: empty expression")
+
+type Filter struct {
+	expr string
+	root node
+}
+
+func Compile(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, ErrEmpty
+	}
+	if len(expr) > MaxLength {
+		return nil, fmt.Errorf("filter: expression longer than %d bytes", MaxLength)
+	}
+
+	p := &parser{lex: lexer{src: expr}}
+	p.next()
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether a message with the given headers and payload
+// satisfies the filter. The payload is decoded as JSON only if the
+// expression refers to data fields.
+func (f *Filter) Match(headers map[string]string, data []byte) bool {
+	return f.root.eval(&message{headers: headers, raw: data})
+}
+
+type message struct {
+	headers map[string]string
+	raw     []byte
+	decoded bool
+	doc     interface{}
+	valid   bool
+}
+
+func (m *message) json() (interface{}, bool) {
+	if !m.decoded {
+		m.decoded = true
+		m.valid = json.Unmarshal(m.raw, &m.doc) == nil
+	}
+	return m.doc, m.valid
+}
+
+type node interface {
+	eval(m *message) bool
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(m *message) bool { return n.left.eval(m) || n.right.eval(m) }
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(m *message) bool { return n.left.eval(m) && n.right.eval(m) }
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(m *message) bool { return !n.inner.eval(m) }
+
+type existsNode struct{ field field }
+
+func (n existsNode) eval(m *message) bool {
+	v, ok := n.field.resolve(m)
+	if !ok {
+		return false
+	}
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+type compareNode struct {
+	field field
+	op    string
+	lit   interface{}
+	re    *regexp.Regexp
+}
+
+func (n compareNode) eval(m *message) bool {
+	v, ok := n.field.resolve(m)
+	if !ok {
+		return false
+	}
+
+	if n.re != nil {
+		s, ok := v.(string)
+		return ok && n.re.MatchString(s)
+	}
+
+	if n.field.header {
+		v = coerceHeader(v.(string), n.lit)
+	}
+
+	switch lit := n.lit.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		return compareOrdered(strings.Compare(s, lit), n.op)
+	case float64:
+		f, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		c := 0
+		if f < lit {
+			c = -1
+		} else if f > lit {
+			c = 1
+		}
+		return compareOrdered(c, n.op)
+	default:
+		if n.op == "==" {
+			return v == lit
+		}
+		return v != lit
+	}
+}
+
+// coerceHeader converts a header value to the type of the literal it is
+// compared with, since headers are always strings on the wire.
+func coerceHeader(s string, lit interface{}) interface{} {
+	switch lit.(type) {
+	case float64:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+func compareOrdered(c int, op string) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type field struct {
+	header bool
+	path   []string
+}
+
+func (f field) resolve(m *message) (interface{}, bool) {
+	if f.header {
+		v, ok := m.headers[f.path[0]]
+		return v, ok
+	}
+
+	cur, ok := m.json()
+	if !ok {
+		return nil, false
+	}
+	for _, seg := range f.path {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			if cur, ok = c[seg]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			cur = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
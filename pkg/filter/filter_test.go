@@ -0,0 +1,130 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	headers := map[string]string{"type": "order", "region": "eu", "priority": "5", "trace-id": "abc"}
+	data := []byte(`{"total": 150, "user": {"name": "admin", "active": true}, "items": ["a", "b"], "note": null}`)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`header.type == "order"`, true},
+		{`header.type != "order"`, false},
+		{`header.priority > 3`, true},
+		{`header.priority <= 3`, false},
+		{`header.trace-id`, true},
+		{`header.missing`, false},
+		{`header.missing == "x"`, false},
+		{`data.total >= 100`, true},
+		{`data.total < 100`, false},
+		{`data.user.name =~ "^adm"`, true},
+		{`data.user.active`, true},
+		{`data.user.active == false`, false},
+		{`data.items.1 == "b"`, true},
+		{`data.items.5 == "b"`, false},
+		{`data.note`, false},
+		{`data.note == null`, true},
+		{`header.type == 'order' && data.total > 100`, true},
+		{`header.type == "refund" || data.total > 100`, true},
+		{`!(header.region == "eu")`, false},
+		{`!header.region == "us" && (data.total == 150 || header.missing)`, true},
+	}
+
+	for _, tt := range tests {
+		f, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(headers, data); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestMatchNonJSONPayload(t *testing.T) {
+	f, err := Compile(`data.total > 1 || header.type == "plain"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(map[string]string{"type": "plain"}, []byte("not json")) {
+		t.Error("Expected header predicate to match with non-JSON payload")
+	}
+	if f.Match(nil, []byte("not json")) {
+		t.Error("Expected data predicate to fail on non-JSON payload")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	invalid := []string{
+		``,
+		`   `,
+		`type == "order"`,
+		`header. == "x"`,
+		`header.type ==`,
+		`header.type = "x"`,
+		`header.type == "x`,
+		`(header.type == "x"`,
+		`header.type == "x")`,
+		`data.total > true`,
+		`data.name =~ 5`,
+		`data.name =~ "("`,
+		`data..name == 1`,
+		`header.type == other`,
+	}
+
+	for _, expr := range invalid {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) expected error", expr)
+		}
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	deep := ""
+	for i := 0; i < MaxDepth+2; i++ {
+		deep += "("
+	}
+	if _, err := Compile(deep + "header.a"); err == nil {
+		t.Error("Expected error for deeply nested expression")
+	}
+
+	long := make([]byte, MaxLength+1)
+	for i := range long {
+		long[i] = ' '
+	}
+	copy(long, "header.a")
+	if _, err := Compile(string(long)); err == nil {
+		t.Error("Expected error for overlong expression")
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+
+	f1, err := c.Get(`header.a == "1"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, _ := c.Get(`header.a == "1"`)
+	if f1 != f2 {
+		t.Error("Expected cached filter to be reused")
+	}
+
+	c.Get(`header.b == "1"`)
+	c.Get(`header.c == "1"`)
+	if c.Len() != 2 {
+		t.Errorf("Expected cache size 2, got %d", c.Len())
+	}
+
+	if _, err := c.Get(`header.a ==`); err == nil {
+		t.Error("Expected error for invalid expression")
+	}
+	if c.Len() != 2 {
+		t.Error("Invalid expressions must not be cached")
+	}
+}
@@ -0,0 +1,275 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '-' || c == '.'
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && strings.IndexByte(" \t\r\n", l.src[l.pos]) >= 0 {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case c == '"' || c == '\'':
+		return l.lexString(c)
+	case c == '-' || (c >= '0' && c <= '9'):
+		l.pos++
+		for l.pos < len(l.src) && strings.IndexByte("0123456789.eE+-", l.src[l.pos]) >= 0 {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}, nil
+	case isIdentStart(c):
+		for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	}
+
+	for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("filter: unexpected character %q at offset %d", c, start)
+}
+
+func (l *lexer) lexString(quote byte) (token, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			b.WriteByte(l.src[l.pos])
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: b.String(), pos: start}, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return token{}, fmt.Errorf("filter: unterminated string at offset %d", start)
+}
+
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("filter: "+format+" at offset %d", append(args, p.tok.pos)...)
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.err == nil && p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, p.err
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, p.err
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if depth > MaxDepth {
+		return nil, p.errorf("expression nested deeper than %d", MaxDepth)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	switch {
+	case p.isOp("!"):
+		p.next()
+		inner, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	case p.tok.kind == tokLParen:
+		p.next()
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected )")
+		}
+		p.next()
+		return inner, p.err
+	case p.tok.kind == tokIdent:
+		return p.parsePredicate()
+	case p.tok.kind == tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected %q", p.tok.text)
+}
+
+func (p *parser) parsePredicate() (node, error) {
+	f, err := p.parseField(p.tok.text)
+	if err != nil {
+		return nil, err
+	}
+	p.next()
+
+	if p.tok.kind != tokOp || p.tok.text == "&&" || p.tok.text == "||" || p.tok.text == "!" {
+		return existsNode{f}, p.err
+	}
+	op := p.tok.text
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	n := compareNode{field: f, op: op}
+	switch p.tok.kind {
+	case tokString:
+		n.lit = p.tok.text
+	case tokNumber:
+		v, err := strconv.ParseFloat(p.tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.tok.text)
+		}
+		n.lit = v
+	case tokIdent:
+		switch p.tok.text {
+		case "true":
+			n.lit = true
+		case "false":
+			n.lit = false
+		case "null":
+			n.lit = nil
+		default:
+			return nil, p.errorf("expected literal, got %q", p.tok.text)
+		}
+	default:
+		return nil, p.errorf("expected literal")
+	}
+
+	switch op {
+	case "=~":
+		s, ok := n.lit.(string)
+		if !ok {
+			return nil, p.errorf("=~ requires a string pattern")
+		}
+		if n.re, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("filter: invalid pattern %q: %v", s, err)
+		}
+	case "<", "<=", ">", ">=":
+		switch n.lit.(type) {
+		case string, float64:
+		default:
+			return nil, p.errorf("%s requires a string or number", op)
+		}
+	}
+
+	p.next()
+	return n, p.err
+}
+
+func (p *parser) parseField(text string) (field, error) {
+	root, rest, _ := strings.Cut(text, ".")
+	switch root {
+	case "header", "headers":
+		if rest == "" {
+			return field{}, p.errorf("missing header name")
+		}
+		return field{header: true, path: []string{rest}}, nil
+	case "data":
+		if rest == "" {
+			return field{}, nil
+		}
+		path := strings.Split(rest, ".")
+		for _, seg := range path {
+			if seg == "" {
+				return field{}, p.errorf("empty path segment in %q", text)
+			}
+		}
+		return field{path: path}, nil
+	}
+	return field{}, p.errorf("unknown field %q, expected header.<name> or data.<path>", text)
+}
@@ -9,7 +9,9 @@ package pb
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -22,9 +24,88 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type DiscardPolicy int32
+
+const (
+	// Remove the oldest events to make room for new ones.
+	DiscardPolicy_DISCARD_OLD DiscardPolicy = 0
+	// Reject publishes with RESOURCE_EXHAUSTED while the subject is full.
+	DiscardPolicy_DISCARD_NEW DiscardPolicy = 1
+)
+
+// Enum value maps for DiscardPolicy.
+var (
+	DiscardPolicy_name = map[int32]string{
+		0: "DISCARD_OLD",
+		1: "DISCARD_NEW",
+	}
+	DiscardPolicy_value = map[string]int32{
+		"DISCARD_OLD": 0,
+		"DISCARD_NEW": 1,
+	}
+)
+
+func (x DiscardPolicy) Enum() *DiscardPolicy {
+	p := new(DiscardPolicy)
+	*p = x
+	return p
+}
+
+func (x DiscardPolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DiscardPolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_pubsub_proto_enumTypes[0].Descriptor()
+}
+
+func (DiscardPolicy) Type() protoreflect.EnumType {
+	return &file_pubsub_proto_enumTypes[0]
+}
+
+func (x DiscardPolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DiscardPolicy.Descriptor instead.
+func (DiscardPolicy) EnumDescriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{0}
+}
+
 type SubscribeRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Optional filter expression evaluated by the server before delivery,
+	// e.g. `header.type == "order" && data.total > 100`.
+	Filter string `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	// Number of partitions of new events the server filters and prepares
+	// concurrently for this stream. Events are still written to the stream
+	// one at a time: those with the same value of partition_header keep
+	// publish order, those of different partitions may be interleaved.
+	// Requires partition_header when greater than 1; stored events that a
+	// subscription replays are always sent in order.
+	Concurrency     uint32 `protobuf:"varint,3,opt,name=concurrency,proto3" json:"concurrency,omitempty"`
+	PartitionHeader string `protobuf:"bytes,4,opt,name=partition_header,json=partitionHeader,proto3" json:"partition_header,omitempty"`
+	// Name of a durable consumer. The server remembers the last
+	// acknowledged sequence of the consumer on a persisted subject and
+	// resumes after it when the consumer subscribes again. A new consumer
+	// starts with the next published event.
+	Consumer string `protobuf:"bytes,5,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	// With consumer, events are acknowledged with Ack instead of as soon
+	// as they are sent.
+	ManualAck bool `protobuf:"varint,6,opt,name=manual_ack,json=manualAck,proto3" json:"manual_ack,omitempty"`
+	// Send heartbeat events while no event was sent for the server's
+	// heartbeat interval.
+	Heartbeats bool `protobuf:"varint,7,opt,name=heartbeats,proto3" json:"heartbeats,omitempty"`
+	// Token from the shutdown event of a previous subscription to key. The
+	// events the previous subscription had not received yet are replayed
+	// from the store before new ones. Only for persisted keys; durable
+	// consumers resume from their acknowledged sequence instead.
+	ResumeToken string `protobuf:"bytes,8,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	// Replays the events of a persisted key from this sequence on before
+	// new ones, e.g. after the last sequence a client received before its
+	// connection broke. Ignored with resume_token.
+	StartSequence uint64 `protobuf:"varint,9,opt,name=start_sequence,json=startSequence,proto3" json:"start_sequence,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -66,10 +147,92 @@ func (x *SubscribeRequest) GetKey() string {
 	return ""
 }
 
+func (x *SubscribeRequest) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetConcurrency() uint32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+func (x *SubscribeRequest) GetPartitionHeader() string {
+	if x != nil {
+		return x.PartitionHeader
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetConsumer() string {
+	if x != nil {
+		return x.Consumer
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetManualAck() bool {
+	if x != nil {
+		return x.ManualAck
+	}
+	return false
+}
+
+func (x *SubscribeRequest) GetHeartbeats() bool {
+	if x != nil {
+		return x.Heartbeats
+	}
+	return false
+}
+
+func (x *SubscribeRequest) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetStartSequence() uint64 {
+	if x != nil {
+		return x.StartSequence
+	}
+	return 0
+}
+
 type PublishRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Data          string                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Deprecated: use payload. Text payloads may still be sent here; data
+	// and payload must not both be set.
+	Data    string            `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Headers map[string]string `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Wait until the event has been sent to every subscriber stream it was
+	// enqueued for before responding.
+	WaitForDelivery bool `protobuf:"varint,4,opt,name=wait_for_delivery,json=waitForDelivery,proto3" json:"wait_for_delivery,omitempty"`
+	// Wait for space in full subscriber queues instead of dropping the
+	// event. Fails with RESOURCE_EXHAUSTED when the server's publish
+	// timeout expires and DEADLINE_EXCEEDED when the call's deadline does.
+	Block bool `protobuf:"varint,5,opt,name=block,proto3" json:"block,omitempty"`
+	// With block, succeed once this many subscribers queued the event.
+	// Zero means all matched subscribers.
+	Quorum uint32 `protobuf:"varint,6,opt,name=quorum,proto3" json:"quorum,omitempty"`
+	// Optional producer-assigned ID. Retries with the same ID within the
+	// server's deduplication window are acknowledged without redelivery.
+	MessageId string `protobuf:"bytes,7,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	// Entity key of the event. Compacted subjects keep only the latest
+	// event per key.
+	MessageKey string `protobuf:"bytes,8,opt,name=message_key,json=messageKey,proto3" json:"message_key,omitempty"`
+	// Marks the deletion of message_key on compacted subjects.
+	Tombstone bool `protobuf:"varint,9,opt,name=tombstone,proto3" json:"tombstone,omitempty"`
+	// Opaque event body, delivered to subscribers unchanged.
+	Payload []byte `protobuf:"bytes,10,opt,name=payload,proto3" json:"payload,omitempty"`
+	// MIME type of payload, e.g. application/json, application/x-protobuf,
+	// avro/binary or text/plain.
+	ContentType   string `protobuf:"bytes,11,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -118,27 +281,100 @@ func (x *PublishRequest) GetData() string {
 	return ""
 }
 
-type Event struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Data          string                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+func (x *PublishRequest) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *PublishRequest) GetWaitForDelivery() bool {
+	if x != nil {
+		return x.WaitForDelivery
+	}
+	return false
+}
+
+func (x *PublishRequest) GetBlock() bool {
+	if x != nil {
+		return x.Block
+	}
+	return false
+}
+
+func (x *PublishRequest) GetQuorum() uint32 {
+	if x != nil {
+		return x.Quorum
+	}
+	return 0
+}
+
+func (x *PublishRequest) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *PublishRequest) GetMessageKey() string {
+	if x != nil {
+		return x.MessageKey
+	}
+	return ""
+}
+
+func (x *PublishRequest) GetTombstone() bool {
+	if x != nil {
+		return x.Tombstone
+	}
+	return false
+}
+
+func (x *PublishRequest) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *PublishRequest) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+type PublishResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Subscribers whose filter accepted the event.
+	Matched uint32 `protobuf:"varint,1,opt,name=matched,proto3" json:"matched,omitempty"`
+	// Matched subscribers that queued the event.
+	Enqueued uint32 `protobuf:"varint,2,opt,name=enqueued,proto3" json:"enqueued,omitempty"`
+	// Matched subscribers whose queue was full.
+	Dropped uint32 `protobuf:"varint,3,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	// The message_id was already published; the event was not delivered
+	// again.
+	Duplicate bool `protobuf:"varint,4,opt,name=duplicate,proto3" json:"duplicate,omitempty"`
+	// Sequence assigned to the event when the subject is persisted.
+	Sequence      uint64 `protobuf:"varint,5,opt,name=sequence,proto3" json:"sequence,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Event) Reset() {
-	*x = Event{}
+func (x *PublishResponse) Reset() {
+	*x = PublishResponse{}
 	mi := &file_pubsub_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Event) String() string {
+func (x *PublishResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Event) ProtoMessage() {}
+func (*PublishResponse) ProtoMessage() {}
 
-func (x *Event) ProtoReflect() protoreflect.Message {
+func (x *PublishResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_pubsub_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -150,82 +386,2408 @@ func (x *Event) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Event.ProtoReflect.Descriptor instead.
-func (*Event) Descriptor() ([]byte, []int) {
+// Deprecated: Use PublishResponse.ProtoReflect.Descriptor instead.
+func (*PublishResponse) Descriptor() ([]byte, []int) {
 	return file_pubsub_proto_rawDescGZIP(), []int{2}
 }
 
-func (x *Event) GetData() string {
+func (x *PublishResponse) GetMatched() uint32 {
 	if x != nil {
-		return x.Data
+		return x.Matched
 	}
-	return ""
+	return 0
 }
 
-var File_pubsub_proto protoreflect.FileDescriptor
+func (x *PublishResponse) GetEnqueued() uint32 {
+	if x != nil {
+		return x.Enqueued
+	}
+	return 0
+}
 
-const file_pubsub_proto_rawDesc = "" +
-	"\n" +
-	"\fpubsub.proto\x1a\x1bgoogle/protobuf/empty.proto\"$\n" +
-	"\x10SubscribeRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"6\n" +
-	"\x0ePublishRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
-	"\x04data\x18\x02 \x01(\tR\x04data\"\x1b\n" +
-	"\x05Event\x12\x12\n" +
-	"\x04data\x18\x01 \x01(\tR\x04data2f\n" +
-	"\x06PubSub\x12(\n" +
-	"\tSubscribe\x12\x11.SubscribeRequest\x1a\x06.Event0\x01\x122\n" +
-	"\aPublish\x12\x0f.PublishRequest\x1a\x16.google.protobuf.EmptyB'Z%github.com/StepanErshov/pubsub/pkg/pbb\x06proto3"
+func (x *PublishResponse) GetDropped() uint32 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
 
-var (
-	file_pubsub_proto_rawDescOnce sync.Once
-	file_pubsub_proto_rawDescData []byte
-)
+func (x *PublishResponse) GetDuplicate() bool {
+	if x != nil {
+		return x.Duplicate
+	}
+	return false
+}
 
-func file_pubsub_proto_rawDescGZIP() []byte {
-	file_pubsub_proto_rawDescOnce.Do(func() {
-		file_pubsub_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pubsub_proto_rawDesc), len(file_pubsub_proto_rawDesc)))
-	})
-	return file_pubsub_proto_rawDescData
+func (x *PublishResponse) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
 }
 
-var file_pubsub_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
-var file_pubsub_proto_goTypes = []any{
-	(*SubscribeRequest)(nil), // 0: SubscribeRequest
-	(*PublishRequest)(nil),   // 1: PublishRequest
-	(*Event)(nil),            // 2: Event
-	(*emptypb.Empty)(nil),    // 3: google.protobuf.Empty
+type PublishBatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Events to publish in order. quorum is ignored.
+	Messages []*PublishRequest `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	// Publish all events or none: they are persisted and queued together
+	// and become visible to subscribers at the same time, and subscribers
+	// of different keys observe atomic batches in the same order. Fails
+	// with RESOURCE_EXHAUSTED when a queue or subject cannot take the
+	// whole batch. Without atomic each event succeeds or fails on its own
+	// and failures are listed in the response.
+	Atomic bool `protobuf:"varint,2,opt,name=atomic,proto3" json:"atomic,omitempty"`
+	// Like the fields of PublishRequest; they apply to every event.
+	WaitForDelivery bool `protobuf:"varint,3,opt,name=wait_for_delivery,json=waitForDelivery,proto3" json:"wait_for_delivery,omitempty"`
+	Block           bool `protobuf:"varint,4,opt,name=block,proto3" json:"block,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
-var file_pubsub_proto_depIdxs = []int32{
-	0, // 0: PubSub.Subscribe:input_type -> SubscribeRequest
-	1, // 1: PubSub.Publish:input_type -> PublishRequest
-	2, // 2: PubSub.Subscribe:output_type -> Event
-	3, // 3: PubSub.Publish:output_type -> google.protobuf.Empty
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+
+func (x *PublishBatchRequest) Reset() {
+	*x = PublishBatchRequest{}
+	mi := &file_pubsub_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func init() { file_pubsub_proto_init() }
-func file_pubsub_proto_init() {
-	if File_pubsub_proto != nil {
-		return
+func (x *PublishBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishBatchRequest) ProtoMessage() {}
+
+func (x *PublishBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishBatchRequest.ProtoReflect.Descriptor instead.
+func (*PublishBatchRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PublishBatchRequest) GetMessages() []*PublishRequest {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *PublishBatchRequest) GetAtomic() bool {
+	if x != nil {
+		return x.Atomic
+	}
+	return false
+}
+
+func (x *PublishBatchRequest) GetWaitForDelivery() bool {
+	if x != nil {
+		return x.WaitForDelivery
+	}
+	return false
+}
+
+func (x *PublishBatchRequest) GetBlock() bool {
+	if x != nil {
+		return x.Block
+	}
+	return false
+}
+
+type PublishBatchResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One result per event, in request order.
+	Results []*PublishResponse `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	// Events that failed without atomic. Their results are empty.
+	Errors        []*PublishError `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishBatchResponse) Reset() {
+	*x = PublishBatchResponse{}
+	mi := &file_pubsub_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishBatchResponse) ProtoMessage() {}
+
+func (x *PublishBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishBatchResponse.ProtoReflect.Descriptor instead.
+func (*PublishBatchResponse) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PublishBatchResponse) GetResults() []*PublishResponse {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *PublishBatchResponse) GetErrors() []*PublishError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type PublishError struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Position of the event in the batch or stream.
+	Index uint32 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	// A google.rpc.Code value, as Publish would have returned it.
+	Code          int32  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishError) Reset() {
+	*x = PublishError{}
+	mi := &file_pubsub_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishError) ProtoMessage() {}
+
+func (x *PublishError) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishError.ProtoReflect.Descriptor instead.
+func (*PublishError) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PublishError) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *PublishError) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *PublishError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type PublishStreamResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Events published, not counting duplicates.
+	Published     uint64          `protobuf:"varint,1,opt,name=published,proto3" json:"published,omitempty"`
+	Duplicates    uint64          `protobuf:"varint,2,opt,name=duplicates,proto3" json:"duplicates,omitempty"`
+	Errors        []*PublishError `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishStreamResponse) Reset() {
+	*x = PublishStreamResponse{}
+	mi := &file_pubsub_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishStreamResponse) ProtoMessage() {}
+
+func (x *PublishStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishStreamResponse.ProtoReflect.Descriptor instead.
+func (*PublishStreamResponse) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PublishStreamResponse) GetPublished() uint64 {
+	if x != nil {
+		return x.Published
+	}
+	return 0
+}
+
+func (x *PublishStreamResponse) GetDuplicates() uint64 {
+	if x != nil {
+		return x.Duplicates
+	}
+	return 0
+}
+
+func (x *PublishStreamResponse) GetErrors() []*PublishError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type AckRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Consumer      string                 `protobuf:"bytes,1,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Sequence      uint64                 `protobuf:"varint,3,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AckRequest) Reset() {
+	*x = AckRequest{}
+	mi := &file_pubsub_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AckRequest) ProtoMessage() {}
+
+func (x *AckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckRequest.ProtoReflect.Descriptor instead.
+func (*AckRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AckRequest) GetConsumer() string {
+	if x != nil {
+		return x.Consumer
+	}
+	return ""
+}
+
+func (x *AckRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *AckRequest) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+type FetchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Durable consumer to fetch for. Fetched events have to be acknowledged
+	// with Ack within ack_wait or they are returned again by a later Fetch.
+	// Without a consumer events are read from start_sequence on and
+	// nothing is tracked.
+	Consumer string `protobuf:"bytes,2,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	// Zero means 100.
+	MaxMessages uint32 `protobuf:"varint,3,opt,name=max_messages,json=maxMessages,proto3" json:"max_messages,omitempty"`
+	// How long to wait when no event is available. Zero returns at once.
+	MaxWait *durationpb.Duration `protobuf:"bytes,4,opt,name=max_wait,json=maxWait,proto3" json:"max_wait,omitempty"`
+	// Zero means 30 seconds.
+	AckWait       *durationpb.Duration `protobuf:"bytes,5,opt,name=ack_wait,json=ackWait,proto3" json:"ack_wait,omitempty"`
+	StartSequence uint64               `protobuf:"varint,6,opt,name=start_sequence,json=startSequence,proto3" json:"start_sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetchRequest) Reset() {
+	*x = FetchRequest{}
+	mi := &file_pubsub_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetchRequest) ProtoMessage() {}
+
+func (x *FetchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetchRequest.ProtoReflect.Descriptor instead.
+func (*FetchRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FetchRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *FetchRequest) GetConsumer() string {
+	if x != nil {
+		return x.Consumer
+	}
+	return ""
+}
+
+func (x *FetchRequest) GetMaxMessages() uint32 {
+	if x != nil {
+		return x.MaxMessages
+	}
+	return 0
+}
+
+func (x *FetchRequest) GetMaxWait() *durationpb.Duration {
+	if x != nil {
+		return x.MaxWait
+	}
+	return nil
+}
+
+func (x *FetchRequest) GetAckWait() *durationpb.Duration {
+	if x != nil {
+		return x.AckWait
+	}
+	return nil
+}
+
+func (x *FetchRequest) GetStartSequence() uint64 {
+	if x != nil {
+		return x.StartSequence
+	}
+	return 0
+}
+
+type FetchResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Events []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	// Sequence to pass as start_sequence to fetch the following events.
+	NextSequence  uint64 `protobuf:"varint,2,opt,name=next_sequence,json=nextSequence,proto3" json:"next_sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetchResponse) Reset() {
+	*x = FetchResponse{}
+	mi := &file_pubsub_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetchResponse) ProtoMessage() {}
+
+func (x *FetchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetchResponse.ProtoReflect.Descriptor instead.
+func (*FetchResponse) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *FetchResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *FetchResponse) GetNextSequence() uint64 {
+	if x != nil {
+		return x.NextSequence
+	}
+	return 0
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Deprecated: use payload. Set as well for events without content_type
+	// whose payload is valid UTF-8, so that clients reading data keep
+	// working.
+	Data       string            `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Headers    map[string]string `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	MessageKey string            `protobuf:"bytes,3,opt,name=message_key,json=messageKey,proto3" json:"message_key,omitempty"`
+	Tombstone  bool              `protobuf:"varint,4,opt,name=tombstone,proto3" json:"tombstone,omitempty"`
+	// Sequence of the event on persisted subjects, zero otherwise.
+	Sequence    uint64 `protobuf:"varint,5,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Payload     []byte `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"`
+	ContentType string `protobuf:"bytes,7,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// Set on heartbeat events, which carry nothing else.
+	Heartbeat *Heartbeat `protobuf:"bytes,8,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
+	// Set on the last event of a stream before the server shuts down. The
+	// stream then ends with UNAVAILABLE.
+	Shutdown      *Shutdown `protobuf:"bytes,9,opt,name=shutdown,proto3" json:"shutdown,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_pubsub_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Event) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+func (x *Event) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *Event) GetMessageKey() string {
+	if x != nil {
+		return x.MessageKey
+	}
+	return ""
+}
+
+func (x *Event) GetTombstone() bool {
+	if x != nil {
+		return x.Tombstone
+	}
+	return false
+}
+
+func (x *Event) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Event) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Event) GetHeartbeat() *Heartbeat {
+	if x != nil {
+		return x.Heartbeat
+	}
+	return nil
+}
+
+func (x *Event) GetShutdown() *Shutdown {
+	if x != nil {
+		return x.Shutdown
+	}
+	return nil
+}
+
+type Shutdown struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Pass as resume_token to continue where the stream stopped. Empty
+	// when the key is not persisted or for durable consumers.
+	ResumeToken   string `protobuf:"bytes,1,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Shutdown) Reset() {
+	*x = Shutdown{}
+	mi := &file_pubsub_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Shutdown) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Shutdown) ProtoMessage() {}
+
+func (x *Shutdown) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Shutdown.ProtoReflect.Descriptor instead.
+func (*Shutdown) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Shutdown) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+type Heartbeat struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Last sequence of the subject when it is persisted. A subscriber that
+	// received a lower sequence last has missed events, unless they were
+	// filtered out.
+	LastSequence  uint64                 `protobuf:"varint,1,opt,name=last_sequence,json=lastSequence,proto3" json:"last_sequence,omitempty"`
+	ServerTime    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=server_time,json=serverTime,proto3" json:"server_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Heartbeat) Reset() {
+	*x = Heartbeat{}
+	mi := &file_pubsub_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heartbeat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heartbeat) ProtoMessage() {}
+
+func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
+func (*Heartbeat) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Heartbeat) GetLastSequence() uint64 {
+	if x != nil {
+		return x.LastSequence
+	}
+	return 0
+}
+
+func (x *Heartbeat) GetServerTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ServerTime
+	}
+	return nil
+}
+
+type ClientFrame struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Command:
+	//
+	//	*ClientFrame_Subscribe
+	//	*ClientFrame_Unsubscribe
+	//	*ClientFrame_Ack
+	//	*ClientFrame_Pause
+	//	*ClientFrame_Resume
+	Command       isClientFrame_Command `protobuf_oneof:"command"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClientFrame) Reset() {
+	*x = ClientFrame{}
+	mi := &file_pubsub_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientFrame) ProtoMessage() {}
+
+func (x *ClientFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientFrame.ProtoReflect.Descriptor instead.
+func (*ClientFrame) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ClientFrame) GetCommand() isClientFrame_Command {
+	if x != nil {
+		return x.Command
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetSubscribe() *SubscribeCommand {
+	if x != nil {
+		if x, ok := x.Command.(*ClientFrame_Subscribe); ok {
+			return x.Subscribe
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetUnsubscribe() *UnsubscribeCommand {
+	if x != nil {
+		if x, ok := x.Command.(*ClientFrame_Unsubscribe); ok {
+			return x.Unsubscribe
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetAck() *AckCommand {
+	if x != nil {
+		if x, ok := x.Command.(*ClientFrame_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetPause() *PauseCommand {
+	if x != nil {
+		if x, ok := x.Command.(*ClientFrame_Pause); ok {
+			return x.Pause
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetResume() *ResumeCommand {
+	if x != nil {
+		if x, ok := x.Command.(*ClientFrame_Resume); ok {
+			return x.Resume
+		}
+	}
+	return nil
+}
+
+type isClientFrame_Command interface {
+	isClientFrame_Command()
+}
+
+type ClientFrame_Subscribe struct {
+	Subscribe *SubscribeCommand `protobuf:"bytes,1,opt,name=subscribe,proto3,oneof"`
+}
+
+type ClientFrame_Unsubscribe struct {
+	Unsubscribe *UnsubscribeCommand `protobuf:"bytes,2,opt,name=unsubscribe,proto3,oneof"`
+}
+
+type ClientFrame_Ack struct {
+	Ack *AckCommand `protobuf:"bytes,3,opt,name=ack,proto3,oneof"`
+}
+
+type ClientFrame_Pause struct {
+	Pause *PauseCommand `protobuf:"bytes,4,opt,name=pause,proto3,oneof"`
+}
+
+type ClientFrame_Resume struct {
+	Resume *ResumeCommand `protobuf:"bytes,5,opt,name=resume,proto3,oneof"`
+}
+
+func (*ClientFrame_Subscribe) isClientFrame_Command() {}
+
+func (*ClientFrame_Unsubscribe) isClientFrame_Command() {}
+
+func (*ClientFrame_Ack) isClientFrame_Command() {}
+
+func (*ClientFrame_Pause) isClientFrame_Command() {}
+
+func (*ClientFrame_Resume) isClientFrame_Command() {}
+
+type SubscribeCommand struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Client-chosen ID, unique within the connection.
+	Id            string            `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Request       *SubscribeRequest `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeCommand) Reset() {
+	*x = SubscribeCommand{}
+	mi := &file_pubsub_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeCommand) ProtoMessage() {}
+
+func (x *SubscribeCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeCommand.ProtoReflect.Descriptor instead.
+func (*SubscribeCommand) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SubscribeCommand) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SubscribeCommand) GetRequest() *SubscribeRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type UnsubscribeCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnsubscribeCommand) Reset() {
+	*x = UnsubscribeCommand{}
+	mi := &file_pubsub_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnsubscribeCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnsubscribeCommand) ProtoMessage() {}
+
+func (x *UnsubscribeCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnsubscribeCommand.ProtoReflect.Descriptor instead.
+func (*UnsubscribeCommand) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *UnsubscribeCommand) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// AckCommand acknowledges the events of a durable subscription with
+// manual_ack up to and including sequence.
+type AckCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Sequence      uint64                 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AckCommand) Reset() {
+	*x = AckCommand{}
+	mi := &file_pubsub_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AckCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AckCommand) ProtoMessage() {}
+
+func (x *AckCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckCommand.ProtoReflect.Descriptor instead.
+func (*AckCommand) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AckCommand) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AckCommand) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+// PauseCommand stops sending events of a subscription until it is
+// resumed. Durable subscriptions continue where they stopped; other
+// subscriptions queue events on the server and drop them once the queue
+// is full, like a slow subscriber.
+type PauseCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseCommand) Reset() {
+	*x = PauseCommand{}
+	mi := &file_pubsub_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseCommand) ProtoMessage() {}
+
+func (x *PauseCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseCommand.ProtoReflect.Descriptor instead.
+func (*PauseCommand) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PauseCommand) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ResumeCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeCommand) Reset() {
+	*x = ResumeCommand{}
+	mi := &file_pubsub_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeCommand) ProtoMessage() {}
+
+func (x *ResumeCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeCommand.ProtoReflect.Descriptor instead.
+func (*ResumeCommand) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ResumeCommand) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ServerFrame struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Subscription the frame belongs to.
+	SubscriptionId string `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+	// Types that are valid to be assigned to Frame:
+	//
+	//	*ServerFrame_Event
+	//	*ServerFrame_Error
+	//	*ServerFrame_Subscribed
+	//	*ServerFrame_Shutdown
+	Frame         isServerFrame_Frame `protobuf_oneof:"frame"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerFrame) Reset() {
+	*x = ServerFrame{}
+	mi := &file_pubsub_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerFrame) ProtoMessage() {}
+
+func (x *ServerFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerFrame.ProtoReflect.Descriptor instead.
+func (*ServerFrame) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ServerFrame) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+func (x *ServerFrame) GetFrame() isServerFrame_Frame {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+func (x *ServerFrame) GetEvent() *Event {
+	if x != nil {
+		if x, ok := x.Frame.(*ServerFrame_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+func (x *ServerFrame) GetError() *FrameError {
+	if x != nil {
+		if x, ok := x.Frame.(*ServerFrame_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+func (x *ServerFrame) GetSubscribed() *Subscribed {
+	if x != nil {
+		if x, ok := x.Frame.(*ServerFrame_Subscribed); ok {
+			return x.Subscribed
+		}
+	}
+	return nil
+}
+
+func (x *ServerFrame) GetShutdown() *Shutdown {
+	if x != nil {
+		if x, ok := x.Frame.(*ServerFrame_Shutdown); ok {
+			return x.Shutdown
+		}
+	}
+	return nil
+}
+
+type isServerFrame_Frame interface {
+	isServerFrame_Frame()
+}
+
+type ServerFrame_Event struct {
+	Event *Event `protobuf:"bytes,2,opt,name=event,proto3,oneof"`
+}
+
+type ServerFrame_Error struct {
+	// A command failed or the subscription ended with an error.
+	Error *FrameError `protobuf:"bytes,3,opt,name=error,proto3,oneof"`
+}
+
+type ServerFrame_Subscribed struct {
+	// The subscription is registered; it precedes its events.
+	Subscribed *Subscribed `protobuf:"bytes,4,opt,name=subscribed,proto3,oneof"`
+}
+
+type ServerFrame_Shutdown struct {
+	// The server is shutting down; sent for every subscription before
+	// the stream ends with UNAVAILABLE.
+	Shutdown *Shutdown `protobuf:"bytes,5,opt,name=shutdown,proto3,oneof"`
+}
+
+func (*ServerFrame_Event) isServerFrame_Frame() {}
+
+func (*ServerFrame_Error) isServerFrame_Frame() {}
+
+func (*ServerFrame_Subscribed) isServerFrame_Frame() {}
+
+func (*ServerFrame_Shutdown) isServerFrame_Frame() {}
+
+// Subscribed confirms a subscription. Subscribe sends the same values in
+// the response headers pubsub-subscription-id, pubsub-start-sequence and
+// pubsub-server-time (RFC 3339).
+type Subscribed struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// On persisted subjects, events from this sequence on are delivered.
+	// Zero otherwise.
+	StartSequence uint64                 `protobuf:"varint,1,opt,name=start_sequence,json=startSequence,proto3" json:"start_sequence,omitempty"`
+	ServerTime    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=server_time,json=serverTime,proto3" json:"server_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Subscribed) Reset() {
+	*x = Subscribed{}
+	mi := &file_pubsub_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Subscribed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subscribed) ProtoMessage() {}
+
+func (x *Subscribed) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subscribed.ProtoReflect.Descriptor instead.
+func (*Subscribed) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *Subscribed) GetStartSequence() uint64 {
+	if x != nil {
+		return x.StartSequence
+	}
+	return 0
+}
+
+func (x *Subscribed) GetServerTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ServerTime
+	}
+	return nil
+}
+
+type FrameError struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// A google.rpc.Code value, as Subscribe would have returned it.
+	Code    int32  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// The subscription no longer exists and its ID may be reused.
+	Closed        bool `protobuf:"varint,3,opt,name=closed,proto3" json:"closed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FrameError) Reset() {
+	*x = FrameError{}
+	mi := &file_pubsub_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FrameError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FrameError) ProtoMessage() {}
+
+func (x *FrameError) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FrameError.ProtoReflect.Descriptor instead.
+func (*FrameError) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *FrameError) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *FrameError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *FrameError) GetClosed() bool {
+	if x != nil {
+		return x.Closed
+	}
+	return false
+}
+
+type ListSubjectsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSubjectsRequest) Reset() {
+	*x = ListSubjectsRequest{}
+	mi := &file_pubsub_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSubjectsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSubjectsRequest) ProtoMessage() {}
+
+func (x *ListSubjectsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSubjectsRequest.ProtoReflect.Descriptor instead.
+func (*ListSubjectsRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{22}
+}
+
+type ListSubjectsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subjects      []*SubjectInfo         `protobuf:"bytes,1,rep,name=subjects,proto3" json:"subjects,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSubjectsResponse) Reset() {
+	*x = ListSubjectsResponse{}
+	mi := &file_pubsub_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSubjectsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSubjectsResponse) ProtoMessage() {}
+
+func (x *ListSubjectsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSubjectsResponse.ProtoReflect.Descriptor instead.
+func (*ListSubjectsResponse) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ListSubjectsResponse) GetSubjects() []*SubjectInfo {
+	if x != nil {
+		return x.Subjects
+	}
+	return nil
+}
+
+type RetentionPolicy struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Configured subject pattern the policy comes from.
+	Pattern            string               `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	Compact            bool                 `protobuf:"varint,2,opt,name=compact,proto3" json:"compact,omitempty"`
+	TombstoneRetention *durationpb.Duration `protobuf:"bytes,3,opt,name=tombstone_retention,json=tombstoneRetention,proto3" json:"tombstone_retention,omitempty"`
+	// Zero values mean no limit.
+	MaxAge        *durationpb.Duration `protobuf:"bytes,4,opt,name=max_age,json=maxAge,proto3" json:"max_age,omitempty"`
+	MaxMessages   uint64               `protobuf:"varint,5,opt,name=max_messages,json=maxMessages,proto3" json:"max_messages,omitempty"`
+	MaxBytes      uint64               `protobuf:"varint,6,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	Discard       DiscardPolicy        `protobuf:"varint,7,opt,name=discard,proto3,enum=DiscardPolicy" json:"discard,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RetentionPolicy) Reset() {
+	*x = RetentionPolicy{}
+	mi := &file_pubsub_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RetentionPolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RetentionPolicy) ProtoMessage() {}
+
+func (x *RetentionPolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RetentionPolicy.ProtoReflect.Descriptor instead.
+func (*RetentionPolicy) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *RetentionPolicy) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *RetentionPolicy) GetCompact() bool {
+	if x != nil {
+		return x.Compact
+	}
+	return false
+}
+
+func (x *RetentionPolicy) GetTombstoneRetention() *durationpb.Duration {
+	if x != nil {
+		return x.TombstoneRetention
+	}
+	return nil
+}
+
+func (x *RetentionPolicy) GetMaxAge() *durationpb.Duration {
+	if x != nil {
+		return x.MaxAge
+	}
+	return nil
+}
+
+func (x *RetentionPolicy) GetMaxMessages() uint64 {
+	if x != nil {
+		return x.MaxMessages
+	}
+	return 0
+}
+
+func (x *RetentionPolicy) GetMaxBytes() uint64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+func (x *RetentionPolicy) GetDiscard() DiscardPolicy {
+	if x != nil {
+		return x.Discard
+	}
+	return DiscardPolicy_DISCARD_OLD
+}
+
+type SubjectInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subject       string                 `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	Retention     *RetentionPolicy       `protobuf:"bytes,2,opt,name=retention,proto3" json:"retention,omitempty"`
+	FirstSequence uint64                 `protobuf:"varint,3,opt,name=first_sequence,json=firstSequence,proto3" json:"first_sequence,omitempty"`
+	LastSequence  uint64                 `protobuf:"varint,4,opt,name=last_sequence,json=lastSequence,proto3" json:"last_sequence,omitempty"`
+	Messages      uint64                 `protobuf:"varint,5,opt,name=messages,proto3" json:"messages,omitempty"`
+	Bytes         uint64                 `protobuf:"varint,6,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Segments      uint32                 `protobuf:"varint,7,opt,name=segments,proto3" json:"segments,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubjectInfo) Reset() {
+	*x = SubjectInfo{}
+	mi := &file_pubsub_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubjectInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubjectInfo) ProtoMessage() {}
+
+func (x *SubjectInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubjectInfo.ProtoReflect.Descriptor instead.
+func (*SubjectInfo) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *SubjectInfo) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *SubjectInfo) GetRetention() *RetentionPolicy {
+	if x != nil {
+		return x.Retention
+	}
+	return nil
+}
+
+func (x *SubjectInfo) GetFirstSequence() uint64 {
+	if x != nil {
+		return x.FirstSequence
+	}
+	return 0
+}
+
+func (x *SubjectInfo) GetLastSequence() uint64 {
+	if x != nil {
+		return x.LastSequence
+	}
+	return 0
+}
+
+func (x *SubjectInfo) GetMessages() uint64 {
+	if x != nil {
+		return x.Messages
+	}
+	return 0
+}
+
+func (x *SubjectInfo) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *SubjectInfo) GetSegments() uint32 {
+	if x != nil {
+		return x.Segments
+	}
+	return 0
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_pubsub_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{26}
+}
+
+type Stats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subjects      uint32                 `protobuf:"varint,1,opt,name=subjects,proto3" json:"subjects,omitempty"`
+	Subscriptions uint32                 `protobuf:"varint,2,opt,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	Published     uint64                 `protobuf:"varint,3,opt,name=published,proto3" json:"published,omitempty"`
+	Enqueued      uint64                 `protobuf:"varint,4,opt,name=enqueued,proto3" json:"enqueued,omitempty"`
+	Dropped       uint64                 `protobuf:"varint,5,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	Duplicates    uint64                 `protobuf:"varint,6,opt,name=duplicates,proto3" json:"duplicates,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_pubsub_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *Stats) GetSubjects() uint32 {
+	if x != nil {
+		return x.Subjects
+	}
+	return 0
+}
+
+func (x *Stats) GetSubscriptions() uint32 {
+	if x != nil {
+		return x.Subscriptions
+	}
+	return 0
+}
+
+func (x *Stats) GetPublished() uint64 {
+	if x != nil {
+		return x.Published
+	}
+	return 0
+}
+
+func (x *Stats) GetEnqueued() uint64 {
+	if x != nil {
+		return x.Enqueued
+	}
+	return 0
+}
+
+func (x *Stats) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *Stats) GetDuplicates() uint64 {
+	if x != nil {
+		return x.Duplicates
+	}
+	return 0
+}
+
+type ConsumerInfo struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Name        string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Subject     string                 `protobuf:"bytes,2,opt,name=subject,proto3" json:"subject,omitempty"`
+	AckSequence uint64                 `protobuf:"varint,3,opt,name=ack_sequence,json=ackSequence,proto3" json:"ack_sequence,omitempty"`
+	Updated     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated,proto3" json:"updated,omitempty"`
+	// Events after ack_sequence that are still retained.
+	Pending uint64 `protobuf:"varint,5,opt,name=pending,proto3" json:"pending,omitempty"`
+	// Age of the oldest pending event.
+	Lag           *durationpb.Duration `protobuf:"bytes,6,opt,name=lag,proto3" json:"lag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConsumerInfo) Reset() {
+	*x = ConsumerInfo{}
+	mi := &file_pubsub_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConsumerInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConsumerInfo) ProtoMessage() {}
+
+func (x *ConsumerInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConsumerInfo.ProtoReflect.Descriptor instead.
+func (*ConsumerInfo) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ConsumerInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ConsumerInfo) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *ConsumerInfo) GetAckSequence() uint64 {
+	if x != nil {
+		return x.AckSequence
+	}
+	return 0
+}
+
+func (x *ConsumerInfo) GetUpdated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Updated
+	}
+	return nil
+}
+
+func (x *ConsumerInfo) GetPending() uint64 {
+	if x != nil {
+		return x.Pending
+	}
+	return 0
+}
+
+func (x *ConsumerInfo) GetLag() *durationpb.Duration {
+	if x != nil {
+		return x.Lag
+	}
+	return nil
+}
+
+type ListConsumersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Optional subject to list the consumers of.
+	Subject       string `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConsumersRequest) Reset() {
+	*x = ListConsumersRequest{}
+	mi := &file_pubsub_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConsumersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConsumersRequest) ProtoMessage() {}
+
+func (x *ListConsumersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConsumersRequest.ProtoReflect.Descriptor instead.
+func (*ListConsumersRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *ListConsumersRequest) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+type ListConsumersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Consumers     []*ConsumerInfo        `protobuf:"bytes,1,rep,name=consumers,proto3" json:"consumers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConsumersResponse) Reset() {
+	*x = ListConsumersResponse{}
+	mi := &file_pubsub_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConsumersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConsumersResponse) ProtoMessage() {}
+
+func (x *ListConsumersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConsumersResponse.ProtoReflect.Descriptor instead.
+func (*ListConsumersResponse) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ListConsumersResponse) GetConsumers() []*ConsumerInfo {
+	if x != nil {
+		return x.Consumers
+	}
+	return nil
+}
+
+type ResetConsumerRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Consumer string                 `protobuf:"bytes,1,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	Subject  string                 `protobuf:"bytes,2,opt,name=subject,proto3" json:"subject,omitempty"`
+	// Types that are valid to be assigned to Position:
+	//
+	//	*ResetConsumerRequest_Sequence
+	//	*ResetConsumerRequest_Time
+	Position      isResetConsumerRequest_Position `protobuf_oneof:"position"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetConsumerRequest) Reset() {
+	*x = ResetConsumerRequest{}
+	mi := &file_pubsub_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetConsumerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetConsumerRequest) ProtoMessage() {}
+
+func (x *ResetConsumerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetConsumerRequest.ProtoReflect.Descriptor instead.
+func (*ResetConsumerRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *ResetConsumerRequest) GetConsumer() string {
+	if x != nil {
+		return x.Consumer
+	}
+	return ""
+}
+
+func (x *ResetConsumerRequest) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *ResetConsumerRequest) GetPosition() isResetConsumerRequest_Position {
+	if x != nil {
+		return x.Position
+	}
+	return nil
+}
+
+func (x *ResetConsumerRequest) GetSequence() uint64 {
+	if x != nil {
+		if x, ok := x.Position.(*ResetConsumerRequest_Sequence); ok {
+			return x.Sequence
+		}
+	}
+	return 0
+}
+
+func (x *ResetConsumerRequest) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		if x, ok := x.Position.(*ResetConsumerRequest_Time); ok {
+			return x.Time
+		}
+	}
+	return nil
+}
+
+type isResetConsumerRequest_Position interface {
+	isResetConsumerRequest_Position()
+}
+
+type ResetConsumerRequest_Sequence struct {
+	// Sequence of the next event to deliver.
+	Sequence uint64 `protobuf:"varint,3,opt,name=sequence,proto3,oneof"`
+}
+
+type ResetConsumerRequest_Time struct {
+	// Deliver from the first event stored at or after this time.
+	Time *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3,oneof"`
+}
+
+func (*ResetConsumerRequest_Sequence) isResetConsumerRequest_Position() {}
+
+func (*ResetConsumerRequest_Time) isResetConsumerRequest_Position() {}
+
+type DeleteConsumerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Consumer      string                 `protobuf:"bytes,1,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	Subject       string                 `protobuf:"bytes,2,opt,name=subject,proto3" json:"subject,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteConsumerRequest) Reset() {
+	*x = DeleteConsumerRequest{}
+	mi := &file_pubsub_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteConsumerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteConsumerRequest) ProtoMessage() {}
+
+func (x *DeleteConsumerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pubsub_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteConsumerRequest.ProtoReflect.Descriptor instead.
+func (*DeleteConsumerRequest) Descriptor() ([]byte, []int) {
+	return file_pubsub_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *DeleteConsumerRequest) GetConsumer() string {
+	if x != nil {
+		return x.Consumer
+	}
+	return ""
+}
+
+func (x *DeleteConsumerRequest) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+var File_pubsub_proto protoreflect.FileDescriptor
+
+const file_pubsub_proto_rawDesc = "" +
+	"\n" +
+	"\fpubsub.proto\x1a\x1egoogle/protobuf/duration.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xae\x02\n" +
+	"\x10SubscribeRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x16\n" +
+	"\x06filter\x18\x02 \x01(\tR\x06filter\x12 \n" +
+	"\vconcurrency\x18\x03 \x01(\rR\vconcurrency\x12)\n" +
+	"\x10partition_header\x18\x04 \x01(\tR\x0fpartitionHeader\x12\x1a\n" +
+	"\bconsumer\x18\x05 \x01(\tR\bconsumer\x12\x1d\n" +
+	"\n" +
+	"manual_ack\x18\x06 \x01(\bR\tmanualAck\x12\x1e\n" +
+	"\n" +
+	"heartbeats\x18\a \x01(\bR\n" +
+	"heartbeats\x12!\n" +
+	"\fresume_token\x18\b \x01(\tR\vresumeToken\x12%\n" +
+	"\x0estart_sequence\x18\t \x01(\x04R\rstartSequence\"\x9f\x03\n" +
+	"\x0ePublishRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\tR\x04data\x126\n" +
+	"\aheaders\x18\x03 \x03(\v2\x1c.PublishRequest.HeadersEntryR\aheaders\x12*\n" +
+	"\x11wait_for_delivery\x18\x04 \x01(\bR\x0fwaitForDelivery\x12\x14\n" +
+	"\x05block\x18\x05 \x01(\bR\x05block\x12\x16\n" +
+	"\x06quorum\x18\x06 \x01(\rR\x06quorum\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\a \x01(\tR\tmessageId\x12\x1f\n" +
+	"\vmessage_key\x18\b \x01(\tR\n" +
+	"messageKey\x12\x1c\n" +
+	"\ttombstone\x18\t \x01(\bR\ttombstone\x12\x18\n" +
+	"\apayload\x18\n" +
+	" \x01(\fR\apayload\x12!\n" +
+	"\fcontent_type\x18\v \x01(\tR\vcontentType\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x9b\x01\n" +
+	"\x0fPublishResponse\x12\x18\n" +
+	"\amatched\x18\x01 \x01(\rR\amatched\x12\x1a\n" +
+	"\benqueued\x18\x02 \x01(\rR\benqueued\x12\x18\n" +
+	"\adropped\x18\x03 \x01(\rR\adropped\x12\x1c\n" +
+	"\tduplicate\x18\x04 \x01(\bR\tduplicate\x12\x1a\n" +
+	"\bsequence\x18\x05 \x01(\x04R\bsequence\"\x9c\x01\n" +
+	"\x13PublishBatchRequest\x12+\n" +
+	"\bmessages\x18\x01 \x03(\v2\x0f.PublishRequestR\bmessages\x12\x16\n" +
+	"\x06atomic\x18\x02 \x01(\bR\x06atomic\x12*\n" +
+	"\x11wait_for_delivery\x18\x03 \x01(\bR\x0fwaitForDelivery\x12\x14\n" +
+	"\x05block\x18\x04 \x01(\bR\x05block\"i\n" +
+	"\x14PublishBatchResponse\x12*\n" +
+	"\aresults\x18\x01 \x03(\v2\x10.PublishResponseR\aresults\x12%\n" +
+	"\x06errors\x18\x02 \x03(\v2\r.PublishErrorR\x06errors\"R\n" +
+	"\fPublishError\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"|\n" +
+	"\x15PublishStreamResponse\x12\x1c\n" +
+	"\tpublished\x18\x01 \x01(\x04R\tpublished\x12\x1e\n" +
+	"\n" +
+	"duplicates\x18\x02 \x01(\x04R\n" +
+	"duplicates\x12%\n" +
+	"\x06errors\x18\x03 \x03(\v2\r.PublishErrorR\x06errors\"V\n" +
+	"\n" +
+	"AckRequest\x12\x1a\n" +
+	"\bconsumer\x18\x01 \x01(\tR\bconsumer\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x1a\n" +
+	"\bsequence\x18\x03 \x01(\x04R\bsequence\"\xf2\x01\n" +
+	"\fFetchRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1a\n" +
+	"\bconsumer\x18\x02 \x01(\tR\bconsumer\x12!\n" +
+	"\fmax_messages\x18\x03 \x01(\rR\vmaxMessages\x124\n" +
+	"\bmax_wait\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\amaxWait\x124\n" +
+	"\back_wait\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\aackWait\x12%\n" +
+	"\x0estart_sequence\x18\x06 \x01(\x04R\rstartSequence\"T\n" +
+	"\rFetchResponse\x12\x1e\n" +
+	"\x06events\x18\x01 \x03(\v2\x06.EventR\x06events\x12#\n" +
+	"\rnext_sequence\x18\x02 \x01(\x04R\fnextSequence\"\xef\x02\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\tR\x04data\x12-\n" +
+	"\aheaders\x18\x02 \x03(\v2\x13.Event.HeadersEntryR\aheaders\x12\x1f\n" +
+	"\vmessage_key\x18\x03 \x01(\tR\n" +
+	"messageKey\x12\x1c\n" +
+	"\ttombstone\x18\x04 \x01(\bR\ttombstone\x12\x1a\n" +
+	"\bsequence\x18\x05 \x01(\x04R\bsequence\x12\x18\n" +
+	"\apayload\x18\x06 \x01(\fR\apayload\x12!\n" +
+	"\fcontent_type\x18\a \x01(\tR\vcontentType\x12(\n" +
+	"\theartbeat\x18\b \x01(\v2\n" +
+	".HeartbeatR\theartbeat\x12%\n" +
+	"\bshutdown\x18\t \x01(\v2\t.ShutdownR\bshutdown\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"-\n" +
+	"\bShutdown\x12!\n" +
+	"\fresume_token\x18\x01 \x01(\tR\vresumeToken\"m\n" +
+	"\tHeartbeat\x12#\n" +
+	"\rlast_sequence\x18\x01 \x01(\x04R\flastSequence\x12;\n" +
+	"\vserver_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"serverTime\"\xf6\x01\n" +
+	"\vClientFrame\x121\n" +
+	"\tsubscribe\x18\x01 \x01(\v2\x11.SubscribeCommandH\x00R\tsubscribe\x127\n" +
+	"\vunsubscribe\x18\x02 \x01(\v2\x13.UnsubscribeCommandH\x00R\vunsubscribe\x12\x1f\n" +
+	"\x03ack\x18\x03 \x01(\v2\v.AckCommandH\x00R\x03ack\x12%\n" +
+	"\x05pause\x18\x04 \x01(\v2\r.PauseCommandH\x00R\x05pause\x12(\n" +
+	"\x06resume\x18\x05 \x01(\v2\x0e.ResumeCommandH\x00R\x06resumeB\t\n" +
+	"\acommand\"O\n" +
+	"\x10SubscribeCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12+\n" +
+	"\arequest\x18\x02 \x01(\v2\x11.SubscribeRequestR\arequest\"$\n" +
+	"\x12UnsubscribeCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"8\n" +
+	"\n" +
+	"AckCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x04R\bsequence\"\x1e\n" +
+	"\fPauseCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1f\n" +
+	"\rResumeCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xdc\x01\n" +
+	"\vServerFrame\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\x12\x1e\n" +
+	"\x05event\x18\x02 \x01(\v2\x06.EventH\x00R\x05event\x12#\n" +
+	"\x05error\x18\x03 \x01(\v2\v.FrameErrorH\x00R\x05error\x12-\n" +
+	"\n" +
+	"subscribed\x18\x04 \x01(\v2\v.SubscribedH\x00R\n" +
+	"subscribed\x12'\n" +
+	"\bshutdown\x18\x05 \x01(\v2\t.ShutdownH\x00R\bshutdownB\a\n" +
+	"\x05frame\"p\n" +
+	"\n" +
+	"Subscribed\x12%\n" +
+	"\x0estart_sequence\x18\x01 \x01(\x04R\rstartSequence\x12;\n" +
+	"\vserver_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"serverTime\"R\n" +
+	"\n" +
+	"FrameError\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x16\n" +
+	"\x06closed\x18\x03 \x01(\bR\x06closed\"\x15\n" +
+	"\x13ListSubjectsRequest\"@\n" +
+	"\x14ListSubjectsResponse\x12(\n" +
+	"\bsubjects\x18\x01 \x03(\v2\f.SubjectInfoR\bsubjects\"\xaf\x02\n" +
+	"\x0fRetentionPolicy\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\x12\x18\n" +
+	"\acompact\x18\x02 \x01(\bR\acompact\x12J\n" +
+	"\x13tombstone_retention\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x12tombstoneRetention\x122\n" +
+	"\amax_age\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\x06maxAge\x12!\n" +
+	"\fmax_messages\x18\x05 \x01(\x04R\vmaxMessages\x12\x1b\n" +
+	"\tmax_bytes\x18\x06 \x01(\x04R\bmaxBytes\x12(\n" +
+	"\adiscard\x18\a \x01(\x0e2\x0e.DiscardPolicyR\adiscard\"\xf1\x01\n" +
+	"\vSubjectInfo\x12\x18\n" +
+	"\asubject\x18\x01 \x01(\tR\asubject\x12.\n" +
+	"\tretention\x18\x02 \x01(\v2\x10.RetentionPolicyR\tretention\x12%\n" +
+	"\x0efirst_sequence\x18\x03 \x01(\x04R\rfirstSequence\x12#\n" +
+	"\rlast_sequence\x18\x04 \x01(\x04R\flastSequence\x12\x1a\n" +
+	"\bmessages\x18\x05 \x01(\x04R\bmessages\x12\x14\n" +
+	"\x05bytes\x18\x06 \x01(\x04R\x05bytes\x12\x1a\n" +
+	"\bsegments\x18\a \x01(\rR\bsegments\"\x11\n" +
+	"\x0fGetStatsRequest\"\xbd\x01\n" +
+	"\x05Stats\x12\x1a\n" +
+	"\bsubjects\x18\x01 \x01(\rR\bsubjects\x12$\n" +
+	"\rsubscriptions\x18\x02 \x01(\rR\rsubscriptions\x12\x1c\n" +
+	"\tpublished\x18\x03 \x01(\x04R\tpublished\x12\x1a\n" +
+	"\benqueued\x18\x04 \x01(\x04R\benqueued\x12\x18\n" +
+	"\adropped\x18\x05 \x01(\x04R\adropped\x12\x1e\n" +
+	"\n" +
+	"duplicates\x18\x06 \x01(\x04R\n" +
+	"duplicates\"\xdc\x01\n" +
+	"\fConsumerInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\asubject\x18\x02 \x01(\tR\asubject\x12!\n" +
+	"\fack_sequence\x18\x03 \x01(\x04R\vackSequence\x124\n" +
+	"\aupdated\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\aupdated\x12\x18\n" +
+	"\apending\x18\x05 \x01(\x04R\apending\x12+\n" +
+	"\x03lag\x18\x06 \x01(\v2\x19.google.protobuf.DurationR\x03lag\"0\n" +
+	"\x14ListConsumersRequest\x12\x18\n" +
+	"\asubject\x18\x01 \x01(\tR\asubject\"D\n" +
+	"\x15ListConsumersResponse\x12+\n" +
+	"\tconsumers\x18\x01 \x03(\v2\r.ConsumerInfoR\tconsumers\"\xa8\x01\n" +
+	"\x14ResetConsumerRequest\x12\x1a\n" +
+	"\bconsumer\x18\x01 \x01(\tR\bconsumer\x12\x18\n" +
+	"\asubject\x18\x02 \x01(\tR\asubject\x12\x1c\n" +
+	"\bsequence\x18\x03 \x01(\x04H\x00R\bsequence\x120\n" +
+	"\x04time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampH\x00R\x04timeB\n" +
+	"\n" +
+	"\bposition\"M\n" +
+	"\x15DeleteConsumerRequest\x12\x1a\n" +
+	"\bconsumer\x18\x01 \x01(\tR\bconsumer\x12\x18\n" +
+	"\asubject\x18\x02 \x01(\tR\asubject*1\n" +
+	"\rDiscardPolicy\x12\x0f\n" +
+	"\vDISCARD_OLD\x10\x00\x12\x0f\n" +
+	"\vDISCARD_NEW\x10\x012\xd8\x02\n" +
+	"\x06PubSub\x12(\n" +
+	"\tSubscribe\x12\x11.SubscribeRequest\x1a\x06.Event0\x01\x12,\n" +
+	"\aPublish\x12\x0f.PublishRequest\x1a\x10.PublishResponse\x12;\n" +
+	"\fPublishBatch\x12\x14.PublishBatchRequest\x1a\x15.PublishBatchResponse\x12:\n" +
+	"\rPublishStream\x12\x0f.PublishRequest\x1a\x16.PublishStreamResponse(\x01\x12*\n" +
+	"\x03Ack\x12\v.AckRequest\x1a\x16.google.protobuf.Empty\x12&\n" +
+	"\x05Fetch\x12\r.FetchRequest\x1a\x0e.FetchResponse\x12)\n" +
+	"\aConnect\x12\f.ClientFrame\x1a\f.ServerFrame(\x010\x012\xa3\x02\n" +
+	"\x05Admin\x12;\n" +
+	"\fListSubjects\x12\x14.ListSubjectsRequest\x1a\x15.ListSubjectsResponse\x12$\n" +
+	"\bGetStats\x12\x10.GetStatsRequest\x1a\x06.Stats\x12>\n" +
+	"\rListConsumers\x12\x15.ListConsumersRequest\x1a\x16.ListConsumersResponse\x125\n" +
+	"\rResetConsumer\x12\x15.ResetConsumerRequest\x1a\r.ConsumerInfo\x12@\n" +
+	"\x0eDeleteConsumer\x12\x16.DeleteConsumerRequest\x1a\x16.google.protobuf.EmptyB'Z%github.com/StepanErshov/pubsub/pkg/pbb\x06proto3"
+
+var (
+	file_pubsub_proto_rawDescOnce sync.Once
+	file_pubsub_proto_rawDescData []byte
+)
+
+func file_pubsub_proto_rawDescGZIP() []byte {
+	file_pubsub_proto_rawDescOnce.Do(func() {
+		file_pubsub_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pubsub_proto_rawDesc), len(file_pubsub_proto_rawDesc)))
+	})
+	return file_pubsub_proto_rawDescData
+}
+
+var file_pubsub_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_pubsub_proto_msgTypes = make([]protoimpl.MessageInfo, 35)
+var file_pubsub_proto_goTypes = []any{
+	(DiscardPolicy)(0),            // 0: DiscardPolicy
+	(*SubscribeRequest)(nil),      // 1: SubscribeRequest
+	(*PublishRequest)(nil),        // 2: PublishRequest
+	(*PublishResponse)(nil),       // 3: PublishResponse
+	(*PublishBatchRequest)(nil),   // 4: PublishBatchRequest
+	(*PublishBatchResponse)(nil),  // 5: PublishBatchResponse
+	(*PublishError)(nil),          // 6: PublishError
+	(*PublishStreamResponse)(nil), // 7: PublishStreamResponse
+	(*AckRequest)(nil),            // 8: AckRequest
+	(*FetchRequest)(nil),          // 9: FetchRequest
+	(*FetchResponse)(nil),         // 10: FetchResponse
+	(*Event)(nil),                 // 11: Event
+	(*Shutdown)(nil),              // 12: Shutdown
+	(*Heartbeat)(nil),             // 13: Heartbeat
+	(*ClientFrame)(nil),           // 14: ClientFrame
+	(*SubscribeCommand)(nil),      // 15: SubscribeCommand
+	(*UnsubscribeCommand)(nil),    // 16: UnsubscribeCommand
+	(*AckCommand)(nil),            // 17: AckCommand
+	(*PauseCommand)(nil),          // 18: PauseCommand
+	(*ResumeCommand)(nil),         // 19: ResumeCommand
+	(*ServerFrame)(nil),           // 20: ServerFrame
+	(*Subscribed)(nil),            // 21: Subscribed
+	(*FrameError)(nil),            // 22: FrameError
+	(*ListSubjectsRequest)(nil),   // 23: ListSubjectsRequest
+	(*ListSubjectsResponse)(nil),  // 24: ListSubjectsResponse
+	(*RetentionPolicy)(nil),       // 25: RetentionPolicy
+	(*SubjectInfo)(nil),           // 26: SubjectInfo
+	(*GetStatsRequest)(nil),       // 27: GetStatsRequest
+	(*Stats)(nil),                 // 28: Stats
+	(*ConsumerInfo)(nil),          // 29: ConsumerInfo
+	(*ListConsumersRequest)(nil),  // 30: ListConsumersRequest
+	(*ListConsumersResponse)(nil), // 31: ListConsumersResponse
+	(*ResetConsumerRequest)(nil),  // 32: ResetConsumerRequest
+	(*DeleteConsumerRequest)(nil), // 33: DeleteConsumerRequest
+	nil,                           // 34: PublishRequest.HeadersEntry
+	nil,                           // 35: Event.HeadersEntry
+	(*durationpb.Duration)(nil),   // 36: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil), // 37: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 38: google.protobuf.Empty
+}
+var file_pubsub_proto_depIdxs = []int32{
+	34, // 0: PublishRequest.headers:type_name -> PublishRequest.HeadersEntry
+	2,  // 1: PublishBatchRequest.messages:type_name -> PublishRequest
+	3,  // 2: PublishBatchResponse.results:type_name -> PublishResponse
+	6,  // 3: PublishBatchResponse.errors:type_name -> PublishError
+	6,  // 4: PublishStreamResponse.errors:type_name -> PublishError
+	36, // 5: FetchRequest.max_wait:type_name -> google.protobuf.Duration
+	36, // 6: FetchRequest.ack_wait:type_name -> google.protobuf.Duration
+	11, // 7: FetchResponse.events:type_name -> Event
+	35, // 8: Event.headers:type_name -> Event.HeadersEntry
+	13, // 9: Event.heartbeat:type_name -> Heartbeat
+	12, // 10: Event.shutdown:type_name -> Shutdown
+	37, // 11: Heartbeat.server_time:type_name -> google.protobuf.Timestamp
+	15, // 12: ClientFrame.subscribe:type_name -> SubscribeCommand
+	16, // 13: ClientFrame.unsubscribe:type_name -> UnsubscribeCommand
+	17, // 14: ClientFrame.ack:type_name -> AckCommand
+	18, // 15: ClientFrame.pause:type_name -> PauseCommand
+	19, // 16: ClientFrame.resume:type_name -> ResumeCommand
+	1,  // 17: SubscribeCommand.request:type_name -> SubscribeRequest
+	11, // 18: ServerFrame.event:type_name -> Event
+	22, // 19: ServerFrame.error:type_name -> FrameError
+	21, // 20: ServerFrame.subscribed:type_name -> Subscribed
+	12, // 21: ServerFrame.shutdown:type_name -> Shutdown
+	37, // 22: Subscribed.server_time:type_name -> google.protobuf.Timestamp
+	26, // 23: ListSubjectsResponse.subjects:type_name -> SubjectInfo
+	36, // 24: RetentionPolicy.tombstone_retention:type_name -> google.protobuf.Duration
+	36, // 25: RetentionPolicy.max_age:type_name -> google.protobuf.Duration
+	0,  // 26: RetentionPolicy.discard:type_name -> DiscardPolicy
+	25, // 27: SubjectInfo.retention:type_name -> RetentionPolicy
+	37, // 28: ConsumerInfo.updated:type_name -> google.protobuf.Timestamp
+	36, // 29: ConsumerInfo.lag:type_name -> google.protobuf.Duration
+	29, // 30: ListConsumersResponse.consumers:type_name -> ConsumerInfo
+	37, // 31: ResetConsumerRequest.time:type_name -> google.protobuf.Timestamp
+	1,  // 32: PubSub.Subscribe:input_type -> SubscribeRequest
+	2,  // 33: PubSub.Publish:input_type -> PublishRequest
+	4,  // 34: PubSub.PublishBatch:input_type -> PublishBatchRequest
+	2,  // 35: PubSub.PublishStream:input_type -> PublishRequest
+	8,  // 36: PubSub.Ack:input_type -> AckRequest
+	9,  // 37: PubSub.Fetch:input_type -> FetchRequest
+	14, // 38: PubSub.Connect:input_type -> ClientFrame
+	23, // 39: Admin.ListSubjects:input_type -> ListSubjectsRequest
+	27, // 40: Admin.GetStats:input_type -> GetStatsRequest
+	30, // 41: Admin.ListConsumers:input_type -> ListConsumersRequest
+	32, // 42: Admin.ResetConsumer:input_type -> ResetConsumerRequest
+	33, // 43: Admin.DeleteConsumer:input_type -> DeleteConsumerRequest
+	11, // 44: PubSub.Subscribe:output_type -> Event
+	3,  // 45: PubSub.Publish:output_type -> PublishResponse
+	5,  // 46: PubSub.PublishBatch:output_type -> PublishBatchResponse
+	7,  // 47: PubSub.PublishStream:output_type -> PublishStreamResponse
+	38, // 48: PubSub.Ack:output_type -> google.protobuf.Empty
+	10, // 49: PubSub.Fetch:output_type -> FetchResponse
+	20, // 50: PubSub.Connect:output_type -> ServerFrame
+	24, // 51: Admin.ListSubjects:output_type -> ListSubjectsResponse
+	28, // 52: Admin.GetStats:output_type -> Stats
+	31, // 53: Admin.ListConsumers:output_type -> ListConsumersResponse
+	29, // 54: Admin.ResetConsumer:output_type -> ConsumerInfo
+	38, // 55: Admin.DeleteConsumer:output_type -> google.protobuf.Empty
+	44, // [44:56] is the sub-list for method output_type
+	32, // [32:44] is the sub-list for method input_type
+	32, // [32:32] is the sub-list for extension type_name
+	32, // [32:32] is the sub-list for extension extendee
+	0,  // [0:32] is the sub-list for field type_name
+}
+
+func init() { file_pubsub_proto_init() }
+func file_pubsub_proto_init() {
+	if File_pubsub_proto != nil {
+		return
+	}
+	file_pubsub_proto_msgTypes[13].OneofWrappers = []any{
+		(*ClientFrame_Subscribe)(nil),
+		(*ClientFrame_Unsubscribe)(nil),
+		(*ClientFrame_Ack)(nil),
+		(*ClientFrame_Pause)(nil),
+		(*ClientFrame_Resume)(nil),
+	}
+	file_pubsub_proto_msgTypes[19].OneofWrappers = []any{
+		(*ServerFrame_Event)(nil),
+		(*ServerFrame_Error)(nil),
+		(*ServerFrame_Subscribed)(nil),
+		(*ServerFrame_Shutdown)(nil),
+	}
+	file_pubsub_proto_msgTypes[31].OneofWrappers = []any{
+		(*ResetConsumerRequest_Sequence)(nil),
+		(*ResetConsumerRequest_Time)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pubsub_proto_rawDesc), len(file_pubsub_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      1,
+			NumMessages:   35,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_pubsub_proto_goTypes,
 		DependencyIndexes: file_pubsub_proto_depIdxs,
+		EnumInfos:         file_pubsub_proto_enumTypes,
 		MessageInfos:      file_pubsub_proto_msgTypes,
 	}.Build()
 	File_pubsub_proto = out.File
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/StepanErshov/pubsub/config"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+func storeOptions(cfg *config.Config) (store.Options, error) {
+	opts := store.Options{
+		Dir:                cfg.Storage.Dir,
+		SegmentSize:        cfg.Storage.SegmentSize,
+		CompactionInterval: cfg.Storage.CompactionInterval,
+	}
+	for _, sc := range cfg.Storage.Subjects {
+		subject := store.SubjectConfig{
+			Subject:            sc.Subject,
+			Compact:            sc.Compact,
+			TombstoneRetention: sc.TombstoneRetention,
+			MaxAge:             sc.MaxAge,
+			MaxMessages:        sc.MaxMessages,
+			MaxBytes:           sc.MaxBytes,
+		}
+		switch sc.Discard {
+		case "", "old":
+			subject.Discard = store.DiscardOld
+		case "new":
+			subject.Discard = store.DiscardNew
+		default:
+			return store.Options{}, fmt.Errorf("subject %q: unknown discard policy %q", sc.Subject, sc.Discard)
+		}
+		opts.Subjects = append(opts.Subjects, subject)
+	}
+	return opts, nil
+}
+
+func busOptions(cfg *config.Config, st *store.Store) []subpub.Option {
+	var opts []subpub.Option
+	if st != nil {
+		opts = append(opts, subpub.WithStore(st))
+	}
+	if cfg.Bus.QueueSize > 0 {
+		opts = append(opts, subpub.WithQueueSize(cfg.Bus.QueueSize))
+	}
+	if cfg.Bus.WorkerPool {
+		opts = append(opts, subpub.WithWorkerPool(cfg.Bus.Workers))
+	}
+	if cfg.Bus.Dedup.Window > 0 || cfg.Bus.Dedup.MaxEntries > 0 {
+		opts = append(opts, subpub.WithDeduplication(cfg.Bus.Dedup.Window, cfg.Bus.Dedup.MaxEntries))
+	}
+	return opts
+}
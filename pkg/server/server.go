@@ -0,0 +1,288 @@
+// Package server runs a PubSub server in-process, e.g. embedded in an
+// application or in tests.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/StepanErshov/pubsub/config"
+	"github.com/StepanErshov/pubsub/internal/metrics"
+	"github.com/StepanErshov/pubsub/internal/service"
+	"github.com/StepanErshov/pubsub/pkg/store"
+	"github.com/StepanErshov/pubsub/pkg/subpub"
+)
+
+// Server runs the components of a PubSub server: storage, the bus, the
+// gRPC services, the metrics endpoint and the lag monitor.
+type Server struct {
+	cfg      *config.Config
+	addr     string
+	lis      net.Listener
+	busOpts  []subpub.Option
+	grpcOpts []grpc.ServerOption
+
+	store   *store.Store
+	bus     subpub.SubPub
+	svc     *service.PubSubService
+	grpc    *grpc.Server
+	metrics *http.Server
+	stopLag context.CancelFunc
+
+	ready    chan struct{}
+	draining atomic.Bool
+	// errc receives the error with which serving stopped unexpectedly.
+	errc         chan error
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+type Option func(*Server)
+
+// WithListener serves on lis instead of listening on the configured port,
+// e.g. on a bufconn.Listener for hermetic tests. The server closes it.
+func WithListener(lis net.Listener) Option {
+	return func(s *Server) {
+		s.lis = lis
+	}
+}
+
+// WithAddress listens on addr, e.g. "127.0.0.1:0", instead of the
+// configured port.
+func WithAddress(addr string) Option {
+	return func(s *Server) {
+		s.addr = addr
+	}
+}
+
+// WithBusOptions adds options to those the bus is created with from the
+// config.
+func WithBusOptions(opts ...subpub.Option) Option {
+	return func(s *Server) {
+		s.busOpts = append(s.busOpts, opts...)
+	}
+}
+
+// WithGRPCOptions sets options of the gRPC server, e.g. credentials or
+// interceptors.
+func WithGRPCOptions(opts ...grpc.ServerOption) Option {
+	return func(s *Server) {
+		s.grpcOpts = append(s.grpcOpts, opts...)
+	}
+}
+
+// New creates a server from cfg; a nil cfg uses the defaults, which keep
+// messages in memory only and listen on a random port.
+func New(cfg *config.Config, opts ...Option) *Server {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	s := &Server{
+		cfg:   cfg,
+		addr:  fmt.Sprintf(":%d", cfg.GRPC.Port),
+		ready: make(chan struct{}),
+		errc:  make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Start starts the components in order: storage, bus, services, metrics,
+// the lag monitor and finally the gRPC listener. It returns once the
+// server accepts connections; components started before a failure are
+// stopped again.
+func (s *Server) Start(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			s.stop(ctx)
+		}
+	}()
+
+	cfg := s.cfg
+	if cfg.Storage.Dir != "" {
+		opts, err := storeOptions(cfg)
+		if err != nil {
+			return fmt.Errorf("invalid storage config: %w", err)
+		}
+		if s.store, err = store.Open(opts); err != nil {
+			return fmt.Errorf("failed to open storage: %w", err)
+		}
+	}
+
+	s.bus = subpub.NewSubPub(append(busOptions(cfg, s.store), s.busOpts...)...)
+	s.grpc = grpc.NewServer(s.grpcOpts...)
+	s.svc = service.NewPubSubService(s.bus,
+		service.WithPublishTimeout(cfg.GRPC.PublishTimeout),
+		service.WithHeartbeat(cfg.GRPC.HeartbeatInterval),
+		service.WithSendTimeout(cfg.GRPC.SendTimeout),
+		service.WithStore(s.store),
+	)
+	s.svc.Register(s.grpc)
+	admin := service.NewAdminService(s.bus, s.store)
+	admin.Register(s.grpc)
+
+	if cfg.Metrics.Port > 0 {
+		s.metrics = s.startMetrics(cfg.Metrics.Port, admin)
+	}
+
+	if s.store != nil && (cfg.LagAlerts.MaxPending > 0 || cfg.LagAlerts.MaxLag > 0) {
+		var lagCtx context.Context
+		lagCtx, s.stopLag = context.WithCancel(context.Background())
+		go service.NewLagMonitor(s.bus, s.store, service.LagAlerts{
+			Interval:   cfg.LagAlerts.Interval,
+			MaxPending: cfg.LagAlerts.MaxPending,
+			MaxLag:     cfg.LagAlerts.MaxLag,
+			Subject:    cfg.LagAlerts.Subject,
+		}).Run(lagCtx)
+	}
+
+	if s.lis == nil {
+		var lc net.ListenConfig
+		if s.lis, err = lc.Listen(ctx, "tcp", s.addr); err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+	}
+	go func() {
+		if err := s.grpc.Serve(s.lis); err != nil {
+			s.errc <- err
+		}
+	}()
+
+	log.Info().Str("address", s.lis.Addr().String()).Msg("Server listening on")
+	close(s.ready)
+	return nil
+}
+
+// Ready is closed once the server accepts connections.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Addr returns the address the server is bound to, nil before Start.
+func (s *Server) Addr() net.Addr {
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Addr()
+}
+
+// Err receives the error with which the gRPC server stopped serving on
+// its own.
+func (s *Server) Err() <-chan error {
+	return s.errc
+}
+
+// Dial connects to the started server without transport security. It
+// also works with in-memory listeners such as bufconn.Listener.
+func (s *Server) Dial(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if s.lis == nil {
+		return nil, errors.New("server: not started")
+	}
+	target := s.lis.Addr().String()
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	if d, ok := s.lis.(interface {
+		DialContext(context.Context) (net.Conn, error)
+	}); ok {
+		target = "passthrough:///" + target
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return d.DialContext(ctx)
+		}))
+	}
+	return grpc.NewClient(target, opts...)
+}
+
+// Shutdown stops the components in the reverse order of Start: the
+// subscribers are notified and the bus drained, the gRPC server stops
+// gracefully, then the metrics endpoint and storage are closed. When ctx
+// ends first, the remaining connections are closed forcibly.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.stop(ctx)
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) stop(ctx context.Context) error {
+	s.draining.Store(true)
+	var errs []error
+
+	if s.stopLag != nil {
+		s.stopLag()
+	}
+	if s.svc != nil {
+		if err := s.svc.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("bus did not drain: %w", err))
+		}
+	} else if s.bus != nil {
+		s.bus.Close(ctx)
+	}
+
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			log.Info().Msg("Server stopped gracefully")
+		case <-ctx.Done():
+			s.grpc.Stop()
+			log.Warn().Msg("Server forced to stop")
+		}
+	}
+
+	if s.metrics != nil {
+		if err := s.metrics.Shutdown(ctx); err != nil {
+			s.metrics.Close()
+		}
+	}
+	if s.store != nil {
+		if err := s.store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close storage: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startMetrics serves the metrics and a readiness probe, which fails
+// before Start completes and once Shutdown began.
+func (s *Server) startMetrics(port int, admin *service.AdminService) *http.Server {
+	registry := metrics.NewRegistry()
+	registry.Register(admin.CollectMetrics)
+	registry.Register(s.svc.CollectMetrics)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-s.ready:
+			if !s.draining.Load() {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		default:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+
+	go func() {
+		log.Info().Int("port", port).Msg("Serving metrics")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Metrics server failed")
+		}
+	}()
+	return server
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/StepanErshov/pubsub/config"
+	"github.com/StepanErshov/pubsub/pkg/pb"
+)
+
+func TestServerLifecycle(t *testing.T) {
+	server := New(nil, WithAddress("127.0.0.1:0"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, server.Start(ctx))
+	select {
+	case <-server.Ready():
+	default:
+		t.Fatal("Expected the server to be ready after Start")
+	}
+
+	conn, err := server.Dial()
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewPubSubClient(conn)
+
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{Key: "test"})
+	require.NoError(t, err)
+	_, err = stream.Header()
+	require.NoError(t, err)
+	_, err = client.Publish(ctx, &pb.PublishRequest{Key: "test", Data: "hello"})
+	require.NoError(t, err)
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", event.Data)
+
+	require.NoError(t, server.Shutdown(ctx))
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	assert.NotNil(t, event.GetShutdown())
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// Shutdown is idempotent.
+	assert.NoError(t, server.Shutdown(ctx))
+}
+
+func TestServerStartFailure(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Dir = t.TempDir()
+	cfg.Storage.Subjects = []config.SubjectConfig{{Subject: "orders", Discard: "sometimes"}}
+
+	err := New(cfg).Start(context.Background())
+	assert.ErrorContains(t, err, "unknown discard policy")
+}
+
+func TestServerBufconn(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Dir = t.TempDir()
+	cfg.Storage.Subjects = []config.SubjectConfig{{Subject: "orders"}}
+	server := New(cfg, WithListener(bufconn.Listen(1<<20)))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, server.Start(ctx))
+	defer server.Shutdown(ctx)
+	assert.Equal(t, "bufconn", server.Addr().String())
+
+	conn, err := server.Dial()
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewPubSubClient(conn)
+
+	resp, err := client.Publish(ctx, &pb.PublishRequest{Key: "orders", Data: "one"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), resp.Sequence)
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Entry is a record to append to a subject with AppendBatch.
+type Entry struct {
+	Subject string
+	Record  Record
+}
+
+// logUndo remembers the state of a log before a batch was written to it.
+type logUndo struct {
+	log     *subjectLog
+	active  *segment
+	saved   segment
+	lastSeq uint64
+}
+
+func (u *logUndo) rollback() {
+	if u.active.file != nil {
+		u.active.file.Truncate(u.saved.size)
+	}
+	file := u.active.file
+	*u.active = u.saved
+	u.active.file = file
+	u.log.lastSeq = u.lastSeq
+}
+
+// AppendBatch appends entries to their subjects as one unit. The subjects
+// stay locked until every record is written, so readers see either all
+// of the batch or none of it, and sequences are assigned in entry order.
+func (s *Store) AppendBatch(entries []Entry) ([]Entry, error) {
+	logs := make(map[string]*subjectLog)
+	for _, e := range entries {
+		if _, ok := logs[e.Subject]; ok {
+			continue
+		}
+		l, err := s.log(e.Subject)
+		if err != nil {
+			return nil, err
+		}
+		logs[e.Subject] = l
+	}
+
+	// Logs are locked in subject order so that concurrent batches cannot
+	// deadlock.
+	subjects := make([]string, 0, len(logs))
+	for subject := range logs {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	for _, subject := range subjects {
+		logs[subject].mu.Lock()
+	}
+	defer func() {
+		for _, subject := range subjects {
+			logs[subject].mu.Unlock()
+		}
+	}()
+
+	now := time.Now()
+	out := make([]Entry, len(entries))
+	lines := make([][]byte, len(entries))
+	next := make(map[*subjectLog]uint64, len(logs))
+	counts := make(map[*subjectLog]int, len(logs))
+	sizes := make(map[*subjectLog]int64, len(logs))
+	for i, e := range entries {
+		l := logs[e.Subject]
+		if _, ok := next[l]; !ok {
+			next[l] = l.lastSeq + 1
+		}
+		rec := e.Record
+		if rec.Time.IsZero() {
+			rec.Time = now
+		}
+		rec.Seq = next[l]
+		next[l]++
+
+		line, err := encodeRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = Entry{Subject: e.Subject, Record: rec}
+		lines[i] = line
+		counts[l]++
+		sizes[l] += int64(len(line))
+	}
+
+	for _, subject := range subjects {
+		l := logs[subject]
+		if l.config.Discard == DiscardNew && l.full(counts[l], sizes[l]) {
+			return nil, ErrSubjectFull
+		}
+	}
+
+	undo := make(map[*subjectLog]*logUndo, len(logs))
+	rollback := func() {
+		for _, u := range undo {
+			u.rollback()
+		}
+	}
+	for _, subject := range subjects {
+		l := logs[subject]
+		// The batch is written to one segment per subject, which may grow
+		// past the segment size.
+		if active := l.active(); active.count > 0 && active.size >= s.opts.SegmentSize {
+			if err := l.roll(l.lastSeq + 1); err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+		undo[l] = &logUndo{log: l, active: l.active(), saved: *l.active(), lastSeq: l.lastSeq}
+	}
+
+	for i, e := range out {
+		l := logs[e.Subject]
+		if err := l.active().write(e.Record, lines[i]); err != nil {
+			rollback()
+			return nil, err
+		}
+		l.lastSeq = e.Record.Seq
+	}
+
+	for _, subject := range subjects {
+		s.appended(logs[subject])
+	}
+	return out, nil
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"bufio"
+	"os"
+	"time"
+)
+
+// Compact removes records of subject that are superseded by a later
+// record with the same key, and tombstones older than the subject's
+// tombstone retention. Only sealed segments are rewritten, so appends are
+// not blocked while compaction runs.
+func (s *Store) Compact(subject string) error {
+	l, err := s.log(subject)
+	if err != nil {
+		return err
+	}
+	return l.compact(time.Now())
+}
+
+func (l *subjectLog) compact(now time.Time) error {
+	l.maintenance.Lock()
+	defer l.maintenance.Unlock()
+
+	l.mu.Lock()
+	var sealed []*segment
+	for _, seg := range l.segments[:len(l.segments)-1] {
+		if seg.count > 0 {
+			sealed = append(sealed, seg)
+		}
+	}
+	active := segmentView{path: l.active().path, limit: l.active().size}
+	lastSeq := l.lastSeq
+	floor := l.floor
+	l.mu.Unlock()
+
+	if len(sealed) == 0 {
+		return nil
+	}
+
+	latest := make(map[string]uint64)
+	collect := func(rec Record) bool {
+		if rec.Key != "" {
+			latest[rec.Key] = rec.Seq
+		}
+		return true
+	}
+	for _, seg := range sealed {
+		if err := scanSegment(seg.path, seg.size, collect); err != nil {
+			return err
+		}
+	}
+	if err := scanSegment(active.path, active.limit, collect); err != nil {
+		return err
+	}
+
+	retention := l.config.TombstoneRetention
+	if retention <= 0 {
+		retention = defaultTombstoneRetention
+	}
+	keep := func(rec Record) bool {
+		if rec.Seq < floor {
+			// Already removed by retention.
+			return false
+		}
+		if rec.Key == "" {
+			return true
+		}
+		if latest[rec.Key] != rec.Seq {
+			return false
+		}
+		// The last record of the log is kept so that its sequence
+		// survives a restart.
+		return !rec.Tombstone || rec.Seq == lastSeq || now.Sub(rec.Time) < retention
+	}
+
+	for _, seg := range sealed {
+		if err := l.rewrite(seg, keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite replaces the file of a sealed segment with the records accepted
+// by keep, removing the segment when none are left.
+func (l *subjectLog) rewrite(seg *segment, keep func(Record) bool) error {
+	compacted := &segment{path: seg.path, base: seg.base}
+	var kept []Record
+	dropped := false
+	err := scanSegment(seg.path, seg.size, func(rec Record) bool {
+		if keep(rec) {
+			kept = append(kept, rec)
+		} else {
+			dropped = true
+		}
+		return true
+	})
+	if err != nil || !dropped {
+		return err
+	}
+
+	tmp := seg.path + compactExt
+	if len(kept) > 0 {
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		for _, rec := range kept {
+			line, err := encodeRecord(rec)
+			if err == nil {
+				_, err = w.Write(line)
+			}
+			if err != nil {
+				f.Close()
+				os.Remove(tmp)
+				return err
+			}
+			compacted.add(rec, int64(len(line)))
+		}
+		if err := w.Flush(); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Records hidden by retention live in the oldest segment only and
+	// none of them are kept.
+	if seg == l.oldest() {
+		l.hidden, l.hiddenBytes = 0, 0
+	}
+	if seg == l.indexed {
+		l.index, l.indexed = nil, nil
+	}
+
+	if len(kept) == 0 {
+		if err := os.Remove(seg.path); err != nil {
+			return err
+		}
+		l.removeSegment(seg)
+		return nil
+	}
+
+	if err := os.Rename(tmp, seg.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	seg.first, seg.last = compacted.first, compacted.last
+	seg.count, seg.size = compacted.count, compacted.size
+	seg.newest = compacted.newest
+	return nil
+}
+
+func (l *subjectLog) removeSegment(seg *segment) {
+	for i, s := range l.segments {
+		if s == seg {
+			l.segments = append(l.segments[:i], l.segments[i+1:]...)
+			return
+		}
+	}
+}
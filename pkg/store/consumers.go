@@ -0,0 +1,265 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// consumersFile holds the state of durable consumers in the store
+// directory.
+const consumersFile = "consumers.json"
+
+var (
+	ErrConsumerNotFound = errors.New("store: consumer not found")
+	// ErrInvalidAck is returned when a consumer acknowledges a sequence
+	// that was never appended to its subject.
+	ErrInvalidAck = errors.New("store: acknowledged sequence is beyond the end of the subject")
+)
+
+// Consumer is the position of a durable consumer on a subject. Records up
+// to and including AckSeq are acknowledged.
+type Consumer struct {
+	Name    string    `json:"name"`
+	Subject string    `json:"subject"`
+	AckSeq  uint64    `json:"ack_seq"`
+	Updated time.Time `json:"updated"`
+	// Resets counts the times the consumer was repositioned, so that an
+	// active reader notices it has to start over from AckSeq.
+	Resets uint64 `json:"resets,omitempty"`
+}
+
+type consumerKey struct {
+	name, subject string
+}
+
+// consumerTable keeps consumers in memory. Acks only mark the table dirty
+// and are saved by the maintenance loop, so a crash may redeliver up to a
+// second of acknowledged records; other changes are saved immediately.
+type consumerTable struct {
+	mu    sync.Mutex
+	path  string
+	byKey map[consumerKey]*Consumer
+	dirty bool
+}
+
+func (t *consumerTable) load(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.path = path
+	t.byKey = make(map[consumerKey]*Consumer)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var consumers []*Consumer
+	if err := json.Unmarshal(data, &consumers); err != nil {
+		return err
+	}
+	for _, c := range consumers {
+		t.byKey[consumerKey{c.Name, c.Subject}] = c
+	}
+	return nil
+}
+
+// flush writes the table if it changed since it was last written.
+func (t *consumerTable) flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.flushLocked()
+}
+
+func (t *consumerTable) flushLocked() error {
+	if !t.dirty || t.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(t.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+func (t *consumerTable) listLocked() []Consumer {
+	consumers := make([]Consumer, 0, len(t.byKey))
+	for _, c := range t.byKey {
+		consumers = append(consumers, *c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		if consumers[i].Subject != consumers[j].Subject {
+			return consumers[i].Subject < consumers[j].Subject
+		}
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+// OpenConsumer returns the durable consumer name on subject, creating it
+// at the end of the subject so that it receives new records only.
+func (s *Store) OpenConsumer(name, subject string) (Consumer, error) {
+	last, err := s.LastSeq(subject)
+	if err != nil {
+		return Consumer{}, err
+	}
+
+	t := &s.consumers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := consumerKey{name, subject}
+	if c, ok := t.byKey[key]; ok {
+		return *c, nil
+	}
+	c := &Consumer{Name: name, Subject: subject, AckSeq: last, Updated: time.Now()}
+	t.byKey[key] = c
+	t.dirty = true
+	return *c, t.flushLocked()
+}
+
+// GetConsumer returns the durable consumer name on subject.
+func (s *Store) GetConsumer(name, subject string) (Consumer, error) {
+	t := &s.consumers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.byKey[consumerKey{name, subject}]
+	if !ok {
+		return Consumer{}, ErrConsumerNotFound
+	}
+	return *c, nil
+}
+
+// Consumers returns every durable consumer ordered by subject and name.
+func (s *Store) Consumers() []Consumer {
+	t := &s.consumers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.listLocked()
+}
+
+// Ack acknowledges the records of subject up to and including seq for the
+// consumer. Acks are cumulative; a sequence at or below the current
+// position is ignored.
+func (s *Store) Ack(name, subject string, seq uint64) error {
+	last, err := s.LastSeq(subject)
+	if err != nil {
+		return err
+	}
+	if seq > last {
+		return ErrInvalidAck
+	}
+
+	t := &s.consumers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.byKey[consumerKey{name, subject}]
+	if !ok {
+		return ErrConsumerNotFound
+	}
+	if seq > c.AckSeq {
+		c.AckSeq = seq
+		c.Updated = time.Now()
+		t.dirty = true
+	}
+	return nil
+}
+
+// ResetConsumer repositions the consumer so that seq is the next record
+// it receives. It may move the consumer backwards to replay records.
+func (s *Store) ResetConsumer(name, subject string, seq uint64) (Consumer, error) {
+	t := &s.consumers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.byKey[consumerKey{name, subject}]
+	if !ok {
+		return Consumer{}, ErrConsumerNotFound
+	}
+	c.AckSeq = 0
+	if seq > 0 {
+		c.AckSeq = seq - 1
+	}
+	c.Updated = time.Now()
+	c.Resets++
+	t.dirty = true
+	return *c, t.flushLocked()
+}
+
+// ResetConsumerToTime repositions the consumer to the first record stored
+// at or after ts.
+func (s *Store) ResetConsumerToTime(name, subject string, ts time.Time) (Consumer, error) {
+	seq, err := s.SeqAt(subject, ts)
+	if err != nil {
+		return Consumer{}, err
+	}
+	return s.ResetConsumer(name, subject, seq)
+}
+
+// DeleteConsumer removes the consumer and its position.
+func (s *Store) DeleteConsumer(name, subject string) error {
+	t := &s.consumers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := consumerKey{name, subject}
+	if _, ok := t.byKey[key]; !ok {
+		return ErrConsumerNotFound
+	}
+	delete(t.byKey, key)
+	t.dirty = true
+	return t.flushLocked()
+}
+
+// Lag is how far a consumer is behind the end of its subject.
+type Lag struct {
+	// Pending is the number of sequences after the consumer's position.
+	// On compacted subjects some of them may no longer be stored.
+	Pending uint64
+	// Oldest is the time of the first pending record, zero when there is
+	// none.
+	Oldest time.Time
+}
+
+// ConsumerLag returns the lag of the consumer. Records removed by
+// retention do not count as pending.
+func (s *Store) ConsumerLag(c Consumer) (Lag, error) {
+	info, err := s.Info(c.Subject)
+	if err != nil {
+		return Lag{}, err
+	}
+
+	start := max(c.AckSeq+1, info.FirstSeq)
+	if start > info.LastSeq {
+		return Lag{}, nil
+	}
+
+	lag := Lag{Pending: info.LastSeq - start + 1}
+	recs, err := s.Read(c.Subject, start, 1)
+	if err != nil {
+		return Lag{}, err
+	}
+	if len(recs) > 0 {
+		lag.Oldest = recs[0].Time
+	}
+	return lag, nil
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"os"
+	"time"
+)
+
+// recordMeta is what retention needs to know about a record without
+// keeping its payload.
+type recordMeta struct {
+	seq  uint64
+	size int64
+	time time.Time
+}
+
+func (l *subjectLog) messages() int {
+	n := -l.hidden
+	for _, seg := range l.segments {
+		n += seg.count
+	}
+	return n
+}
+
+func (l *subjectLog) bytes() int64 {
+	n := -l.hiddenBytes
+	for _, seg := range l.segments {
+		n += seg.size
+	}
+	return n
+}
+
+// full reports whether appending n records of size bytes in total would
+// exceed a limit.
+func (l *subjectLog) full(n int, size int64) bool {
+	cfg := l.config
+	return (cfg.MaxMessages > 0 && l.messages()+n > cfg.MaxMessages) ||
+		(cfg.MaxBytes > 0 && l.bytes()+size > cfg.MaxBytes)
+}
+
+// overLimits reports whether the subject holds more than its message or
+// byte limit.
+func (l *subjectLog) overLimits() bool {
+	cfg := l.config
+	return (cfg.MaxMessages > 0 && l.messages() > cfg.MaxMessages) ||
+		(cfg.MaxBytes > 0 && l.bytes() > cfg.MaxBytes)
+}
+
+// expired reports whether rec, the oldest retained record, has to go.
+func (l *subjectLog) expired(rec recordMeta, now time.Time) bool {
+	if l.config.MaxAge > 0 && now.Sub(rec.time) > l.config.MaxAge {
+		return true
+	}
+	return l.config.Discard == DiscardOld && l.overLimits()
+}
+
+// oldest returns the first segment that holds records.
+func (l *subjectLog) oldest() *segment {
+	for _, seg := range l.segments {
+		if seg.count > 0 {
+			return seg
+		}
+	}
+	return nil
+}
+
+// enforceRetention drops the oldest records while the subject exceeds its
+// limits. Records are hidden by raising the floor and a segment file is
+// removed once all of its records are below it; the active segment is
+// never removed.
+func (l *subjectLog) enforceRetention(now time.Time) error {
+	cfg := l.config
+	if cfg.MaxAge <= 0 && cfg.MaxMessages <= 0 && cfg.MaxBytes <= 0 {
+		return nil
+	}
+
+	l.maintenance.Lock()
+	defer l.maintenance.Unlock()
+
+	for {
+		l.mu.Lock()
+		seg := l.oldest()
+		if seg == nil {
+			l.mu.Unlock()
+			return nil
+		}
+		if l.indexed != seg || len(l.index) == 0 {
+			view := segmentView{path: seg.path, limit: seg.size}
+			l.mu.Unlock()
+
+			// floor only changes under maintenance, which is held.
+			index, err := loadIndex(view, l.floor)
+			if err != nil {
+				return err
+			}
+
+			l.mu.Lock()
+			l.index, l.indexed = index, seg
+			if len(index) == 0 {
+				l.mu.Unlock()
+				return nil
+			}
+		}
+
+		rec := l.index[0]
+		if !l.expired(rec, now) {
+			l.mu.Unlock()
+			return nil
+		}
+		l.index = l.index[1:]
+		l.floor = rec.seq + 1
+		l.hidden++
+		l.hiddenBytes += rec.size
+
+		if seg != l.active() && l.floor > seg.last {
+			if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+				l.mu.Unlock()
+				return err
+			}
+			l.removeSegment(seg)
+			l.hidden, l.hiddenBytes = 0, 0
+			l.index, l.indexed = nil, nil
+		}
+		l.mu.Unlock()
+	}
+}
+
+// loadIndex reads the metadata of the records in view from floor on.
+func loadIndex(view segmentView, floor uint64) ([]recordMeta, error) {
+	var index []recordMeta
+	err := scanSegment(view.path, view.limit, func(rec Record) bool {
+		if rec.Seq < floor {
+			return true
+		}
+		line, err := encodeRecord(rec)
+		if err != nil {
+			return false
+		}
+		index = append(index, recordMeta{seq: rec.Seq, size: int64(len(line)), time: rec.Time})
+		return true
+	})
+	return index, err
+}
+
+// EnforceRetention applies the limits of subject right away instead of
+// waiting for the background loop.
+func (s *Store) EnforceRetention(subject string) error {
+	l, err := s.log(subject)
+	if err != nil {
+		return err
+	}
+	return l.enforceRetention(time.Now())
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	segmentExt = ".log"
+	compactExt = ".compact"
+)
+
+// segment is one append-only file of a subject log. Records are stored as
+// JSON lines in sequence order; compaction may leave gaps.
+type segment struct {
+	path  string
+	base  uint64
+	first uint64
+	last  uint64
+	count int
+	size  int64
+	// newest is the time of the last record, used by age-based retention.
+	newest time.Time
+	file   *os.File
+}
+
+func segmentPath(dir string, base uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+// listSegments loads the segments of a subject directory in order.
+func listSegments(dir string) ([]*segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segs []*segment
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, compactExt) {
+			// Left behind by a compaction that was interrupted.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := &segment{path: filepath.Join(dir, name), base: base}
+		if err := seg.load(); err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+	}
+
+	sort.Slice(segs, func(i, j int) bool { return segs[i].base < segs[j].base })
+	return segs, nil
+}
+
+// load scans the file to rebuild the segment metadata. A torn last line
+// left by a crash is truncated away.
+func (s *segment) load() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return os.Truncate(s.path, offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("store: corrupt record in %s at offset %d: %w", s.path, offset, err)
+		}
+		s.add(rec, int64(len(line)))
+		offset += int64(len(line))
+	}
+}
+
+func (s *segment) add(rec Record, size int64) {
+	if s.count == 0 {
+		s.first = rec.Seq
+	}
+	s.last = rec.Seq
+	s.count++
+	s.size += size
+	s.newest = rec.Time
+}
+
+func (s *segment) openForAppend() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+// write appends rec, already encoded as line, to the file.
+func (s *segment) write(rec Record, line []byte) error {
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	s.add(rec, int64(len(line)))
+	return nil
+}
+
+func (s *segment) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func encodeRecord(rec Record) ([]byte, error) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// scanSegment calls fn for the records of the file at path, reading at
+// most limit bytes so that a concurrently appended segment is only read
+// up to a complete record. fn returns false to stop.
+func scanSegment(path string, limit int64, fn func(Record) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(io.LimitReader(f, limit))
+	sc.Buffer(nil, maxRecordSize)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("store: corrupt record in %s: %w", path, err)
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
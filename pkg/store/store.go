@@ -0,0 +1,617 @@
+// Package store persists the messages of selected subjects in append-only
+// segment files, one directory per subject.
+package store
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultSegmentSize        = 4 << 20
+	defaultTombstoneRetention = 24 * time.Hour
+	maxRecordSize             = 16 << 20
+	// retentionInterval is how often age limits are checked for subjects
+	// that receive no appends.
+	retentionInterval = time.Second
+)
+
+var (
+	ErrNotPersisted = errors.New("store: subject is not persisted")
+	ErrClosed       = errors.New("store: closed")
+	// ErrSubjectFull is returned by Append for subjects with DiscardNew
+	// whose message or byte limit is reached.
+	ErrSubjectFull = errors.New("store: subject is full")
+)
+
+// Record is a stored message. Seq is assigned by the store and increases
+// by one for every message appended to a subject.
+type Record struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Key identifies the entity the message describes. Compacted subjects
+	// keep only the latest record per key.
+	Key string `json:"key,omitempty"`
+	// Tombstone marks the deletion of Key.
+	Tombstone bool              `json:"tombstone,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Data      []byte            `json:"data,omitempty"`
+	// ContentType is the MIME type of Data.
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// Discard selects what happens when a subject reaches its limits.
+type Discard int
+
+const (
+	// DiscardOld removes the oldest messages to make room.
+	DiscardOld Discard = iota
+	// DiscardNew rejects appends with ErrSubjectFull.
+	DiscardNew
+)
+
+type SubjectConfig struct {
+	// Subject is a subject name or a pattern of dot-separated tokens where
+	// "*" matches one token and a trailing ">" matches one or more.
+	Subject string
+	// Compact keeps only the latest record per key in sealed segments.
+	Compact bool
+	// TombstoneRetention is how long compaction keeps tombstones so that
+	// consumers can observe deletes. Zero means 24h.
+	TombstoneRetention time.Duration
+	// MaxAge, MaxMessages and MaxBytes limit what is retained; zero means
+	// no limit. MaxAge always removes expired messages, whatever Discard
+	// is set to.
+	MaxAge      time.Duration
+	MaxMessages int
+	MaxBytes    int64
+	Discard     Discard
+}
+
+type Options struct {
+	Dir string
+	// SegmentSize is the size in bytes after which a new segment file is
+	// started. Zero means 4 MiB.
+	SegmentSize int64
+	// CompactionInterval is how often compacted subjects are compacted in
+	// the background. Zero disables background compaction.
+	CompactionInterval time.Duration
+	// Subjects are matched in order; the first match configures a subject.
+	Subjects []SubjectConfig
+}
+
+type Store struct {
+	opts      Options
+	mu        sync.Mutex
+	logs      map[string]*subjectLog
+	consumers consumerTable
+	closed    bool
+	stop      chan struct{}
+	wake      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// subjectLog is the ordered list of segments of one subject. The last
+// segment is the active one that receives appends.
+type subjectLog struct {
+	mu       sync.Mutex
+	subject  string
+	dir      string
+	config   SubjectConfig
+	segments []*segment
+	lastSeq  uint64
+
+	// floor is the first sequence retention keeps. Records below it in
+	// the oldest segment are hidden until the whole segment is removed;
+	// hidden and hiddenBytes account for them.
+	floor       uint64
+	hidden      int
+	hiddenBytes int64
+	// index lists the records of the oldest segment from floor on. It is
+	// loaded by retention and only valid while indexed is that segment.
+	index   []recordMeta
+	indexed *segment
+
+	// appended is closed on the next append to wake readers in Wait.
+	appended chan struct{}
+
+	// maintenance serializes compaction and retention, which both run in
+	// the background.
+	maintenance sync.Mutex
+}
+
+func Open(opts Options) (*Store, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		opts: opts,
+		logs: make(map[string]*subjectLog),
+		stop: make(chan struct{}),
+		wake: make(chan struct{}, 1),
+	}
+	if err := s.openExisting(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if err := s.consumers.load(filepath.Join(opts.Dir, consumersFile)); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.maintainLoop()
+	return s, nil
+}
+
+// openExisting opens the logs found on disk whose subject is still
+// configured, so that they are listed and retained before their next
+// append.
+func (s *Store) openExisting() error {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		subject, err := url.PathUnescape(e.Name())
+		if err != nil || !s.Persisted(subject) {
+			continue
+		}
+		if _, err := s.log(subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) config(subject string) (SubjectConfig, bool) {
+	for _, cfg := range s.opts.Subjects {
+		if MatchSubject(cfg.Subject, subject) {
+			return cfg, true
+		}
+	}
+	return SubjectConfig{}, false
+}
+
+// Persisted reports whether messages of subject are stored.
+func (s *Store) Persisted(subject string) bool {
+	_, ok := s.config(subject)
+	return ok
+}
+
+// MatchSubject reports whether subject matches pattern. Tokens are
+// separated by dots; "*" matches any one token and a final ">" matches
+// one or more remaining tokens.
+func MatchSubject(pattern, subject string) bool {
+	if pattern == subject {
+		return true
+	}
+
+	pt := strings.Split(pattern, ".")
+	st := strings.Split(subject, ".")
+	for i, p := range pt {
+		if p == ">" && i == len(pt)-1 {
+			return len(st) > i
+		}
+		if i >= len(st) || (p != "*" && p != st[i]) {
+			return false
+		}
+	}
+	return len(pt) == len(st)
+}
+
+func subjectDir(subject string) string {
+	name := url.PathEscape(subject)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return name
+}
+
+// log returns the log of subject, opening it on first use.
+func (s *Store) log(subject string) (*subjectLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if l, ok := s.logs[subject]; ok {
+		return l, nil
+	}
+
+	cfg, ok := s.config(subject)
+	if !ok {
+		return nil, ErrNotPersisted
+	}
+
+	l := &subjectLog{
+		subject: subject,
+		dir:     filepath.Join(s.opts.Dir, subjectDir(subject)),
+		config:  cfg,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	s.logs[subject] = l
+	return l, nil
+}
+
+func (l *subjectLog) open() error {
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+
+	segs, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	if len(segs) == 0 {
+		segs = []*segment{{path: segmentPath(l.dir, 1), base: 1}}
+	}
+
+	// The active segment is created as soon as the previous one is
+	// sealed, so its base remembers the next sequence even when every
+	// record before it was removed.
+	active := segs[len(segs)-1]
+	l.lastSeq = active.base - 1
+	if active.count > 0 {
+		l.lastSeq = active.last
+	}
+	if err := active.openForAppend(); err != nil {
+		return err
+	}
+
+	l.segments = segs
+	return nil
+}
+
+func (l *subjectLog) active() *segment {
+	return l.segments[len(l.segments)-1]
+}
+
+// Append stores rec under the next sequence of subject and returns it
+// with Seq and Time set.
+func (s *Store) Append(subject string, rec Record) (Record, error) {
+	l, err := s.log(subject)
+	if err != nil {
+		return Record{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	rec.Seq = l.lastSeq + 1
+
+	line, err := encodeRecord(rec)
+	if err != nil {
+		return Record{}, err
+	}
+	if l.config.Discard == DiscardNew && l.full(1, int64(len(line))) {
+		return Record{}, ErrSubjectFull
+	}
+
+	if active := l.active(); active.count > 0 && active.size >= s.opts.SegmentSize {
+		if err := l.roll(rec.Seq); err != nil {
+			return Record{}, err
+		}
+	}
+	if err := l.active().write(rec, line); err != nil {
+		return Record{}, err
+	}
+	l.lastSeq = rec.Seq
+
+	s.appended(l)
+	return rec, nil
+}
+
+// appended wakes the readers waiting for records of l and the retention
+// of a subject that went over its limits. l.mu is held.
+func (s *Store) appended(l *subjectLog) {
+	if l.appended != nil {
+		close(l.appended)
+		l.appended = nil
+	}
+	if l.config.Discard == DiscardOld && l.overLimits() {
+		s.signal()
+	}
+}
+
+// roll seals the active segment and starts a new one at base.
+func (l *subjectLog) roll(base uint64) error {
+	seg := &segment{path: segmentPath(l.dir, base), base: base}
+	if err := seg.openForAppend(); err != nil {
+		return err
+	}
+	if err := l.active().close(); err != nil {
+		seg.close()
+		return err
+	}
+	l.segments = append(l.segments, seg)
+	return nil
+}
+
+type segmentView struct {
+	path  string
+	limit int64
+}
+
+// Read returns up to max records of subject with sequence >= from.
+func (s *Store) Read(subject string, from uint64, max int) ([]Record, error) {
+	l, err := s.log(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	if from < l.floor {
+		from = l.floor
+	}
+	var views []segmentView
+	for _, seg := range l.segments {
+		if seg.count > 0 && seg.last >= from {
+			views = append(views, segmentView{path: seg.path, limit: seg.size})
+		}
+	}
+	l.mu.Unlock()
+
+	var out []Record
+	for _, v := range views {
+		err := scanSegment(v.path, v.limit, func(rec Record) bool {
+			if rec.Seq >= from {
+				out = append(out, rec)
+			}
+			return max <= 0 || len(out) < max
+		})
+		// A sealed segment may be removed by compaction or retention
+		// between taking the view and opening it; its records are gone
+		// by then.
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if max > 0 && len(out) >= max {
+			break
+		}
+	}
+	return out, nil
+}
+
+// LastSeq returns the sequence of the last record appended to subject.
+func (s *Store) LastSeq(subject string) (uint64, error) {
+	l, err := s.log(subject)
+	if err != nil {
+		return 0, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastSeq, nil
+}
+
+// Wait blocks until a record with a sequence above after is appended to
+// subject, ctx ends or the store is closed.
+func (s *Store) Wait(ctx context.Context, subject string, after uint64) error {
+	l, err := s.log(subject)
+	if err != nil {
+		return err
+	}
+
+	for {
+		l.mu.Lock()
+		if l.lastSeq > after {
+			l.mu.Unlock()
+			return nil
+		}
+		if l.appended == nil {
+			l.appended = make(chan struct{})
+		}
+		appended := l.appended
+		l.mu.Unlock()
+
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.stop:
+			return ErrClosed
+		}
+	}
+}
+
+// SeqAt returns the sequence of the first retained record of subject
+// stored at or after t, or the next sequence when there is none.
+func (s *Store) SeqAt(subject string, t time.Time) (uint64, error) {
+	l, err := s.log(subject)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	next := l.lastSeq + 1
+	floor := l.floor
+	var views []segmentView
+	for _, seg := range l.segments {
+		if seg.count > 0 && !seg.newest.Before(t) {
+			views = append(views, segmentView{path: seg.path, limit: seg.size})
+		}
+	}
+	l.mu.Unlock()
+
+	seq := next
+	for _, v := range views {
+		err := scanSegment(v.path, v.limit, func(rec Record) bool {
+			if rec.Seq >= floor && !rec.Time.Before(t) {
+				seq = rec.Seq
+				return false
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		if seq != next {
+			break
+		}
+	}
+	return seq, nil
+}
+
+// SubjectInfo describes the retained messages of a persisted subject.
+type SubjectInfo struct {
+	Subject  string
+	Config   SubjectConfig
+	FirstSeq uint64
+	LastSeq  uint64
+	Messages int
+	Bytes    int64
+	Segments int
+}
+
+func (l *subjectLog) info() SubjectInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info := SubjectInfo{
+		Subject:  l.subject,
+		Config:   l.config,
+		LastSeq:  l.lastSeq,
+		Messages: l.messages(),
+		Bytes:    l.bytes(),
+		Segments: len(l.segments),
+	}
+	info.FirstSeq = l.lastSeq + 1
+	for _, seg := range l.segments {
+		if seg.count > 0 {
+			info.FirstSeq = max(seg.first, l.floor)
+			break
+		}
+	}
+	return info
+}
+
+// Info returns the state of a persisted subject.
+func (s *Store) Info(subject string) (SubjectInfo, error) {
+	l, err := s.log(subject)
+	if err != nil {
+		return SubjectInfo{}, err
+	}
+	return l.info(), nil
+}
+
+// Subjects returns the state of every persisted subject, sorted by name.
+func (s *Store) Subjects() []SubjectInfo {
+	logs := s.logsSnapshot()
+	infos := make([]SubjectInfo, 0, len(logs))
+	for _, l := range logs {
+		infos = append(infos, l.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Subject < infos[j].Subject })
+	return infos
+}
+
+func (s *Store) logsSnapshot() []*subjectLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logs := make([]*subjectLog, 0, len(s.logs))
+	for _, l := range s.logs {
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+// signal wakes the maintenance loop to enforce limits right away.
+func (s *Store) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Store) maintainLoop() {
+	defer s.wg.Done()
+
+	retention := time.NewTicker(retentionInterval)
+	defer retention.Stop()
+
+	var compaction <-chan time.Time
+	if s.opts.CompactionInterval > 0 {
+		t := time.NewTicker(s.opts.CompactionInterval)
+		defer t.Stop()
+		compaction = t.C
+	}
+
+	// Logs reopened from disk may hold records the limits no longer allow.
+	s.enforceRetention()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+			s.enforceRetention()
+		case <-retention.C:
+			s.enforceRetention()
+			if err := s.consumers.flush(); err != nil {
+				log.Error().Err(err).Msg("Failed to save consumers")
+			}
+		case <-compaction:
+			for _, l := range s.logsSnapshot() {
+				if !l.config.Compact {
+					continue
+				}
+				if err := l.compact(time.Now()); err != nil {
+					log.Error().Err(err).Str("subject", l.subject).Msg("Compaction failed")
+				}
+			}
+		}
+	}
+}
+
+func (s *Store) enforceRetention() {
+	for _, l := range s.logsSnapshot() {
+		if err := l.enforceRetention(time.Now()); err != nil {
+			log.Error().Err(err).Str("subject", l.subject).Msg("Retention failed")
+		}
+	}
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	s.wg.Wait()
+
+	errs := []error{s.consumers.flush()}
+	for _, l := range s.logsSnapshot() {
+		l.maintenance.Lock()
+		l.mu.Lock()
+		errs = append(errs, l.active().close())
+		l.mu.Unlock()
+		l.maintenance.Unlock()
+	}
+	return errors.Join(errs...)
+}
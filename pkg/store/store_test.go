@@ -0,0 +1,463 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T, dir string, subjects ...SubjectConfig) *Store {
+	t.Helper()
+	s, err := Open(Options{Dir: dir, SegmentSize: 200, Subjects: subjects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestAppendRead(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "orders"})
+
+	if _, err := s.Append("other", Record{}); err != ErrNotPersisted {
+		t.Errorf("Expected ErrNotPersisted, got %v", err)
+	}
+
+	for i := 1; i <= 20; i++ {
+		rec, err := s.Append("orders", Record{Data: []byte(fmt.Sprintf("msg %d", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Seq != uint64(i) || rec.Time.IsZero() {
+			t.Fatalf("Unexpected record %+v", rec)
+		}
+	}
+
+	recs, err := s.Read("orders", 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || recs[0].Seq != 5 || string(recs[2].Data) != "msg 7" {
+		t.Errorf("Unexpected records %+v", recs)
+	}
+
+	all, _ := s.Read("orders", 1, 0)
+	if len(all) != 20 {
+		t.Errorf("Expected 20 records, got %d", len(all))
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := SubjectConfig{Subject: "orders"}
+
+	s, err := Open(Options{Dir: dir, SegmentSize: 200, Subjects: []SubjectConfig{cfg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s.Append("orders", Record{Data: []byte("x")})
+	}
+	s.Close()
+
+	// Simulate a crash in the middle of writing a record.
+	segs, _ := filepath.Glob(filepath.Join(dir, "orders", "*.log"))
+	if len(segs) < 2 {
+		t.Fatalf("Expected several segments, got %v", segs)
+	}
+	f, _ := os.OpenFile(segs[len(segs)-1], os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"seq":11,"da`)
+	f.Close()
+
+	s = openStore(t, dir, cfg)
+	last, _ := s.LastSeq("orders")
+	if last != 10 {
+		t.Errorf("Expected last sequence 10, got %d", last)
+	}
+	rec, err := s.Append("orders", Record{Data: []byte("y")})
+	if err != nil || rec.Seq != 11 {
+		t.Errorf("Expected sequence 11 after reopen, got %d, %v", rec.Seq, err)
+	}
+	recs, err := s.Read("orders", 1, 0)
+	if err != nil || len(recs) != 11 {
+		t.Errorf("Expected 11 readable records, got %d, %v", len(recs), err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, SubjectConfig{Subject: "users", Compact: true, TombstoneRetention: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		for _, key := range []string{"alice", "bob", "carol"} {
+			s.Append("users", Record{Key: key, Data: []byte(fmt.Sprintf("%s v%d", key, i))})
+		}
+	}
+	s.Append("users", Record{Data: []byte("unkeyed")})
+	s.Append("users", Record{Key: "bob", Tombstone: true})
+	old := time.Now().Add(-2 * time.Hour)
+	s.Append("users", Record{Key: "carol", Tombstone: true, Time: old})
+	// Push the tombstones into a sealed segment.
+	for i := 0; i < 10; i++ {
+		s.Append("users", Record{Key: "alice", Data: []byte("alice latest")})
+	}
+
+	if err := s.Compact("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.Read("users", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byKey := make(map[string][]Record)
+	for _, rec := range recs {
+		byKey[rec.Key] = append(byKey[rec.Key], rec)
+	}
+	if len(byKey[""]) != 1 {
+		t.Errorf("Expected unkeyed record to be kept, got %v", byKey[""])
+	}
+	if bob := byKey["bob"]; len(bob) != 1 || !bob[0].Tombstone {
+		t.Errorf("Expected only bob's tombstone to remain, got %+v", bob)
+	}
+	if carol := byKey["carol"]; len(carol) != 0 {
+		t.Errorf("Expected carol's expired tombstone to be removed, got %+v", carol)
+	}
+	for _, rec := range byKey["alice"][:len(byKey["alice"])-1] {
+		if string(rec.Data) != "alice latest" {
+			t.Errorf("Superseded record survived in a sealed segment: %+v", rec)
+		}
+	}
+
+	last, _ := s.LastSeq("users")
+	rec, _ := s.Append("users", Record{Key: "dave"})
+	if rec.Seq != last+1 {
+		t.Errorf("Compaction changed the sequence: %d after %d", rec.Seq, last)
+	}
+}
+
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders.new", false},
+		{"orders.*", "orders.new", true},
+		{"orders.*", "orders.new.eu", false},
+		{"orders.>", "orders.new.eu", true},
+		{"orders.>", "orders", false},
+		{"*.state", "users.state", true},
+		{">", "anything", true},
+	}
+	for _, tt := range tests {
+		if got := MatchSubject(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("MatchSubject(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestRetentionMaxMessages(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "logs.>", MaxMessages: 5})
+
+	for i := 1; i <= 20; i++ {
+		if _, err := s.Append("logs.app", Record{Data: []byte(fmt.Sprintf("msg %d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.EnforceRetention("logs.app"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Info("logs.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Messages != 5 || info.FirstSeq != 16 || info.LastSeq != 20 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	recs, _ := s.Read("logs.app", 1, 0)
+	if len(recs) != 5 || recs[0].Seq != 16 {
+		t.Errorf("Unexpected records %+v", recs)
+	}
+	if info.Segments > 3 {
+		t.Errorf("Expected old segments to be removed, got %d", info.Segments)
+	}
+}
+
+func TestRetentionMaxBytes(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "logs", MaxBytes: 300})
+
+	for i := 1; i <= 20; i++ {
+		if _, err := s.Append("logs", Record{Data: []byte("payload")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.EnforceRetention("logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := s.Info("logs")
+	if info.Bytes > 300 || info.Messages == 0 || info.LastSeq != 20 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "events", MaxAge: time.Hour, Discard: DiscardNew})
+
+	old := time.Now().Add(-2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := s.Append("events", Record{Time: old}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Append("events", Record{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnforceRetention("events"); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, _ := s.Read("events", 0, 0)
+	if len(recs) != 1 || recs[0].Seq != 4 {
+		t.Errorf("Expected only the recent record, got %+v", recs)
+	}
+}
+
+func TestDiscardNew(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "jobs", MaxMessages: 3, Discard: DiscardNew})
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Append("jobs", Record{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Append("jobs", Record{}); err != ErrSubjectFull {
+		t.Errorf("Expected ErrSubjectFull, got %v", err)
+	}
+	if seq, _ := s.LastSeq("jobs"); seq != 3 {
+		t.Errorf("Expected last sequence 3, got %d", seq)
+	}
+}
+
+func TestRetentionInBackground(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, SubjectConfig{Subject: "metrics", MaxMessages: 2})
+	for i := 0; i < 10; i++ {
+		if _, err := s.Append("metrics", Record{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, _ := s.Info("metrics")
+		if info.Messages == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Retention did not run, info %+v", info)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.Close()
+	reopened := openStore(t, dir, SubjectConfig{Subject: "metrics", MaxMessages: 2})
+	subjects := reopened.Subjects()
+	if len(subjects) != 1 || subjects[0].Subject != "metrics" || subjects[0].LastSeq != 10 {
+		t.Errorf("Unexpected subjects after reopen %+v", subjects)
+	}
+}
+
+func TestConsumers(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, SubjectConfig{Subject: "orders"})
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.Append("orders", Record{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := s.OpenConsumer("billing", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AckSeq != 5 {
+		t.Errorf("Expected a new consumer to start at the end, got %+v", c)
+	}
+	if _, err := s.OpenConsumer("billing", "other"); err != ErrNotPersisted {
+		t.Errorf("Expected ErrNotPersisted, got %v", err)
+	}
+
+	if _, err := s.ResetConsumer("billing", "orders", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack("billing", "orders", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack("billing", "orders", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack("billing", "orders", 6); err != ErrInvalidAck {
+		t.Errorf("Expected ErrInvalidAck, got %v", err)
+	}
+	if err := s.Ack("shipping", "orders", 1); err != ErrConsumerNotFound {
+		t.Errorf("Expected ErrConsumerNotFound, got %v", err)
+	}
+
+	s.Close()
+	s = openStore(t, dir, SubjectConfig{Subject: "orders"})
+	c, err = s.GetConsumer("billing", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AckSeq != 3 || c.Resets != 1 {
+		t.Errorf("Unexpected consumer after reopen %+v", c)
+	}
+
+	if err := s.DeleteConsumer("billing", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Consumers()) != 0 {
+		t.Errorf("Expected no consumers, got %+v", s.Consumers())
+	}
+}
+
+func TestResetConsumerToTime(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "orders"})
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		if _, err := s.Append("orders", Record{Time: start.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.OpenConsumer("audit", "orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.ResetConsumerToTime("audit", "orders", start.Add(4*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AckSeq != 4 {
+		t.Errorf("Expected position before sequence 5, got %+v", c)
+	}
+	c, _ = s.ResetConsumerToTime("audit", "orders", time.Now())
+	if c.AckSeq != 10 {
+		t.Errorf("Expected position at the end, got %+v", c)
+	}
+}
+
+func TestWait(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "orders"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Wait(ctx, "orders", 0); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Wait(context.Background(), "orders", 0) }()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := s.Append("orders", Record{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after an append")
+	}
+}
+
+func TestConsumerLag(t *testing.T) {
+	s := openStore(t, t.TempDir(), SubjectConfig{Subject: "orders", MaxMessages: 5})
+
+	c, err := s.OpenConsumer("billing", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag, _ := s.ConsumerLag(c); lag.Pending != 0 || !lag.Oldest.IsZero() {
+		t.Errorf("Expected no lag, got %+v", lag)
+	}
+
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 8; i++ {
+		if _, err := s.Append("orders", Record{Time: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.EnforceRetention("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	lag, err := s.ConsumerLag(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag.Pending != 5 || !lag.Oldest.Equal(start.Add(3*time.Second)) {
+		t.Errorf("Expected lag of the retained records, got %+v", lag)
+	}
+
+	s.Ack("billing", "orders", 7)
+	c, _ = s.GetConsumer("billing", "orders")
+	if lag, _ := s.ConsumerLag(c); lag.Pending != 1 {
+		t.Errorf("Expected one pending record, got %+v", lag)
+	}
+}
+
+func TestAppendBatch(t *testing.T) {
+	dir := t.TempDir()
+	subjects := []SubjectConfig{{Subject: "orders"}, {Subject: "inventory", MaxMessages: 3, Discard: DiscardNew}}
+	s := openStore(t, dir, subjects...)
+
+	out, err := s.AppendBatch([]Entry{
+		{Subject: "orders", Record: Record{Data: []byte("created")}},
+		{Subject: "inventory", Record: Record{Data: []byte("reserved")}},
+		{Subject: "orders", Record: Record{Data: []byte("paid")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].Record.Seq != 1 || out[1].Record.Seq != 1 || out[2].Record.Seq != 2 {
+		t.Errorf("Unexpected sequences %+v", out)
+	}
+
+	_, err = s.AppendBatch([]Entry{
+		{Subject: "orders", Record: Record{Data: []byte("shipped")}},
+		{Subject: "inventory", Record: Record{}},
+		{Subject: "inventory", Record: Record{}},
+		{Subject: "inventory", Record: Record{}},
+	})
+	if err != ErrSubjectFull {
+		t.Errorf("Expected ErrSubjectFull, got %v", err)
+	}
+
+	if seq, _ := s.LastSeq("orders"); seq != 2 {
+		t.Errorf("Expected the refused batch to leave orders at 2, got %d", seq)
+	}
+	if _, err := s.Append("orders", Record{Data: []byte("shipped")}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+	s = openStore(t, dir, subjects...)
+	recs, _ := s.Read("orders", 1, 0)
+	if len(recs) != 3 || string(recs[2].Data) != "shipped" || recs[2].Seq != 3 {
+		t.Errorf("Unexpected orders after reopen %+v", recs)
+	}
+	recs, _ = s.Read("inventory", 1, 0)
+	if len(recs) != 1 {
+		t.Errorf("Unexpected inventory after reopen %+v", recs)
+	}
+}
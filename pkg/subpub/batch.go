@@ -0,0 +1,544 @@
+package subpub
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/StepanErshov/pubsub/pkg/store"
+)
+
+// ErrBatchFull is returned by PublishBatch without BlockWhenFull when a
+// subscriber's queue cannot take all of its messages of the batch.
+// Nothing of the batch was published.
+var ErrBatchFull = errors.New("subpub: subscriber queue cannot hold the batch")
+
+// BatchMessage is one message of a batch published with PublishBatch.
+type BatchMessage struct {
+	Subject string
+	Msg     interface{}
+	// ID deduplicates the message like WithMessageID.
+	ID string
+}
+
+// batchItem is a message of a batch with the subscribers it matched.
+type batchItem struct {
+	index int
+	msg   interface{}
+	subs  []*subscription
+}
+
+// PublishBatch publishes msgs as one transaction: either every message is
+// persisted and queued for all of its matched subscribers, or none is.
+// The messages become visible to subscribers at the same time, and
+// batches are serialized, so subscribers of different subjects observe
+// them in the same order. Duplicates are skipped and reported. With
+// BlockWhenFull the batch waits until every queue has room for it;
+// WithQuorum does not apply.
+func (b *subPubImpl) PublishBatch(ctx context.Context, msgs []BatchMessage, opts ...PublishOption) ([]PublishReport, error) {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	reports, wg, err := b.publishBatch(ctx, msgs, o)
+	if err != nil || wg == nil {
+		return reports, err
+	}
+	return reports, waitCtx(ctx, wg)
+}
+
+func (b *subPubImpl) publishBatch(ctx context.Context, msgs []BatchMessage, o publishOptions) ([]PublishReport, *sync.WaitGroup, error) {
+	if b.closed.Load() {
+		return nil, nil, context.Canceled
+	}
+
+	reports := make([]PublishReport, len(msgs))
+	var (
+		items   []batchItem
+		entries []store.Entry
+		stored  []int
+		ids     []BatchMessage
+	)
+	fail := func(err error) ([]PublishReport, *sync.WaitGroup, error) {
+		for _, m := range ids {
+			b.dedup.remove(m.Subject, m.ID)
+		}
+		return nil, nil, err
+	}
+
+	for i, m := range msgs {
+		if b.dedup != nil && m.ID != "" {
+			if !b.dedup.add(m.Subject, m.ID) {
+				reports[i].Duplicate = true
+				b.stats.duplicates.Add(1)
+				continue
+			}
+			ids = append(ids, m)
+		}
+
+		if b.store != nil && b.store.Persisted(m.Subject) {
+			rec, err := toRecord(m.Msg)
+			if err != nil {
+				return fail(err)
+			}
+			entries = append(entries, store.Entry{Subject: m.Subject, Record: rec})
+			stored = append(stored, len(items))
+		}
+		items = append(items, batchItem{index: i, msg: m.Msg})
+	}
+
+	// The sequencers order the batch with other publishes to its persisted
+	// subjects. Room in the queues is reserved before anything is locked,
+	// so that waiting for it holds up neither those publishes nor other
+	// batches or readers of the store. A publish holding a sequencer may
+	// itself wait for the reserved room, so the room is given back while
+	// one of them is busy.
+	subs, need := b.matchBatch(msgs, items, reports)
+	var unlock func()
+	for {
+		if err := b.reserve(ctx, subs, need, o.block); err != nil {
+			return fail(err)
+		}
+		var ok bool
+		if unlock, ok = b.tryLockSequencers(entries); ok {
+			break
+		}
+		unreserve(subs, need)
+		b.lockSequencers(entries)()
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+	}
+	defer unlock()
+
+	b.batchMu.Lock()
+	defer b.batchMu.Unlock()
+
+	if len(entries) > 0 {
+		out, err := b.store.AppendBatch(entries)
+		if err != nil {
+			unreserve(subs, need)
+			return fail(err)
+		}
+		for k, e := range out {
+			item := &items[stored[k]]
+			item.msg = withSeq(item.msg, e.Record.Seq)
+			reports[item.index].Seq = e.Record.Seq
+		}
+	}
+
+	var wg *sync.WaitGroup
+	if o.wait {
+		wg = &sync.WaitGroup{}
+	}
+	b.enqueueBatch(items, reports, subs, need, wg)
+
+	b.stats.published.Add(uint64(len(items)))
+	for _, item := range items {
+		b.stats.enqueued.Add(uint64(reports[item.index].Enqueued))
+		b.stats.dropped.Add(uint64(reports[item.index].Dropped))
+	}
+	return reports, wg, nil
+}
+
+// lockSequencers locks the sequencers of the subjects of entries in
+// subject order and returns the function unlocking them.
+func (b *subPubImpl) lockSequencers(entries []store.Entry) func() {
+	subjects := entrySubjects(entries)
+	for _, subject := range subjects {
+		b.sequencer(subject).Lock()
+	}
+	return b.unlockSequencers(subjects)
+}
+
+// tryLockSequencers is like lockSequencers but locks none of the
+// sequencers when one of them is held.
+func (b *subPubImpl) tryLockSequencers(entries []store.Entry) (func(), bool) {
+	subjects := entrySubjects(entries)
+	for i, subject := range subjects {
+		if !b.sequencer(subject).TryLock() {
+			b.unlockSequencers(subjects[:i])()
+			return nil, false
+		}
+	}
+	return b.unlockSequencers(subjects), true
+}
+
+func (b *subPubImpl) unlockSequencers(subjects []string) func() {
+	return func() {
+		for _, subject := range subjects {
+			b.sequencer(subject).Unlock()
+		}
+	}
+}
+
+// entrySubjects returns the distinct subjects of entries in order.
+func entrySubjects(entries []store.Entry) []string {
+	subjects := make([]string, 0, len(entries))
+	for _, e := range entries {
+		subjects = append(subjects, e.Subject)
+	}
+	sort.Strings(subjects)
+	return slices.Compact(subjects)
+}
+
+// matchBatch finds the subscribers of the items and returns them with the
+// number of items each of them matched.
+func (b *subPubImpl) matchBatch(msgs []BatchMessage, items []batchItem, reports []PublishReport) ([]*subscription, map[*subscription]int) {
+	need := make(map[*subscription]int)
+	var subs []*subscription
+	for i := range items {
+		item := &items[i]
+		v, ok := b.subjects.Load(msgs[item.index].Subject)
+		if !ok {
+			continue
+		}
+		list := v.(*subjectEntry).subs.Load()
+		if list == nil {
+			continue
+		}
+		for _, sub := range *list {
+			if sub.filter != nil && !sub.filter(item.msg) {
+				continue
+			}
+			item.subs = append(item.subs, sub)
+			if need[sub] == 0 {
+				subs = append(subs, sub)
+			}
+			need[sub]++
+		}
+		reports[item.index].Matched = len(item.subs)
+	}
+	return subs, need
+}
+
+// lockMailboxes locks the mailboxes of subs. Batches lock several at once
+// and hold mailboxMu meanwhile, so that they cannot deadlock each other.
+func (b *subPubImpl) lockMailboxes(subs []*subscription) {
+	b.mailboxMu.Lock()
+	for _, sub := range subs {
+		sub.mailbox.mu.Lock()
+	}
+}
+
+func (b *subPubImpl) unlockMailboxes(subs []*subscription) {
+	for _, sub := range subs {
+		sub.mailbox.mu.Unlock()
+	}
+	b.mailboxMu.Unlock()
+}
+
+// reserve reserves room for need[sub] messages in the queue of every
+// subscriber only once all of them have it. With block it waits for room
+// until ctx ends, otherwise it fails with ErrBatchFull.
+func (b *subPubImpl) reserve(ctx context.Context, subs []*subscription, need map[*subscription]int, block bool) error {
+	for {
+		b.lockMailboxes(subs)
+		var full *subscription
+		for _, sub := range subs {
+			if sub.stopped {
+				continue
+			}
+			if need[sub] > sub.limit {
+				b.unlockMailboxes(subs)
+				return ErrBatchFull
+			}
+			if sub.room() < need[sub] {
+				full = sub
+				break
+			}
+		}
+		if full == nil {
+			for _, sub := range subs {
+				sub.reserved += need[sub]
+			}
+			b.unlockMailboxes(subs)
+			return nil
+		}
+		if !block {
+			b.unlockMailboxes(subs)
+			return ErrBatchFull
+		}
+
+		if full.space == nil {
+			full.space = make(chan struct{})
+		}
+		space := full.space
+		b.unlockMailboxes(subs)
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// unreserve gives back the room reserved for a batch that failed.
+func unreserve(subs []*subscription, need map[*subscription]int) {
+	for _, sub := range subs {
+		sub.mailbox.mu.Lock()
+		sub.reserved -= need[sub]
+		if sub.space != nil {
+			close(sub.space)
+			sub.space = nil
+		}
+		sub.mailbox.mu.Unlock()
+	}
+}
+
+// enqueueBatch queues the items in the room reserved for them. The
+// mailboxes of all subscribers are locked meanwhile, so that they see the
+// items at the same time.
+func (b *subPubImpl) enqueueBatch(items []batchItem, reports []PublishReport, subs []*subscription, need map[*subscription]int, wg *sync.WaitGroup) {
+	b.lockMailboxes(subs)
+	for _, sub := range subs {
+		sub.reserved -= need[sub]
+	}
+
+	var wake []*subscription
+	for _, item := range items {
+		e := envelope{msg: item.msg}
+		if wg != nil {
+			e.done = wg.Done
+		}
+		report := &reports[item.index]
+		for _, sub := range item.subs {
+			// A subscriber that is unsubscribing takes no more messages.
+			if sub.stopped {
+				report.Dropped++
+				continue
+			}
+			if wg != nil {
+				wg.Add(1)
+			}
+			if sub.pushLocked(e) {
+				wake = append(wake, sub)
+			}
+			report.Enqueued++
+		}
+	}
+	b.unlockMailboxes(subs)
+
+	for _, sub := range wake {
+		sub.engine.notify(sub)
+	}
+}
+
+// PublishEach publishes msgs independently, like a PublishAndWait call
+// per message, but amortizes the locking: consecutive messages to the
+// same subject are appended to the store and queued for each subscriber
+// in one step. The returned errors are indexed like msgs and nil for
+// messages that were published. WithQuorum does not apply.
+func (b *subPubImpl) PublishEach(ctx context.Context, msgs []BatchMessage, opts ...PublishOption) ([]PublishReport, []error) {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.quorum = 0
+
+	reports := make([]PublishReport, len(msgs))
+	errs := make([]error, len(msgs))
+	if b.closed.Load() {
+		for i := range errs {
+			errs[i] = context.Canceled
+		}
+		return reports, errs
+	}
+
+	var wg *sync.WaitGroup
+	if o.wait {
+		wg = &sync.WaitGroup{}
+	}
+	for start := 0; start < len(msgs); {
+		end := start + 1
+		for end < len(msgs) && msgs[end].Subject == msgs[start].Subject {
+			end++
+		}
+		b.publishRun(ctx, msgs[start:end], reports[start:end], errs[start:end], o, wg)
+		start = end
+	}
+
+	if wg != nil {
+		if err := waitCtx(ctx, wg); err != nil {
+			for i := range errs {
+				if errs[i] == nil && reports[i].Enqueued > 0 {
+					errs[i] = err
+				}
+			}
+		}
+	}
+	return reports, errs
+}
+
+// runItem is a message of a run of PublishEach with its outcome.
+type runItem struct {
+	msg    interface{}
+	id     string
+	report *PublishReport
+	err    *error
+}
+
+// publishRun publishes msgs, which share a subject.
+func (b *subPubImpl) publishRun(ctx context.Context, msgs []BatchMessage, reports []PublishReport, errs []error, o publishOptions, wg *sync.WaitGroup) {
+	subject := msgs[0].Subject
+
+	var (
+		items []runItem
+		ids   []string
+	)
+	for i, m := range msgs {
+		if b.dedup != nil && m.ID != "" {
+			if !b.dedup.add(subject, m.ID) {
+				reports[i].Duplicate = true
+				b.stats.duplicates.Add(1)
+				continue
+			}
+			ids = append(ids, m.ID)
+		}
+		items = append(items, runItem{msg: m.Msg, id: m.ID, report: &reports[i], err: &errs[i]})
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	if b.store == nil || !b.store.Persisted(subject) {
+		b.enqueueRun(ctx, subject, items, o, wg)
+		b.countRun(items)
+		// Like publish, a retry of a message that was not queued
+		// everywhere must not be swallowed as a duplicate.
+		for _, item := range items {
+			if item.id != "" && *item.err != nil {
+				b.dedup.remove(subject, item.id)
+			}
+		}
+		return
+	}
+
+	entries := make([]store.Entry, 0, len(items))
+	for _, item := range items {
+		rec, err := toRecord(item.msg)
+		if err != nil {
+			break
+		}
+		entries = append(entries, store.Entry{Subject: subject, Record: rec})
+	}
+	if len(entries) == len(items) {
+		// Like persist, the run is queued after the store is unlocked.
+		seq := b.sequencer(subject)
+		seq.Lock()
+		out, err := b.store.AppendBatch(entries)
+		if err == nil {
+			for k, e := range out {
+				items[k].msg = withSeq(items[k].msg, e.Record.Seq)
+				items[k].report.Seq = e.Record.Seq
+			}
+			b.enqueueRun(ctx, subject, items, o, wg)
+			seq.Unlock()
+			b.countRun(items)
+			return
+		}
+		seq.Unlock()
+	}
+
+	// The run cannot be stored in one piece, e.g. because the subject
+	// has room for part of it only. Publish its messages one by one so
+	// that each gets its own outcome.
+	for _, id := range ids {
+		b.dedup.remove(subject, id)
+	}
+	for i, m := range msgs {
+		if reports[i].Duplicate {
+			continue
+		}
+		mo := o
+		mo.id = m.ID
+		reports[i], errs[i] = b.publish(ctx, subject, m.Msg, mo)
+	}
+}
+
+func (b *subPubImpl) countRun(items []runItem) {
+	b.stats.published.Add(uint64(len(items)))
+	for _, item := range items {
+		b.stats.enqueued.Add(uint64(item.report.Enqueued))
+		b.stats.dropped.Add(uint64(item.report.Dropped))
+	}
+}
+
+// enqueueRun queues items for the matched subscribers of subject, taking
+// each mailbox lock once for all items that fit. With o.block the rest
+// wait for space one by one; otherwise they are dropped.
+func (b *subPubImpl) enqueueRun(ctx context.Context, subject string, items []runItem, o publishOptions, wg *sync.WaitGroup) {
+	v, ok := b.subjects.Load(subject)
+	if !ok {
+		return
+	}
+	subs := v.(*subjectEntry).subs.Load()
+	if subs == nil {
+		return
+	}
+
+	envelopes := make([]envelope, len(items))
+	for k, item := range items {
+		envelopes[k] = envelope{msg: item.msg}
+		if wg != nil {
+			envelopes[k].done = wg.Done
+		}
+	}
+
+	matched := make([]int, 0, len(items))
+	for _, sub := range *subs {
+		matched = matched[:0]
+		for k, item := range items {
+			if sub.filter != nil && !sub.filter(item.msg) {
+				continue
+			}
+			item.report.Matched++
+			matched = append(matched, k)
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		if wg != nil {
+			wg.Add(len(matched))
+		}
+		sub.mailbox.mu.Lock()
+		n := 0
+		wake := false
+		if !sub.stopped {
+			for ; n < len(matched) && sub.room() > 0; n++ {
+				wake = sub.pushLocked(envelopes[matched[n]]) || wake
+			}
+		}
+		sub.mailbox.mu.Unlock()
+		if wake {
+			sub.engine.notify(sub)
+		}
+		for _, k := range matched[:n] {
+			items[k].report.Enqueued++
+		}
+
+		var err error
+		for _, k := range matched[n:] {
+			ok := false
+			if o.block && err == nil {
+				ok, err = sub.enqueueWait(ctx, envelopes[k])
+			}
+			if ok {
+				items[k].report.Enqueued++
+				continue
+			}
+			items[k].report.Dropped++
+			if err != nil && *items[k].err == nil {
+				*items[k].err = err
+			}
+			if wg != nil {
+				wg.Done()
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package subpub
+
+import (
+	"sync"
+	"time"
+)
+
+// WithDeduplication remembers message IDs passed with WithMessageID for
+// the given window, keeping at most maxEntries of them. Publishing an ID
+// that is still remembered for the same subject is acknowledged without
+// delivering the message again.
+func WithDeduplication(window time.Duration, maxEntries int) Option {
+	return func(o *options) {
+		o.dedupWindow = window
+		o.dedupMax = maxEntries
+	}
+}
+
+// WithMessageID identifies the message for deduplication.
+func WithMessageID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.id = id
+	}
+}
+
+type dedupEntry struct {
+	key    string
+	serial uint64
+	seen   time.Time
+}
+
+// dedupWindow is a time- and count-bounded set of recently published
+// message IDs, evicted in insertion order.
+type dedupWindow struct {
+	mu     sync.Mutex
+	window time.Duration
+	max    int
+	seen   map[string]uint64
+	serial uint64
+	order  []dedupEntry
+	head   int
+	now    func() time.Time
+}
+
+func newDedupWindow(window time.Duration, max int) *dedupWindow {
+	return &dedupWindow{
+		window: window,
+		max:    max,
+		seen:   make(map[string]uint64),
+		now:    time.Now,
+	}
+}
+
+func dedupKey(subject, id string) string {
+	return subject + "\x00" + id
+}
+
+// add records the ID and reports false if it was already recorded.
+func (d *dedupWindow) add(subject, id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.evict(now)
+
+	key := dedupKey(subject, id)
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+
+	d.serial++
+	d.seen[key] = d.serial
+	if d.head > 0 && len(d.order) == cap(d.order) {
+		n := copy(d.order, d.order[d.head:])
+		clear(d.order[n:])
+		d.order = d.order[:n]
+		d.head = 0
+	}
+	d.order = append(d.order, dedupEntry{key: key, serial: d.serial, seen: now})
+	d.evict(now)
+	return true
+}
+
+// remove forgets an ID whose publish failed, so a retry is delivered.
+func (d *dedupWindow) remove(subject, id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, dedupKey(subject, id))
+}
+
+func (d *dedupWindow) evict(now time.Time) {
+	for d.head < len(d.order) {
+		e := d.order[d.head]
+		expired := d.window > 0 && now.Sub(e.seen) >= d.window
+		overflow := d.max > 0 && len(d.order)-d.head > d.max
+		if !expired && !overflow {
+			return
+		}
+		// A removed and re-added key has a newer entry; only forget it
+		// through that one.
+		if serial, ok := d.seen[e.key]; ok && serial == e.serial {
+			delete(d.seen, e.key)
+		}
+		d.order[d.head] = dedupEntry{}
+		d.head++
+	}
+}
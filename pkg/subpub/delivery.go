@@ -0,0 +1,285 @@
+package subpub
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+const (
+	defaultQueueSize = 100
+	// poolBatch bounds how many messages a pool worker handles for one
+	// subscription before yielding to the next ready subscription.
+	poolBatch = 64
+	// maxIdleCap is the largest buffer kept by an idle mailbox; larger
+	// buffers are released once drained.
+	maxIdleCap = 16
+)
+
+// envelope carries a message through the queues together with an
+// optional callback run after the handler returns.
+type envelope struct {
+	msg  interface{}
+	done func()
+}
+
+// mailbox is the bounded FIFO queue of one subscription. It holds no
+// memory while empty, so idle subscriptions stay small.
+type mailbox struct {
+	mu        sync.Mutex
+	buf       []envelope
+	head      int
+	limit     int
+	scheduled bool
+	stopped   bool
+	// reserved counts the free slots promised to atomic batches.
+	reserved int
+	// space is created by a blocked publisher and closed by the consumer
+	// once a message has been taken out.
+	space chan struct{}
+}
+
+// push appends msg unless the mailbox is full or stopped. wake reports
+// that the mailbox was idle and must be handed to the delivery engine.
+func (m *mailbox) push(e envelope) (ok, wake bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped || m.room() <= 0 {
+		return false, false
+	}
+	return true, m.pushLocked(e)
+}
+
+// pushLocked appends e without checking the limit. m.mu is held.
+func (m *mailbox) pushLocked(e envelope) (wake bool) {
+	if m.head > 0 && len(m.buf) == cap(m.buf) {
+		n := copy(m.buf, m.buf[m.head:])
+		clear(m.buf[n:])
+		m.buf = m.buf[:n]
+		m.head = 0
+	}
+	m.buf = append(m.buf, e)
+
+	if !m.scheduled {
+		m.scheduled = true
+		wake = true
+	}
+	return wake
+}
+
+// queued returns the number of messages in the mailbox. m.mu is held.
+func (m *mailbox) queued() int {
+	return len(m.buf) - m.head
+}
+
+// room returns how many more messages fit into the mailbox. m.mu is held.
+func (m *mailbox) room() int {
+	return m.limit - m.queued() - m.reserved
+}
+
+// pushWait is like push but waits for free space until ctx ends.
+func (m *mailbox) pushWait(ctx context.Context, e envelope) (ok, wake bool, err error) {
+	for {
+		if ok, wake = m.push(e); ok {
+			return ok, wake, nil
+		}
+
+		m.mu.Lock()
+		if m.stopped {
+			m.mu.Unlock()
+			return false, false, nil
+		}
+		if m.room() > 0 {
+			m.mu.Unlock()
+			continue
+		}
+		if m.space == nil {
+			m.space = make(chan struct{})
+		}
+		space := m.space
+		m.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return false, false, ctx.Err()
+		}
+	}
+}
+
+// next pops the oldest message. When the mailbox is empty it clears the
+// scheduled flag so the following push wakes the engine again.
+func (m *mailbox) next() (envelope, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.head == len(m.buf) {
+		if cap(m.buf) > maxIdleCap {
+			m.buf = nil
+		} else {
+			m.buf = m.buf[:0]
+		}
+		m.head = 0
+		m.scheduled = false
+		return envelope{}, false
+	}
+
+	e := m.buf[m.head]
+	m.buf[m.head] = envelope{}
+	m.head++
+	if m.space != nil {
+		close(m.space)
+		m.space = nil
+	}
+	return e, true
+}
+
+// stop refuses further messages and reports whether the mailbox is idle,
+// i.e. no engine is currently draining it.
+func (m *mailbox) stop() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+	if m.space != nil {
+		close(m.space)
+		m.space = nil
+	}
+	return !m.scheduled
+}
+
+func (m *mailbox) isStopped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopped
+}
+
+// deliveryEngine runs subscription handlers for messages queued in their
+// mailboxes.
+type deliveryEngine interface {
+	attach(sub *subscription)
+	notify(sub *subscription)
+	detach(sub *subscription)
+	shutdown()
+}
+
+// goroutineEngine runs one goroutine per subscription. It is the default
+// and gives each subscriber its own scheduling.
+type goroutineEngine struct {
+	wg *sync.WaitGroup
+}
+
+func (e *goroutineEngine) attach(sub *subscription) {
+	sub.wake = make(chan struct{}, 1)
+	sub.done = make(chan struct{})
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for {
+			select {
+			case <-sub.wake:
+				sub.drain(-1)
+			case <-sub.done:
+				sub.drain(-1)
+				return
+			}
+		}
+	}()
+}
+
+func (e *goroutineEngine) notify(sub *subscription) {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *goroutineEngine) detach(sub *subscription) {
+	close(sub.done)
+}
+
+func (e *goroutineEngine) shutdown() {}
+
+// poolEngine shares a fixed set of workers between all subscriptions.
+// A subscription is queued for the workers only while its mailbox is
+// non-empty, and at most once, which preserves per-subscriber ordering.
+type poolEngine struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ready  []*subscription
+	head   int
+	closed bool
+}
+
+func newPoolEngine(workers int, wg *sync.WaitGroup) *poolEngine {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	e := &poolEngine{}
+	e.cond = sync.NewCond(&e.mu)
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			e.work()
+		}()
+	}
+	return e
+}
+
+func (e *poolEngine) attach(sub *subscription) {}
+
+func (e *poolEngine) notify(sub *subscription) {
+	e.mu.Lock()
+	if e.head > 0 && len(e.ready) == cap(e.ready) {
+		n := copy(e.ready, e.ready[e.head:])
+		clear(e.ready[n:])
+		e.ready = e.ready[:n]
+		e.head = 0
+	}
+	e.ready = append(e.ready, sub)
+	e.mu.Unlock()
+	e.cond.Signal()
+}
+
+func (e *poolEngine) detach(sub *subscription) {}
+
+func (e *poolEngine) shutdown() {
+	e.mu.Lock()
+	e.closed = true
+	e.mu.Unlock()
+	e.cond.Broadcast()
+}
+
+func (e *poolEngine) take() (*subscription, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for e.head == len(e.ready) {
+		if e.closed {
+			return nil, false
+		}
+		e.ready, e.head = e.ready[:0], 0
+		e.cond.Wait()
+	}
+
+	sub := e.ready[e.head]
+	e.ready[e.head] = nil
+	e.head++
+	return sub, true
+}
+
+func (e *poolEngine) work() {
+	for {
+		sub, ok := e.take()
+		if !ok {
+			return
+		}
+		if sub.drain(poolBatch) {
+			e.notify(sub)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package subpub
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// KeyFunc extracts the partition key of a message. Messages with equal
+// keys are handled in publish order.
+type KeyFunc func(msg interface{}) string
+
+// HeaderKey partitions *Message values by the given header. Other values
+// all fall into the same partition.
+func HeaderKey(name string) KeyFunc {
+	return func(msg interface{}) string {
+		if m, ok := msg.(*Message); ok {
+			return m.Headers[name]
+		}
+		return ""
+	}
+}
+
+// WithConcurrency runs the handler on up to workers goroutines. Messages
+// are assigned to workers by the partition key, so messages with the same
+// key stay ordered while different keys are handled in parallel. A nil
+// key func puts every message in one partition. The subscription's queue
+// is dispatched to the workers by a goroutine of its own, also with
+// WithWorkerPool, so a busy partition delays no other subscription.
+func WithConcurrency(workers int, key KeyFunc) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.workers = workers
+		o.key = key
+	}
+}
+
+// partitioner fans the messages of one subscription out to a fixed set of
+// ordered lanes.
+type partitioner struct {
+	key   KeyFunc
+	lanes []chan envelope
+}
+
+func newPartitioner(workers int, key KeyFunc, handler MessageHandler, wg *sync.WaitGroup) *partitioner {
+	p := &partitioner{
+		key:   key,
+		lanes: make([]chan envelope, workers),
+	}
+
+	wg.Add(workers)
+	for i := range p.lanes {
+		lane := make(chan envelope, defaultQueueSize)
+		p.lanes[i] = lane
+		go func() {
+			defer wg.Done()
+			for e := range lane {
+				e.deliver(handler)
+			}
+		}()
+	}
+	return p
+}
+
+// dispatch hands msg to its lane, blocking while the lane is full so that
+// backpressure reaches the subscription's queue.
+func (p *partitioner) dispatch(e envelope) {
+	lane := 0
+	if p.key != nil {
+		h := fnv.New32a()
+		h.Write([]byte(p.key(e.msg)))
+		lane = int(h.Sum32() % uint32(len(p.lanes)))
+	}
+	p.lanes[lane] <- e
+}
+
+func (p *partitioner) close() {
+	for _, lane := range p.lanes {
+		close(lane)
+	}
+}
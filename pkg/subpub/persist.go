@@ -0,0 +1,57 @@
+package subpub
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/StepanErshov/pubsub/pkg/store"
+)
+
+var ErrNotPersistable = errors.New("subpub: message type cannot be persisted")
+
+// WithStore persists messages of the subjects configured in st before
+// they are delivered. Messages of persisted subjects must be *Message,
+// string or []byte.
+func WithStore(st *store.Store) Option {
+	return func(o *options) {
+		o.store = st
+	}
+}
+
+func toRecord(msg interface{}) (store.Record, error) {
+	switch m := msg.(type) {
+	case *Message:
+		return store.Record{
+			Key:         m.Key,
+			Tombstone:   m.Tombstone,
+			Headers:     m.Headers,
+			Data:        m.Data,
+			ContentType: m.ContentType,
+		}, nil
+	case string:
+		return store.Record{Data: []byte(m)}, nil
+	case []byte:
+		return store.Record{Data: m}, nil
+	}
+	return store.Record{}, ErrNotPersistable
+}
+
+// withSeq returns msg carrying the sequence assigned by the store.
+func withSeq(msg interface{}, seq uint64) interface{} {
+	if m, ok := msg.(*Message); ok {
+		c := *m
+		c.Seq = seq
+		return &c
+	}
+	return msg
+}
+
+// sequencer returns the lock that orders the messages of the persisted
+// subject from the store into the subscriber queues.
+func (b *subPubImpl) sequencer(subject string) *sync.Mutex {
+	if v, ok := b.sequencers.Load(subject); ok {
+		return v.(*sync.Mutex)
+	}
+	v, _ := b.sequencers.LoadOrStore(subject, &sync.Mutex{})
+	return v.(*sync.Mutex)
+}
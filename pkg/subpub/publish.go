@@ -0,0 +1,258 @@
+package subpub
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQuorumNotReached is returned by blocking publishes when too many
+// matched subscribers unsubscribed before queueing the message.
+var ErrQuorumNotReached = errors.New("subpub: quorum not reached")
+
+// PublishReport describes the outcome of a single publish.
+type PublishReport struct {
+	// Matched is the number of subscribers whose filter accepted the
+	// message.
+	Matched int
+	// Enqueued is the number of matched subscribers that queued it.
+	Enqueued int
+	// Dropped is the number of matched subscribers whose queue was full
+	// or that were unsubscribing.
+	Dropped int
+	// Duplicate is set when the message ID was already published within
+	// the deduplication window; the message was not delivered again.
+	Duplicate bool
+	// Seq is the sequence assigned to messages of persisted subjects.
+	Seq uint64
+}
+
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	wait   bool
+	block  bool
+	quorum int
+	id     string
+}
+
+// WaitForHandlers makes PublishAndWait return only after all handlers the
+// message was enqueued for have finished.
+func WaitForHandlers() PublishOption {
+	return func(o *publishOptions) {
+		o.wait = true
+	}
+}
+
+// BlockWhenFull makes PublishAndWait wait for queue space like PublishCtx
+// instead of dropping the message for subscribers whose queue is full.
+func BlockWhenFull() PublishOption {
+	return func(o *publishOptions) {
+		o.block = true
+	}
+}
+
+// WithQuorum lets a blocking publish succeed once n matched subscribers
+// queued the message. Subscribers still full at that point drop it.
+// n <= 0, the default, waits for all matched subscribers.
+func WithQuorum(n int) PublishOption {
+	return func(o *publishOptions) {
+		o.quorum = n
+	}
+}
+
+func (e envelope) deliver(handler MessageHandler) {
+	handler(e.msg)
+	if e.done != nil {
+		e.done()
+	}
+}
+
+func (b *subPubImpl) Publish(subject string, msg interface{}) error {
+	_, err := b.publish(context.Background(), subject, msg, publishOptions{})
+	return err
+}
+
+func (b *subPubImpl) PublishAndWait(ctx context.Context, subject string, msg interface{}, opts ...PublishOption) (PublishReport, error) {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return b.publish(ctx, subject, msg, o)
+}
+
+func (b *subPubImpl) PublishCtx(ctx context.Context, subject string, msg interface{}, opts ...PublishOption) error {
+	o := publishOptions{block: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	_, err := b.publish(ctx, subject, msg, o)
+	return err
+}
+
+func (b *subPubImpl) publish(ctx context.Context, subject string, msg interface{}, o publishOptions) (PublishReport, error) {
+	if b.closed.Load() {
+		return PublishReport{}, context.Canceled
+	}
+
+	if b.dedup != nil && o.id != "" {
+		if !b.dedup.add(subject, o.id) {
+			b.stats.duplicates.Add(1)
+			return PublishReport{Duplicate: true}, nil
+		}
+	}
+
+	var (
+		report PublishReport
+		wg     *sync.WaitGroup
+		err    error
+	)
+	persisted := b.store != nil && b.store.Persisted(subject)
+	if persisted {
+		report, wg, err = b.persist(ctx, subject, msg, o)
+	} else {
+		report, wg, err = b.enqueue(ctx, subject, msg, o)
+	}
+	// A message the store refused was not published at all.
+	if !persisted || report.Seq != 0 {
+		b.stats.published.Add(1)
+	}
+	b.stats.enqueued.Add(uint64(report.Enqueued))
+	b.stats.dropped.Add(uint64(report.Dropped))
+
+	if err != nil {
+		// A retry of a message that was neither stored nor reached its
+		// quorum must not be swallowed as a duplicate.
+		if b.dedup != nil && o.id != "" && report.Seq == 0 {
+			b.dedup.remove(subject, o.id)
+		}
+		return report, err
+	}
+
+	if wg == nil || report.Enqueued == 0 {
+		return report, nil
+	}
+
+	return report, waitCtx(ctx, wg)
+}
+
+// waitCtx waits for wg until ctx ends.
+func waitCtx(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// persist stores msg and then queues it for subscribers. The subject's
+// sequencer is held in between, so that live subscribers receive persisted
+// messages in sequence order, while the store itself is unlocked before
+// the message is queued: a blocking publish waiting for a full queue must
+// not hold up readers of the subject.
+func (b *subPubImpl) persist(ctx context.Context, subject string, msg interface{}, o publishOptions) (PublishReport, *sync.WaitGroup, error) {
+	rec, err := toRecord(msg)
+	if err != nil {
+		return PublishReport{}, nil, err
+	}
+
+	seq := b.sequencer(subject)
+	seq.Lock()
+	defer seq.Unlock()
+
+	rec, err = b.store.Append(subject, rec)
+	if err != nil {
+		return PublishReport{}, nil, err
+	}
+	report, wg, err := b.enqueue(ctx, subject, withSeq(msg, rec.Seq), o)
+	report.Seq = rec.Seq
+	return report, wg, err
+}
+
+// enqueue queues msg for the matched subscribers of subject. The returned
+// WaitGroup, set with o.wait, completes when their handlers have run.
+func (b *subPubImpl) enqueue(ctx context.Context, subject string, msg interface{}, o publishOptions) (PublishReport, *sync.WaitGroup, error) {
+	var report PublishReport
+
+	v, ok := b.subjects.Load(subject)
+	if !ok {
+		return report, nil, nil
+	}
+	subs := v.(*subjectEntry).subs.Load()
+	if subs == nil {
+		return report, nil, nil
+	}
+
+	e := envelope{msg: msg}
+	var wg *sync.WaitGroup
+	if o.wait {
+		wg = &sync.WaitGroup{}
+		e.done = wg.Done
+	}
+
+	// Queue the message everywhere there is room first, so that a full
+	// queue does not delay subscribers that can take it right away.
+	var full []*subscription
+	for _, sub := range *subs {
+		if sub.filter != nil && !sub.filter(msg) {
+			continue
+		}
+		report.Matched++
+
+		if wg != nil {
+			wg.Add(1)
+		}
+		if sub.enqueue(e) {
+			report.Enqueued++
+		} else if o.block {
+			full = append(full, sub)
+		} else {
+			report.Dropped++
+			if wg != nil {
+				wg.Done()
+			}
+		}
+	}
+
+	if len(full) > 0 {
+		quorum := o.quorum
+		if quorum <= 0 || quorum > report.Matched {
+			quorum = report.Matched
+		}
+
+		var err error
+		for _, sub := range full {
+			var ok bool
+			if report.Enqueued < quorum && err == nil {
+				ok, err = sub.enqueueWait(ctx, e)
+			} else {
+				ok = sub.enqueue(e)
+			}
+
+			if ok {
+				report.Enqueued++
+			} else {
+				report.Dropped++
+				if wg != nil {
+					wg.Done()
+				}
+			}
+		}
+
+		if err != nil {
+			return report, wg, err
+		}
+		if report.Enqueued < quorum {
+			return report, wg, ErrQuorumNotReached
+		}
+	}
+
+	return report, wg, nil
+}
@@ -0,0 +1,38 @@
+package subpub
+
+import "sync/atomic"
+
+// Stats is a snapshot of the bus counters.
+type Stats struct {
+	Subjects      int
+	Subscriptions int
+	Published     uint64
+	Enqueued      uint64
+	Dropped       uint64
+	Duplicates    uint64
+}
+
+type counters struct {
+	subscriptions atomic.Int64
+	published     atomic.Uint64
+	enqueued      atomic.Uint64
+	dropped       atomic.Uint64
+	duplicates    atomic.Uint64
+}
+
+func (b *subPubImpl) Stats() Stats {
+	s := Stats{
+		Subscriptions: int(b.stats.subscriptions.Load()),
+		Published:     b.stats.published.Load(),
+		Enqueued:      b.stats.enqueued.Load(),
+		Dropped:       b.stats.dropped.Load(),
+		Duplicates:    b.stats.duplicates.Load(),
+	}
+	b.subjects.Range(func(_, v interface{}) bool {
+		if v.(*subjectEntry).subs.Load() != nil {
+			s.Subjects++
+		}
+		return true
+	})
+	return s
+}
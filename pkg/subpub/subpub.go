@@ -3,142 +3,334 @@ package subpub
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/StepanErshov/pubsub/pkg/store"
 )
 
 type MessageHandler func(msg interface{})
 
+// FilterFunc decides whether a message is enqueued for a subscription.
+// It runs on the publisher's goroutine and must not block.
+type FilterFunc func(msg interface{}) bool
+
+// Message is the envelope used by the gRPC service. The bus itself accepts
+// any value; Message only adds headers that filters can inspect and the
+// fields used by persisted subjects.
+type Message struct {
+	Headers map[string]string
+	Data    []byte
+	// ContentType is the MIME type of Data. The bus does not interpret
+	// it.
+	ContentType string
+	// Key identifies the entity the message describes; compacted subjects
+	// keep only the latest message per key.
+	Key string
+	// Tombstone marks the deletion of Key.
+	Tombstone bool
+	// Seq is set by the bus for messages of persisted subjects.
+	Seq uint64
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	filter  FilterFunc
+	workers int
+	key     KeyFunc
+}
+
+func WithFilter(f FilterFunc) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.filter = f
+	}
+}
+
 type Subscription interface {
 	Unsubscribe()
 }
 
 type SubPub interface {
-	Subscribe(subject string, cb MessageHandler) (Subscription, error)
+	Subscribe(subject string, cb MessageHandler, opts ...SubscribeOption) (Subscription, error)
 	Publish(subject string, msg interface{}) error
+	// PublishAndWait publishes msg and reports what happened to it. With
+	// WaitForHandlers it also waits until every handler it was enqueued
+	// for has returned, or until ctx ends.
+	PublishAndWait(ctx context.Context, subject string, msg interface{}, opts ...PublishOption) (PublishReport, error)
+	// PublishCtx publishes msg, waiting for free space in the queues of
+	// matched subscribers instead of dropping it. It returns once all of
+	// them (or the quorum set by WithQuorum) queued the message, or with
+	// ctx's error when ctx ends first.
+	PublishCtx(ctx context.Context, subject string, msg interface{}, opts ...PublishOption) error
+	// PublishBatch publishes msgs atomically, possibly to several
+	// subjects, and returns a report per message.
+	PublishBatch(ctx context.Context, msgs []BatchMessage, opts ...PublishOption) ([]PublishReport, error)
+	// PublishEach publishes msgs independently but more cheaply than
+	// separate calls, and returns a report and an error per message.
+	PublishEach(ctx context.Context, msgs []BatchMessage, opts ...PublishOption) ([]PublishReport, []error)
+	Stats() Stats
 	Close(ctx context.Context) error
 }
 
+type Option func(*options)
+
+type options struct {
+	queueSize   int
+	pool        bool
+	workers     int
+	dedupWindow time.Duration
+	dedupMax    int
+	store       *store.Store
+}
+
+// WithQueueSize sets how many undelivered messages each subscription
+// buffers before new messages are dropped.
+func WithQueueSize(n int) Option {
+	return func(o *options) {
+		o.queueSize = n
+	}
+}
+
+// WithWorkerPool delivers messages with a fixed pool of workers shared by
+// all subscriptions instead of a goroutine per subscription, except for
+// those with WithConcurrency. Per-subscriber ordering is preserved.
+// workers <= 0 uses GOMAXPROCS.
+func WithWorkerPool(workers int) Option {
+	return func(o *options) {
+		o.pool = true
+		o.workers = workers
+	}
+}
+
 type subscription struct {
 	subject  string
-	handler  MessageHandler
-	messages chan interface{}
+	dispatch func(e envelope)
+	filter   FilterFunc
 	bus      *subPubImpl
-	once     sync.Once
+	// engine drains the mailbox: the bus engine, or a goroutine of its own
+	// for a partitioned subscription, whose dispatch may block.
+	engine deliveryEngine
+	once   sync.Once
+	mailbox
+
+	onFinish   func()
+	finishOnce sync.Once
+
+	// Used by goroutineEngine only.
+	wake chan struct{}
+	done chan struct{}
 }
 
 func (s *subscription) Unsubscribe() {
 	s.bus.unsubscribe(s)
 }
 
-type subPubImpl struct {
-	mu          sync.RWMutex
-	subscribers map[string][]*subscription
-	closed      bool
-	wg          sync.WaitGroup
-	closeOnce   sync.Once
+// stop ends delivery. Messages already queued are still handled.
+func (s *subscription) stop() {
+	s.once.Do(func() {
+		s.bus.stats.subscriptions.Add(-1)
+		idle := s.mailbox.stop()
+		s.engine.detach(s)
+		if idle {
+			s.finish()
+		}
+	})
 }
 
-func NewSubPub() SubPub {
-	return &subPubImpl{
-		subscribers: make(map[string][]*subscription),
+// finish runs once the subscription is stopped and its last queued
+// message has been handled.
+func (s *subscription) finish() {
+	s.finishOnce.Do(func() {
+		if s.onFinish != nil {
+			s.onFinish()
+		}
+	})
+}
+
+func (s *subscription) enqueue(e envelope) bool {
+	ok, wake := s.push(e)
+	if wake {
+		s.engine.notify(s)
 	}
+	return ok
 }
 
-func (b *subPubImpl) Subscribe(subject string, cb MessageHandler) (Subscription, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+func (s *subscription) enqueueWait(ctx context.Context, e envelope) (bool, error) {
+	ok, wake, err := s.pushWait(ctx, e)
+	if wake {
+		s.engine.notify(s)
+	}
+	return ok, err
+}
 
-	if b.closed {
-		return nil, context.Canceled
+// drain handles queued messages until the mailbox is empty or max
+// messages were handled (max < 0 means no limit). It reports whether
+// messages are left.
+func (s *subscription) drain(max int) bool {
+	for n := 0; max < 0 || n < max; n++ {
+		e, ok := s.next()
+		if !ok {
+			if s.isStopped() {
+				s.finish()
+			}
+			return false
+		}
+		s.dispatch(e)
 	}
+	return true
+}
 
-	sub := &subscription{
-		subject:  subject,
-		handler:  cb,
-		messages: make(chan interface{}, 100),
-		bus:      b,
+// subjectEntry holds the subscribers of one subject. Publishers read the
+// list through an atomic pointer without locking; writers serialize on mu
+// and swap in a modified copy.
+type subjectEntry struct {
+	mu   sync.Mutex
+	subs atomic.Pointer[[]*subscription]
+	dead bool
+}
+
+type subPubImpl struct {
+	subjects  sync.Map
+	closed    atomic.Bool
+	queueSize int
+	engine    deliveryEngine
+	dedup     *dedupWindow
+	store     *store.Store
+	// sequencers holds a *sync.Mutex per persisted subject; see persist.
+	sequencers sync.Map
+	// batchMu serializes atomic batches so that they are queued in the
+	// same order on every subject.
+	batchMu   sync.Mutex
+	mailboxMu sync.Mutex
+	stats     counters
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func NewSubPub(opts ...Option) SubPub {
+	o := options{queueSize: defaultQueueSize}
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	b.subscribers[subject] = append(b.subscribers[subject], sub)
-	b.wg.Add(1)
+	b := &subPubImpl{queueSize: o.queueSize, store: o.store}
+	if o.dedupWindow > 0 || o.dedupMax > 0 {
+		b.dedup = newDedupWindow(o.dedupWindow, o.dedupMax)
+	}
+	if o.pool {
+		b.engine = newPoolEngine(o.workers, &b.wg)
+	} else {
+		b.engine = &goroutineEngine{wg: &b.wg}
+	}
+	return b
+}
 
-	go func() {
-		defer b.wg.Done()
-		for msg := range sub.messages {
-			sub.handler(msg)
+// lockEntry returns the locked entry for subject, creating it if needed.
+func (b *subPubImpl) lockEntry(subject string) *subjectEntry {
+	for {
+		v, _ := b.subjects.LoadOrStore(subject, &subjectEntry{})
+		e := v.(*subjectEntry)
+		e.mu.Lock()
+		if !e.dead {
+			return e
 		}
-	}()
-
-	return sub, nil
+		e.mu.Unlock()
+	}
 }
 
-func (b *subPubImpl) Publish(subject string, msg interface{}) error {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+func (b *subPubImpl) Subscribe(subject string, cb MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	var o subscribeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	e := b.lockEntry(subject)
+	defer e.mu.Unlock()
 
-	if b.closed {
-		return context.Canceled
+	if b.closed.Load() {
+		return nil, context.Canceled
 	}
 
-	subs, ok := b.subscribers[subject]
-	if !ok {
-		return nil
+	sub := &subscription{
+		subject: subject,
+		filter:  o.filter,
+		bus:     b,
+		engine:  b.engine,
+		mailbox: mailbox{limit: b.queueSize},
+	}
+	sub.dispatch = func(e envelope) { e.deliver(cb) }
+	if o.workers > 1 {
+		p := newPartitioner(o.workers, o.key, cb, &b.wg)
+		sub.dispatch = p.dispatch
+		sub.onFinish = p.close
+		// A full lane must not hold up a worker of a shared pool.
+		sub.engine = &goroutineEngine{wg: &b.wg}
 	}
 
-	for _, sub := range subs {
-		select {
-		case sub.messages <- msg:
-		default:
-		}
+	// The engine must be ready before publishers can see the subscription.
+	sub.engine.attach(sub)
+
+	var subs []*subscription
+	if old := e.subs.Load(); old != nil {
+		subs = make([]*subscription, len(*old), len(*old)+1)
+		copy(subs, *old)
 	}
+	subs = append(subs, sub)
+	e.subs.Store(&subs)
+	b.stats.subscriptions.Add(1)
 
-	return nil
+	return sub, nil
 }
 
 func (b *subPubImpl) unsubscribe(sub *subscription) {
-	sub.once.Do(func() {
-		b.mu.Lock()
-		defer b.mu.Unlock()
-
-		subs, ok := b.subscribers[sub.subject]
-		if !ok {
-			return
-		}
-
-		for i, s := range subs {
-			if s == sub {
-				b.subscribers[sub.subject] = append(subs[:i], subs[i+1:]...)
-				close(sub.messages)
-				break
+	v, ok := b.subjects.Load(sub.subject)
+	if ok {
+		e := v.(*subjectEntry)
+		e.mu.Lock()
+		if old := e.subs.Load(); old != nil {
+			subs := make([]*subscription, 0, len(*old))
+			for _, s := range *old {
+				if s != sub {
+					subs = append(subs, s)
+				}
+			}
+			if len(subs) == 0 {
+				e.dead = true
+				e.subs.Store(nil)
+				b.subjects.CompareAndDelete(sub.subject, e)
+			} else {
+				e.subs.Store(&subs)
 			}
 		}
+		e.mu.Unlock()
+	}
 
-		if len(b.subscribers[sub.subject]) == 0 {
-			delete(b.subscribers, sub.subject)
-		}
-	})
+	sub.stop()
 }
 
 func (b *subPubImpl) Close(ctx context.Context) error {
 	var err error
 	b.closeOnce.Do(func() {
-		b.mu.Lock()
-		b.closed = true
-		subsCopy := make(map[string][]*subscription)
-		for k, v := range b.subscribers {
-			subs := make([]*subscription, len(v))
-			copy(subs, v)
-			subsCopy[k] = subs
-		}
-		b.subscribers = nil
-		b.mu.Unlock()
-
-		for _, subs := range subsCopy {
-			for _, sub := range subs {
-				sub.once.Do(func() {
-					close(sub.messages)
-				})
+		b.closed.Store(true)
+
+		b.subjects.Range(func(key, v interface{}) bool {
+			e := v.(*subjectEntry)
+			e.mu.Lock()
+			subs := e.subs.Load()
+			e.dead = true
+			e.subs.Store(nil)
+			b.subjects.CompareAndDelete(key, e)
+			e.mu.Unlock()
+
+			if subs != nil {
+				for _, sub := range *subs {
+					sub.stop()
+				}
 			}
-		}
+			return true
+		})
+		b.engine.shutdown()
 
 		done := make(chan struct{})
 		go func() {
@@ -154,4 +346,4 @@ func (b *subPubImpl) Close(ctx context.Context) error {
 		}
 	})
 	return err
-}
\ No newline at end of file
+}
@@ -0,0 +1,151 @@
+package subpub
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var benchmarkEngines = []struct {
+	name string
+	opts []Option
+}{
+	{"goroutine", nil},
+	{"pool", []Option{WithWorkerPool(0)}},
+}
+
+func benchmarkBus(b *testing.B, subjects, subsPerSubject int, opts ...Option) (SubPub, []string) {
+	bus := NewSubPub(opts...)
+	b.Cleanup(func() { bus.Close(context.Background()) })
+
+	names := make([]string, subjects)
+	for i := range names {
+		names[i] = fmt.Sprintf("subject.%d", i)
+		for j := 0; j < subsPerSubject; j++ {
+			if _, err := bus.Subscribe(names[i], func(msg interface{}) {}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return bus, names
+}
+
+func BenchmarkPublish(b *testing.B) {
+	for _, engine := range benchmarkEngines {
+		for _, subs := range []int{1, 10, 100} {
+			b.Run(fmt.Sprintf("%s/subs=%d", engine.name, subs), func(b *testing.B) {
+				bus, names := benchmarkBus(b, 1, subs, engine.opts...)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					bus.Publish(names[0], i)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPublishParallel(b *testing.B) {
+	bus, names := benchmarkBus(b, 64, 10)
+	var n atomic.Uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := n.Add(1)
+			bus.Publish(names[i%uint64(len(names))], i)
+		}
+	})
+}
+
+// BenchmarkPublishWithChurn measures publishers running in parallel with
+// goroutines that keep subscribing and unsubscribing on the same subjects.
+func BenchmarkPublishWithChurn(b *testing.B) {
+	for _, churners := range []int{1, 4} {
+		b.Run(fmt.Sprintf("churners=%d", churners), func(b *testing.B) {
+			bus, names := benchmarkBus(b, 64, 10)
+
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for c := 0; c < churners; c++ {
+				wg.Add(1)
+				go func(c int) {
+					defer wg.Done()
+					for i := c; ; i++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						sub, err := bus.Subscribe(names[i%len(names)], func(msg interface{}) {})
+						if err != nil {
+							return
+						}
+						sub.Unsubscribe()
+					}
+				}(c)
+			}
+
+			var n atomic.Uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := n.Add(1)
+					bus.Publish(names[i%uint64(len(names))], i)
+				}
+			})
+			b.StopTimer()
+
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkSubscribeUnsubscribe(b *testing.B) {
+	bus, names := benchmarkBus(b, 64, 10)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sub, err := bus.Subscribe(names[i%len(names)], func(msg interface{}) {})
+		if err != nil {
+			b.Fatal(err)
+		}
+		sub.Unsubscribe()
+	}
+}
+
+// BenchmarkIdleSubscription reports the heap memory held by a subscription
+// that has no pending messages.
+func BenchmarkIdleSubscription(b *testing.B) {
+	for _, engine := range benchmarkEngines {
+		b.Run(engine.name, func(b *testing.B) {
+			bus := NewSubPub(engine.opts...)
+			defer bus.Close(context.Background())
+			handler := func(msg interface{}) {}
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := bus.Subscribe(fmt.Sprintf("subject.%d", i%1000), handler); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			used := float64(after.HeapInuse+after.StackInuse) - float64(before.HeapInuse+before.StackInuse)
+			b.ReportMetric(used/float64(b.N), "B/sub")
+		})
+	}
+}
@@ -2,9 +2,13 @@ package subpub
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/StepanErshov/pubsub/pkg/store"
 )
 
 func TestSubscribePublish(t *testing.T) {
@@ -177,3 +181,852 @@ func TestSubscribeAfterClose(t *testing.T) {
 		t.Errorf("Expected Canceled error, got %v", err)
 	}
 }
+
+func TestSubscribeWithFilter(t *testing.T) {
+	bus := NewSubPub()
+	defer bus.Close(context.Background())
+
+	received := make(chan interface{}, 10)
+	_, err := bus.Subscribe("test", func(msg interface{}) {
+		received <- msg
+	}, WithFilter(func(msg interface{}) bool {
+		m, ok := msg.(*Message)
+		return ok && m.Headers["type"] == "order"
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish("test", &Message{Headers: map[string]string{"type": "refund"}, Data: []byte("skipped")})
+	bus.Publish("test", "plain")
+	bus.Publish("test", &Message{Headers: map[string]string{"type": "order"}, Data: []byte("delivered")})
+
+	select {
+	case msg := <-received:
+		if m, ok := msg.(*Message); !ok || string(m.Data) != "delivered" {
+			t.Errorf("Expected filtered message, got %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Message not received")
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("Unexpected message %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWorkerPoolOrdering(t *testing.T) {
+	bus := NewSubPub(WithWorkerPool(4), WithQueueSize(1000))
+
+	const subs, msgs = 20, 500
+	var mu sync.Mutex
+	received := make([][]int, subs)
+
+	for i := 0; i < subs; i++ {
+		i := i
+		_, err := bus.Subscribe("test", func(msg interface{}) {
+			mu.Lock()
+			received[i] = append(received[i], msg.(int))
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for n := 0; n < msgs; n++ {
+		bus.Publish("test", n)
+	}
+
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for i, got := range received {
+		if len(got) != msgs {
+			t.Fatalf("Subscriber %d received %d messages, want %d", i, len(got), msgs)
+		}
+		for n, v := range got {
+			if v != n {
+				t.Fatalf("Subscriber %d received %d at position %d", i, v, n)
+			}
+		}
+	}
+}
+
+func TestWorkerPoolSlowSubscriber(t *testing.T) {
+	bus := NewSubPub(WithWorkerPool(2))
+	defer bus.Close(context.Background())
+
+	fastDone := make(chan struct{})
+	_, _ = bus.Subscribe("test", func(msg interface{}) {
+		time.Sleep(500 * time.Millisecond)
+	})
+	_, _ = bus.Subscribe("test", func(msg interface{}) {
+		close(fastDone)
+	})
+
+	bus.Publish("test", "msg")
+
+	select {
+	case <-fastDone:
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Fast subscriber blocked by slow one")
+	}
+}
+
+func TestQueueSizeDropsOverflow(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(2))
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var count int
+	_, _ = bus.Subscribe("test", func(msg interface{}) {
+		<-release
+		mu.Lock()
+		count++
+		mu.Unlock()
+	})
+
+	for i := 0; i < 10; i++ {
+		bus.Publish("test", i)
+	}
+	close(release)
+
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	// One message may already be in the handler when the queue fills up.
+	if count > 3 {
+		t.Errorf("Expected overflow to be dropped, handled %d messages", count)
+	}
+}
+
+func TestConcurrencyKeepsPartitionOrder(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithWorkerPool(2)}} {
+		bus := NewSubPub(append(opts, WithQueueSize(1000))...)
+
+		var mu sync.Mutex
+		received := make(map[string][]int)
+		_, err := bus.Subscribe("test", func(msg interface{}) {
+			m := msg.(*Message)
+			mu.Lock()
+			received[m.Headers["key"]] = append(received[m.Headers["key"]], len(m.Data))
+			mu.Unlock()
+		}, WithConcurrency(4, HeaderKey("key")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys := []string{"a", "b", "c", "d", "e"}
+		for n := 1; n <= 100; n++ {
+			for _, k := range keys {
+				bus.Publish("test", &Message{Headers: map[string]string{"key": k}, Data: make([]byte, n)})
+			}
+		}
+
+		if err := bus.Close(context.Background()); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		for _, k := range keys {
+			got := received[k]
+			if len(got) != 100 {
+				t.Fatalf("Key %s received %d messages, want 100", k, len(got))
+			}
+			for i, v := range got {
+				if v != i+1 {
+					t.Fatalf("Key %s out of order at %d: %v", k, i, got[:i+1])
+				}
+			}
+		}
+	}
+}
+
+func TestConcurrencyRunsPartitionsInParallel(t *testing.T) {
+	bus := NewSubPub()
+	defer bus.Close(context.Background())
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	_, _ = bus.Subscribe("test", func(msg interface{}) {
+		started <- msg.(*Message).Headers["key"]
+		<-release
+	}, WithConcurrency(8, func(msg interface{}) string {
+		return msg.(*Message).Headers["key"]
+	}))
+
+	bus.Publish("test", &Message{Headers: map[string]string{"key": "a"}})
+	bus.Publish("test", &Message{Headers: map[string]string{"key": "b"}})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("Partitions were not handled in parallel")
+		}
+	}
+	close(release)
+}
+
+func TestPublishAndWaitReport(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(1))
+	defer bus.Close(context.Background())
+
+	report, err := bus.PublishAndWait(context.Background(), "empty", "msg")
+	if err != nil || report != (PublishReport{}) {
+		t.Errorf("Expected empty report without subscribers, got %+v, %v", report, err)
+	}
+
+	release := make(chan struct{})
+	_, _ = bus.Subscribe("test", func(msg interface{}) { <-release })
+	_, _ = bus.Subscribe("test", func(msg interface{}) {}, WithFilter(func(msg interface{}) bool { return false }))
+
+	// The first message occupies the handler, the second fills the queue.
+	bus.Publish("test", 1)
+	time.Sleep(50 * time.Millisecond)
+	bus.Publish("test", 2)
+
+	report, err = bus.PublishAndWait(context.Background(), "test", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PublishReport{Matched: 1, Enqueued: 0, Dropped: 1}
+	if report != want {
+		t.Errorf("Expected %+v, got %+v", want, report)
+	}
+	close(release)
+}
+
+func TestConcurrencyDoesNotBlockWorkerPool(t *testing.T) {
+	bus := NewSubPub(WithWorkerPool(1), WithQueueSize(1000))
+	defer bus.Close(context.Background())
+
+	// Enough messages to fill the only lane while its handler is stuck.
+	release := make(chan struct{})
+	defer close(release)
+	_, _ = bus.Subscribe("slow", func(msg interface{}) {
+		<-release
+	}, WithConcurrency(2, nil))
+	for i := 0; i < defaultQueueSize+50; i++ {
+		bus.Publish("slow", i)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	received := make(chan struct{}, 1)
+	_, _ = bus.Subscribe("fast", func(msg interface{}) {
+		received <- struct{}{}
+	})
+	bus.Publish("fast", "msg")
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("A stuck partition held up another subscription")
+	}
+}
+
+func TestPublishAndWaitForHandlers(t *testing.T) {
+	bus := NewSubPub()
+	defer bus.Close(context.Background())
+
+	var mu sync.Mutex
+	handled := 0
+	for i := 0; i < 3; i++ {
+		_, _ = bus.Subscribe("test", func(msg interface{}) {
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			handled++
+			mu.Unlock()
+		}, WithConcurrency(2, nil))
+	}
+
+	report, err := bus.PublishAndWait(context.Background(), "test", "msg", WaitForHandlers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Enqueued != 3 {
+		t.Errorf("Expected 3 enqueued, got %+v", report)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 3 {
+		t.Errorf("Expected all handlers to finish, %d did", handled)
+	}
+}
+
+func TestPublishAndWaitContext(t *testing.T) {
+	bus := NewSubPub()
+	defer bus.Close(context.Background())
+
+	_, _ = bus.Subscribe("test", func(msg interface{}) {
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report, err := bus.PublishAndWait(ctx, "test", "msg", WaitForHandlers())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	if report.Enqueued != 1 {
+		t.Errorf("Expected report to be returned with the error, got %+v", report)
+	}
+}
+
+func TestPublishCtxBlocksUntilSpace(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithWorkerPool(1)}} {
+		bus := NewSubPub(append(opts, WithQueueSize(1))...)
+
+		var mu sync.Mutex
+		var got []int
+		_, _ = bus.Subscribe("test", func(msg interface{}) {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			got = append(got, msg.(int))
+			mu.Unlock()
+		})
+
+		for i := 0; i < 10; i++ {
+			if err := bus.PublishCtx(context.Background(), "test", i); err != nil {
+				t.Fatalf("PublishCtx failed: %v", err)
+			}
+		}
+		if err := bus.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != 10 {
+			t.Fatalf("Expected no drops with blocking publish, got %v", got)
+		}
+		for i, v := range got {
+			if v != i {
+				t.Fatalf("Messages out of order: %v", got)
+			}
+		}
+	}
+}
+
+func TestPublishCtxDeadline(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(1))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	defer close(release)
+	_, _ = bus.Subscribe("test", func(msg interface{}) { <-release })
+
+	bus.Publish("test", 1)
+	time.Sleep(20 * time.Millisecond)
+	bus.Publish("test", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bus.PublishCtx(ctx, "test", 3); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestPublishCtxQuorum(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(1))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	defer close(release)
+	_, _ = bus.Subscribe("test", func(msg interface{}) { <-release })
+	_, _ = bus.Subscribe("test", func(msg interface{}) {})
+	_, _ = bus.Subscribe("test", func(msg interface{}) {})
+
+	bus.Publish("test", 1)
+	time.Sleep(20 * time.Millisecond)
+	bus.Publish("test", 2)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	report, err := bus.PublishAndWait(ctx, "test", 3, BlockWhenFull(), WithQuorum(2))
+	if err != nil {
+		t.Fatalf("Expected quorum of 2 to be reached, got %v", err)
+	}
+	if report.Enqueued != 2 || report.Dropped != 1 {
+		t.Errorf("Expected 2 enqueued and 1 dropped, got %+v", report)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	bus := NewSubPub(WithDeduplication(time.Minute, 100))
+	defer bus.Close(context.Background())
+
+	received := make(chan interface{}, 10)
+	_, _ = bus.Subscribe("test", func(msg interface{}) { received <- msg })
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		report, err := bus.PublishAndWait(ctx, "test", "msg", WithMessageID("id-1"), WaitForHandlers())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Duplicate != (i > 0) {
+			t.Errorf("Publish %d: unexpected report %+v", i, report)
+		}
+	}
+	// The same ID on another subject is a different message.
+	bus.PublishAndWait(ctx, "other", "msg", WithMessageID("id-1"))
+
+	if len(received) != 1 {
+		t.Errorf("Expected one delivery, got %d", len(received))
+	}
+
+	stats := bus.Stats()
+	if stats.Duplicates != 2 || stats.Published != 2 || stats.Subscriptions != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestDedupWindowBounds(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := newDedupWindow(time.Minute, 2)
+	d.now = func() time.Time { return now }
+
+	if !d.add("s", "a") || d.add("s", "a") {
+		t.Fatal("Expected second add of the same ID to be rejected")
+	}
+
+	d.add("s", "b")
+	d.add("s", "c")
+	if !d.add("s", "a") {
+		t.Error("Expected oldest ID to be evicted by the count limit")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !d.add("s", "c") {
+		t.Error("Expected ID to expire after the window")
+	}
+
+	d.remove("s", "c")
+	if !d.add("s", "c") {
+		t.Error("Expected removed ID to be accepted again")
+	}
+}
+
+func TestPersistedSubject(t *testing.T) {
+	st, err := store.Open(store.Options{
+		Dir:      t.TempDir(),
+		Subjects: []store.SubjectConfig{{Subject: "users", Compact: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	bus := NewSubPub(WithStore(st))
+	defer bus.Close(context.Background())
+
+	received := make(chan *Message, 10)
+	_, _ = bus.Subscribe("users", func(msg interface{}) { received <- msg.(*Message) })
+
+	ctx := context.Background()
+	bus.Publish("users", &Message{Key: "alice", Data: []byte("v1")})
+	report, err := bus.PublishAndWait(ctx, "users", &Message{Key: "alice", Tombstone: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Seq != 2 {
+		t.Errorf("Expected sequence 2, got %+v", report)
+	}
+	if err := bus.Publish("users", 42); err != ErrNotPersistable {
+		t.Errorf("Expected ErrNotPersistable, got %v", err)
+	}
+
+	for seq := uint64(1); seq <= 2; seq++ {
+		select {
+		case m := <-received:
+			if m.Seq != seq {
+				t.Errorf("Expected sequence %d, got %d", seq, m.Seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Message not received")
+		}
+	}
+
+	recs, err := st.Read("users", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Key != "alice" || !recs[1].Tombstone {
+		t.Errorf("Unexpected stored records %+v", recs)
+	}
+}
+
+func TestPublishBatchAtomic(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(2))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	orders := make(chan interface{}, 10)
+	_, _ = bus.Subscribe("order.created", func(msg interface{}) { orders <- msg })
+	_, _ = bus.Subscribe("inventory.reserved", func(msg interface{}) { <-release })
+
+	// Occupy the inventory handler and fill its queue.
+	bus.Publish("inventory.reserved", "busy")
+	time.Sleep(20 * time.Millisecond)
+	bus.Publish("inventory.reserved", "queued")
+
+	_, err := bus.PublishBatch(context.Background(), []BatchMessage{
+		{Subject: "order.created", Msg: "order 1"},
+		{Subject: "inventory.reserved", Msg: "item 1"},
+		{Subject: "inventory.reserved", Msg: "item 2"},
+	})
+	if err != ErrBatchFull {
+		t.Fatalf("Expected ErrBatchFull, got %v", err)
+	}
+	select {
+	case msg := <-orders:
+		t.Errorf("Message %v of a failed batch was delivered", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	reports, err := bus.PublishBatch(context.Background(), []BatchMessage{
+		{Subject: "order.created", Msg: "order 2"},
+		{Subject: "inventory.reserved", Msg: "item 3"},
+	}, BlockWhenFull(), WaitForHandlers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reports[0].Enqueued != 1 || reports[1].Enqueued != 1 {
+		t.Errorf("Unexpected reports %+v", reports)
+	}
+	if msg := <-orders; msg != "order 2" {
+		t.Errorf("Expected order 2, got %v", msg)
+	}
+}
+
+func TestPublishBatchOrderAcrossSubjects(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(1000))
+	defer bus.Close(context.Background())
+
+	var mu sync.Mutex
+	got := map[string][]int{}
+	var wg sync.WaitGroup
+	for _, subject := range []string{"a", "b"} {
+		subject := subject
+		_, _ = bus.Subscribe(subject, func(msg interface{}) {
+			mu.Lock()
+			got[subject] = append(got[subject], msg.(int))
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+
+	const batches = 100
+	wg.Add(2 * batches)
+	var publishers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		publishers.Add(1)
+		go func(p int) {
+			defer publishers.Done()
+			for i := p; i < batches; i += 4 {
+				_, err := bus.PublishBatch(context.Background(), []BatchMessage{
+					{Subject: "a", Msg: i},
+					{Subject: "b", Msg: i},
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(p)
+	}
+	publishers.Wait()
+	wg.Wait()
+
+	for i := range got["a"] {
+		if got["a"][i] != got["b"][i] {
+			t.Fatalf("Subjects observed batches in different orders: %v and %v", got["a"], got["b"])
+		}
+	}
+}
+
+func TestPublishBatchPersisted(t *testing.T) {
+	st, err := store.Open(store.Options{
+		Dir:      t.TempDir(),
+		Subjects: []store.SubjectConfig{{Subject: "orders"}, {Subject: "inventory"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	bus := NewSubPub(WithStore(st), WithQueueSize(1), WithDeduplication(time.Minute, 100))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	defer close(release)
+	_, _ = bus.Subscribe("inventory", func(msg interface{}) { <-release })
+
+	batch := []BatchMessage{
+		{Subject: "orders", Msg: &Message{Data: []byte("created")}, ID: "order-1"},
+		{Subject: "inventory", Msg: &Message{Data: []byte("reserved")}, ID: "reserve-1"},
+	}
+	reports, err := bus.PublishBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reports[0].Seq != 1 || reports[1].Seq != 1 {
+		t.Errorf("Unexpected reports %+v", reports)
+	}
+
+	// The inventory subscriber is busy with the first batch, its queue
+	// takes one more message but not two.
+	_, err = bus.PublishBatch(context.Background(), []BatchMessage{
+		{Subject: "orders", Msg: &Message{Data: []byte("created")}, ID: "order-2"},
+		{Subject: "inventory", Msg: &Message{Data: []byte("reserved")}, ID: "reserve-2"},
+		{Subject: "inventory", Msg: &Message{Data: []byte("reserved")}, ID: "reserve-3"},
+	})
+	if err != ErrBatchFull {
+		t.Fatalf("Expected ErrBatchFull, got %v", err)
+	}
+	if seq, _ := st.LastSeq("orders"); seq != 1 {
+		t.Errorf("Expected the failed batch to be rolled back, orders at %d", seq)
+	}
+
+	reports, err = bus.PublishBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reports[0].Duplicate || !reports[1].Duplicate {
+		t.Errorf("Expected a retried batch to be a duplicate, got %+v", reports)
+	}
+}
+
+func TestPublishEach(t *testing.T) {
+	st, err := store.Open(store.Options{
+		Dir:      t.TempDir(),
+		Subjects: []store.SubjectConfig{{Subject: "jobs", MaxMessages: 2, Discard: store.DiscardNew}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	bus := NewSubPub(WithStore(st), WithDeduplication(time.Minute, 100))
+	defer bus.Close(context.Background())
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	_, _ = bus.Subscribe("events", func(msg interface{}) {
+		mu.Lock()
+		received = append(received, msg.(string))
+		mu.Unlock()
+	})
+
+	reports, errs := bus.PublishEach(context.Background(), []BatchMessage{
+		{Subject: "events", Msg: "a", ID: "a"},
+		{Subject: "events", Msg: "b"},
+		{Subject: "events", Msg: "a", ID: "a"},
+		{Subject: "jobs", Msg: &Message{Data: []byte("1")}},
+		{Subject: "jobs", Msg: &Message{Data: []byte("2")}},
+		{Subject: "jobs", Msg: &Message{Data: []byte("3")}},
+		{Subject: "events", Msg: "c"},
+	}, WaitForHandlers())
+
+	for i, err := range errs {
+		if (err != nil) != (i == 5) {
+			t.Errorf("Message %d: unexpected error %v", i, err)
+		}
+	}
+	if !errors.Is(errs[5], store.ErrSubjectFull) {
+		t.Errorf("Expected ErrSubjectFull for the third job, got %v", errs[5])
+	}
+	if !reports[2].Duplicate || reports[0].Enqueued != 1 || reports[6].Enqueued != 1 {
+		t.Errorf("Unexpected reports %+v", reports)
+	}
+	if reports[3].Seq != 1 || reports[4].Seq != 2 {
+		t.Errorf("Expected the jobs that fit to be stored, got %+v", reports[3:5])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(received, "") != "abc" {
+		t.Errorf("Expected abc in order, got %v", received)
+	}
+}
+
+func TestPublishEachForgetsFailedIDs(t *testing.T) {
+	bus := NewSubPub(WithQueueSize(1), WithDeduplication(time.Minute, 100))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	received := make(chan string, 10)
+	_, _ = bus.Subscribe("events", func(msg interface{}) {
+		<-release
+		received <- msg.(string)
+	})
+
+	// The first message is being handled and the second fills the queue,
+	// so the third times out waiting for room.
+	ctx := context.Background()
+	for _, msg := range []string{"a", "b"} {
+		if err := bus.PublishCtx(ctx, "events", msg); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, errs := bus.PublishEach(timeout, []BatchMessage{{Subject: "events", Msg: "c", ID: "c"}}, BlockWhenFull())
+	cancel()
+	if !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded, got %v", errs[0])
+	}
+
+	close(release)
+	reports, errs := bus.PublishEach(ctx, []BatchMessage{{Subject: "events", Msg: "c", ID: "c"}}, BlockWhenFull(), WaitForHandlers())
+	if errs[0] != nil || reports[0].Duplicate || reports[0].Enqueued != 1 {
+		t.Fatalf("Expected the retry to be delivered, got %+v, %v", reports[0], errs[0])
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, <-received)
+	}
+	if strings.Join(got, "") != "abc" {
+		t.Errorf("Expected abc, got %v", got)
+	}
+}
+
+func TestBlockingPersistDoesNotLockStore(t *testing.T) {
+	st, err := store.Open(store.Options{
+		Dir:      t.TempDir(),
+		Subjects: []store.SubjectConfig{{Subject: "orders"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	bus := NewSubPub(WithStore(st), WithQueueSize(1))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	received := make(chan uint64, 10)
+	_, _ = bus.Subscribe("orders", func(msg interface{}) {
+		<-release
+		received <- msg.(*Message).Seq
+	})
+
+	ctx := context.Background()
+	// The first message is being handled, the second fills the queue and
+	// the third waits for room.
+	for i := 0; i < 2; i++ {
+		if err := bus.PublishCtx(ctx, "orders", &Message{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	published := make(chan error, 1)
+	go func() { published <- bus.PublishCtx(ctx, "orders", &Message{}) }()
+	time.Sleep(50 * time.Millisecond)
+
+	read := make(chan uint64, 1)
+	go func() {
+		last, _ := st.LastSeq("orders")
+		st.Read("orders", 1, 0)
+		read <- last
+	}()
+	select {
+	case last := <-read:
+		if last != 3 {
+			t.Errorf("Expected the blocked message to be stored at 3, got %d", last)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reading the subject blocked behind the publish")
+	}
+
+	close(release)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 3; seq++ {
+		select {
+		case got := <-received:
+			if got != seq {
+				t.Errorf("Expected sequence %d, got %d", seq, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Message not received")
+		}
+	}
+}
+
+func TestBlockingBatchDoesNotLockStore(t *testing.T) {
+	st, err := store.Open(store.Options{
+		Dir:      t.TempDir(),
+		Subjects: []store.SubjectConfig{{Subject: "orders"}, {Subject: "inventory"}, {Subject: "payments"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	bus := NewSubPub(WithStore(st), WithQueueSize(1))
+	defer bus.Close(context.Background())
+
+	release := make(chan struct{})
+	received := make(chan uint64, 10)
+	_, _ = bus.Subscribe("inventory", func(msg interface{}) {
+		<-release
+		received <- msg.(*Message).Seq
+	})
+
+	// Occupy the inventory handler and fill its queue.
+	ctx := context.Background()
+	bus.Publish("inventory", &Message{})
+	time.Sleep(20 * time.Millisecond)
+	bus.Publish("inventory", &Message{})
+
+	published := make(chan error, 1)
+	go func() {
+		_, err := bus.PublishBatch(ctx, []BatchMessage{
+			{Subject: "orders", Msg: &Message{}},
+			{Subject: "inventory", Msg: &Message{}},
+		}, BlockWhenFull())
+		published <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		st.LastSeq("orders")
+		st.Read("inventory", 1, 0)
+		if _, err := bus.PublishBatch(ctx, []BatchMessage{{Subject: "payments", Msg: &Message{}}}); err != nil {
+			done <- err
+			return
+		}
+		done <- bus.PublishCtx(ctx, "orders", &Message{})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reads and other publishes blocked behind the batch waiting for room")
+	}
+
+	close(release)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 3; seq++ {
+		select {
+		case got := <-received:
+			if got != seq {
+				t.Errorf("Expected sequence %d, got %d", seq, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Message not received")
+		}
+	}
+}